@@ -1,30 +1,585 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"reflect"
 	"slices"
+	"sort"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
-	"git.marceeli.ovh/vectura/vectura-api/database"
+	"git.marceeli.ovh/vectura/vectura-api/fares"
+	"git.marceeli.ovh/vectura/vectura-api/geo"
 	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/store"
+	"git.marceeli.ovh/vectura/vectura-api/tiles"
 	"git.marceeli.ovh/vectura/vectura-api/utils"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 var SupportedCities = utils.LoadCitiesFromYAML()
 var SCIdx = utils.GetCityIDIndex()
 
-var cityData = make(map[string]*models.GTFSData)
-var cityDataMutex sync.RWMutex
+type fareLegRequest struct {
+	Route     string `json:"route"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Departure string `json:"departure"`
+	Arrival   string `json:"arrival"`
+}
+
+type fareRequest struct {
+	Date  string           `json:"date"`
+	Media string           `json:"media"`
+	Legs  []fareLegRequest `json:"legs"`
+}
 
 func parseDate(s string) (time.Time, error) {
 	return time.ParseInLocation("2006-01-02", s, time.Local)
 }
 
-func StartServer(db *gorm.DB) {
+// Languages the client asked for, most preferred first. ?lang= wins over
+// the Accept-Language header.
+func requestLanguages(c *gin.Context) []string {
+	if lang := c.Query("lang"); lang != "" {
+		return []string{lang}
+	}
+
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var langs []weighted
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		langs = append(langs, weighted{tag, q})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	var result []string
+	for _, l := range langs {
+		result = append(result, l.lang)
+		// Fall back to the primary subtag, "en-GB" can use "en" translations
+		if primary, _, ok := strings.Cut(l.lang, "-"); ok {
+			result = append(result, primary)
+		}
+	}
+
+	return result
+}
+
+// Precision of an encoded polyline requested with encoding=polyline, zero
+// when the client wants plain points
+func polylinePrecision(c *gin.Context) (int, bool) {
+	if c.Query("encoding") != "polyline" {
+		return 0, true
+	}
+
+	switch c.DefaultQuery("precision", "5") {
+	case "5":
+		return 5, true
+	case "6":
+		return 6, true
+	}
+	return 0, false
+}
+
+// Query values given either as repeated parameters or comma separated
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, v := range c.QueryArray(key) {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+// Accepts both HH:MM and HH:MM:SS, returns a zero-padded GTFS time
+func parseQueryTime(s string) (string, bool) {
+	if strings.Count(s, ":") == 1 {
+		s += ":00"
+	}
+	secs, ok := utils.ParseGTFSTime(s)
+	if !ok {
+		return "", false
+	}
+	return utils.FormatGTFSTime(secs), true
+}
+
+func parseDepartureFilter(c *gin.Context, boardableDefault bool) (models.DepartureFilter, string) {
+	filter := models.DepartureFilter{
+		Routes:     queryList(c, "route"),
+		Headsign:   c.Query("headsign"),
+		Wheelchair: c.Query("wheelchair") == "true",
+		Bikes:      c.Query("bikes") == "true",
+		Boardable:  boardableDefault,
+	}
+
+	switch c.Query("boardable") {
+	case "":
+	case "true":
+		filter.Boardable = true
+	case "false":
+		filter.Boardable = false
+	default:
+		return filter, "Boardable must be true or false"
+	}
+
+	for _, v := range queryList(c, "route_type") {
+		routeType, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return filter, "Invalid route_type parameter"
+		}
+		filter.RouteTypes = append(filter.RouteTypes, models.Type(routeType))
+	}
+
+	switch c.Query("direction") {
+	case "":
+	case "0":
+		dir := models.INBOUND
+		filter.Direction = &dir
+	case "1":
+		dir := models.OUTBOUND
+		filter.Direction = &dir
+	default:
+		return filter, "Direction must be 0 or 1"
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, ok := parseQueryTime(from)
+		if !ok {
+			return filter, "Invalid from time"
+		}
+		filter.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, ok := parseQueryTime(to)
+		if !ok {
+			return filter, "Invalid to time"
+		}
+		filter.To = t
+	}
+
+	if minutes := c.Query("minutes"); minutes != "" {
+		m, err := strconv.Atoi(minutes)
+		if err != nil || m <= 0 {
+			return filter, "Invalid minutes parameter. Please provide a positive integer."
+		}
+
+		now := time.Now()
+		start := now.Hour()*3600 + now.Minute()*60 + now.Second()
+		if filter.From != "" {
+			start, _ = utils.ParseGTFSTime(filter.From)
+		} else {
+			filter.From = utils.FormatGTFSTime(start)
+		}
+		filter.To = utils.FormatGTFSTime(start + m*60)
+	}
+
+	return filter, ""
+}
+
+func getTranslator(c *gin.Context, st store.Store, cityID string) *models.Translator {
+	tr := st.Translator(cityID, requestLanguages(c))
+	if tr != nil {
+		c.Header("Content-Language", tr.Language)
+	}
+	return tr
+}
+
+const geoJSONType = "application/geo+json"
+
+// ?format=geojson or an Accept header asking for GeoJSON
+func wantsGeoJSON(c *gin.Context) bool {
+	if format := c.Query("format"); format != "" {
+		return format == "geojson"
+	}
+	return strings.Contains(c.GetHeader("Accept"), geoJSONType)
+}
+
+// JSON rendered with the GeoJSON media type
+type geoJSON struct {
+	data any
+}
+
+func (g geoJSON) Render(w http.ResponseWriter) error {
+	g.WriteContentType(w)
+	return json.NewEncoder(w).Encode(g.data)
+}
+
+func (g geoJSON) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", geoJSONType)
+}
+
+// Colors are stored as in the feed, without the leading #
+func hexColor(color string) string {
+	if color == "" {
+		return ""
+	}
+	return "#" + color
+}
+
+func stopFeature(stop models.Stop) geo.Feature {
+	// Generic nodes and boarding areas may come without coordinates
+	var geometry *geo.Geometry
+	if stop.StopLat != 0 || stop.StopLon != 0 {
+		geometry = geo.NewPoint(stop.StopLat, stop.StopLon)
+	}
+
+	return geo.NewFeature(stop.StopId, geometry, map[string]any{
+		"stop_id":             stop.StopId,
+		"stop_code":           stop.StopCode,
+		"stop_name":           stop.StopName,
+		"location_type":       stop.LocationType,
+		"parent_station":      stop.ParentStation,
+		"platform_code":       stop.PlatformCode,
+		"wheelchair_boarding": stop.WheelchairBoarding,
+	})
+}
+
+func routeFeature(route models.Route, lines [][][2]float64) geo.Feature {
+	var geometry *geo.Geometry
+	if len(lines) > 0 {
+		geometry = geo.NewMultiLineString(lines)
+	}
+
+	return geo.NewFeature(route.RouteId, geometry, map[string]any{
+		"route_id":         route.RouteId,
+		"route_short_name": route.RouteShortName,
+		"route_long_name":  route.RouteLongName,
+		"route_type":       route.RouteType,
+		"route_color":      hexColor(route.RouteColor),
+		"route_text_color": hexColor(route.RouteTextColor),
+	})
+}
+
+func shapeFeature(id string, shapes []models.Shape) geo.Feature {
+	return geo.NewFeature(id, geo.NewLineString(models.ShapePoints(shapes)), map[string]any{
+		"shape_id": id,
+	})
+}
+
+// Bounds of the spatial stop queries, distances are in meters
+const (
+	defaultNearbyRadius  = 500
+	maxNearbyRadius      = 5000
+	defaultRouteDistance = 100
+	maxRouteDistance     = 1000
+	defaultSpatialLimit  = 50
+	maxSpatialLimit      = 500
+)
+
+// Positive number of meters up to max, def when not given
+func queryMeters(c *gin.Context, key string, def float64, max float64) (float64, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return def, true
+	}
+	meters, err := strconv.ParseFloat(v, 64)
+	if err != nil || meters <= 0 || meters > max {
+		return 0, false
+	}
+	return meters, true
+}
+
+func spatialLimit(c *gin.Context) (int, bool) {
+	v := c.Query("limit")
+	if v == "" {
+		return defaultSpatialLimit, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxSpatialLimit {
+		return 0, false
+	}
+	return limit, true
+}
+
+// Reads ?bbox=min_lon,min_lat,max_lon,max_lat, the GeoJSON order
+func parseBBox(s string) (geo.BBox, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return geo.BBox{}, false
+	}
+
+	var v [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return geo.BBox{}, false
+		}
+		v[i] = f
+	}
+
+	box := geo.BBox{MinLon: v[0], MinLat: v[1], MaxLon: v[2], MaxLat: v[3]}
+	if box.MinLat > box.MaxLat || box.MinLon > box.MaxLon ||
+		box.MinLat < -90 || box.MaxLat > 90 || box.MinLon < -180 || box.MaxLon > 180 {
+		return geo.BBox{}, false
+	}
+	return box, true
+}
+
+// Renders stops with their distances, as GeoJSON when asked to
+func renderNearbyStops(c *gin.Context, cityID string, tr *models.Translator, stops []models.NearbyStop) {
+	for i := range stops {
+		tr.Stop(&stops[i].Stop)
+	}
+
+	if wantsGeoJSON(c) {
+		features := make([]geo.Feature, 0, len(stops))
+		for _, s := range stops {
+			f := stopFeature(s.Stop)
+			f.Properties["distance"] = s.Distance
+			features = append(features, f)
+		}
+		c.Render(http.StatusOK, geoJSON{geo.NewFeatureCollection(features)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"city":  cityID,
+		"stops": stops,
+	})
+}
+
+// Reads limit, cursor and sort (a leading "-" sorts descending)
+func parseListQuery(c *gin.Context) (models.ListQuery, string) {
+	q := models.ListQuery{Cursor: c.Query("cursor")}
+
+	if sortBy := c.Query("sort"); sortBy != "" {
+		q.Sort, q.Desc = strings.CutPrefix(sortBy, "-")
+	}
+
+	if l := c.Query("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			return q, "Invalid limit"
+		}
+		q.Limit = limit
+	}
+
+	return q, ""
+}
+
+// Feed names of the fields of listed items, the same names sort= takes
+var (
+	stopFields = map[string]string{
+		"stop_id":             "StopId",
+		"stop_code":           "StopCode",
+		"stop_name":           "StopName",
+		"stop_lat":            "StopLat",
+		"stop_lon":            "StopLon",
+		"stop_url":            "StopUrl",
+		"zone_id":             "ZoneId",
+		"parent_station":      "ParentStation",
+		"platform_code":       "PlatformCode",
+		"wheelchair_boarding": "WheelchairBoarding",
+		"location_type":       "LocationType",
+		"level_id":            "LevelId",
+	}
+	routeFields = map[string]string{
+		"route_id":         "RouteId",
+		"agency_id":        "AgencyId",
+		"route_short_name": "RouteShortName",
+		"route_long_name":  "RouteLongName",
+		"route_desc":       "RouteDescription",
+		"route_type":       "RouteType",
+		"route_url":        "RouteUrl",
+		"route_color":      "RouteColor",
+		"route_text_color": "RouteTextColor",
+		"network_id":       "NetworkId",
+	}
+	tripFields = map[string]string{
+		"trip_id":               "TripId",
+		"route_id":              "RouteId",
+		"service_id":            "ServiceId",
+		"block_id":              "BlockId",
+		"trip_headsign":         "TripHeadsign",
+		"trip_short_name":       "TripShortName",
+		"direction_id":          "DirectionId",
+		"shape_id":              "ShapeId",
+		"wheelchair_accessible": "WheelchairAccessible",
+		"bikes_allowed":         "BikeAccessible",
+	}
+)
+
+// Reads ?fields= as feed names and returns the matching struct fields
+func parseFields(c *gin.Context, names map[string]string) ([]string, string) {
+	var fields []string
+	for _, f := range queryList(c, "fields") {
+		name, ok := names[f]
+		if !ok {
+			return nil, "Unknown field: " + f
+		}
+		fields = append(fields, name)
+	}
+	return fields, ""
+}
+
+// Streams {"city": ..., "<key>": [...], "next_cursor": ...} item by item.
+// Nothing is written until the first item, so errors from validating the
+// query can still be answered with a proper status.
+type listWriter struct {
+	c       *gin.Context
+	city    string
+	key     string
+	fields  []string
+	geojson bool
+	started bool
+	count   int
+}
+
+func (w *listWriter) start() {
+	w.started = true
+	w.c.Status(http.StatusOK)
+
+	city, _ := json.Marshal(w.city)
+	if w.geojson {
+		w.c.Header("Content-Type", geoJSONType)
+		w.c.Writer.WriteString(`{"type":"FeatureCollection","city":` + string(city) + `,"features":[`)
+		return
+	}
+
+	w.c.Header("Content-Type", "application/json; charset=utf-8")
+	key, _ := json.Marshal(w.key)
+	w.c.Writer.WriteString(`{"city":` + string(city) + `,` + string(key) + `:[`)
+}
+
+func (w *listWriter) write(item any) error {
+	if !w.started {
+		w.start()
+	}
+
+	if len(w.fields) > 0 && !w.geojson {
+		v := reflect.ValueOf(item)
+		selected := make(map[string]any, len(w.fields))
+		for _, f := range w.fields {
+			selected[f] = v.FieldByName(f).Interface()
+		}
+		item = selected
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if w.count > 0 {
+		w.c.Writer.WriteString(",")
+	}
+	if _, err := w.c.Writer.Write(data); err != nil {
+		return err
+	}
+
+	w.count++
+	if w.count%1000 == 0 {
+		w.c.Writer.Flush()
+	}
+	return nil
+}
+
+func (w *listWriter) finish(cursor string, err error) {
+	if err != nil && !w.started {
+		switch {
+		case errors.Is(err, models.ErrInvalidSort):
+			w.c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort field"})
+		case errors.Is(err, models.ErrInvalidCursor):
+			w.c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		default:
+			w.c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		}
+		return
+	}
+	if err != nil {
+		// Headers are gone already, the truncated body is all we can do
+		log.Printf("Streaming %s for %s failed: %v", w.key, w.city, err)
+		return
+	}
+
+	if !w.started {
+		w.start()
+	}
+
+	next := []byte("null")
+	if cursor != "" {
+		next, _ = json.Marshal(cursor)
+	}
+	w.c.Writer.WriteString(`],"next_cursor":` + string(next) + `}`)
+}
+
+// Shared handling for the paginated /stops, /routes and /trips lists.
+// Lists with a features func can also be returned as GeoJSON, fields= is
+// ignored there as the properties are fixed. GeoJSON pages are collected
+// first so features can load what they need for the whole page at once.
+func listHandler[T any](st store.Store, key string, names map[string]string, list func(string, models.ListQuery, func(T) error) (string, error), translate func(*models.Translator, *T), features func(string, []T) []geo.Feature) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cityID := c.Param("city")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		q, errMsg := parseListQuery(c)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+
+		fields, errMsg := parseFields(c, names)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+
+		tr := getTranslator(c, st, cityID)
+		w := &listWriter{c: c, city: cityID, key: key, fields: fields}
+		w.geojson = features != nil && wantsGeoJSON(c)
+
+		var page []T
+		cursor, err := list(cityID, q, func(item T) error {
+			translate(tr, &item)
+			if w.geojson {
+				page = append(page, item)
+				return nil
+			}
+			return w.write(item)
+		})
+
+		if w.geojson && err == nil {
+			for _, feature := range features(cityID, page) {
+				if err = w.write(feature); err != nil {
+					break
+				}
+			}
+		}
+		w.finish(cursor, err)
+	}
+}
+
+// StartServer serves the API from st. Endpoints needing a capability st
+// lacks answer 501.
+func StartServer(st store.Store) {
 	r := gin.Default()
 
 	r.GET("/api/cities", func(c *gin.Context) {
@@ -33,22 +588,61 @@ func StartServer(db *gorm.DB) {
 		})
 	})
 
-	r.GET("/api/:city/stops", func(c *gin.Context) {
+	r.GET("/api/:city/feed", func(c *gin.Context) {
 		cityID := c.Param("city")
 
 		exists := slices.Contains(SCIdx, cityID)
 		if !exists {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"city":  cityID,
-			"stops": database.GetStops(db, cityID),
+			"city": cityID,
+			"feed": st.FeedInfo(cityID),
 		})
 	})
 
-	r.GET("/api/:city/routes", func(c *gin.Context) {
+	r.GET("/api/:city/stops", listHandler(st, "stops", stopFields, st.Stops, (*models.Translator).Stop, func(_ string, stops []models.Stop) []geo.Feature {
+		features := make([]geo.Feature, len(stops))
+		for i, stop := range stops {
+			features[i] = stopFeature(stop)
+		}
+		return features
+	}))
+
+	r.GET("/api/:city/stops/nearby", func(c *gin.Context) {
+		cityID := c.Param("city")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+		lon, errLon := strconv.ParseFloat(c.Query("lon"), 64)
+		if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You need to specify a valid lat and lon!"})
+			return
+		}
+
+		radius, ok := queryMeters(c, "radius", defaultNearbyRadius, maxNearbyRadius)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Radius must be a positive number of meters up to " + strconv.Itoa(maxNearbyRadius)})
+			return
+		}
+
+		limit, ok := spatialLimit(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and " + strconv.Itoa(maxSpatialLimit)})
+			return
+		}
+
+		renderNearbyStops(c, cityID, getTranslator(c, st, cityID), st.StopsNearby(cityID, lat, lon, radius, limit))
+	})
+
+	r.GET("/api/:city/stops/bbox", func(c *gin.Context) {
 		cityID := c.Param("city")
 
 		exists := slices.Contains(SCIdx, cityID)
@@ -57,14 +651,86 @@ func StartServer(db *gorm.DB) {
 			return
 		}
 
+		box, ok := parseBBox(c.Query("bbox"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You need to specify a bbox as min_lon,min_lat,max_lon,max_lat!"})
+			return
+		}
+
+		limit, ok := spatialLimit(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and " + strconv.Itoa(maxSpatialLimit)})
+			return
+		}
+
+		stops := st.StopsInBBox(cityID, box, limit)
+		getTranslator(c, st, cityID).Stops(stops)
+
+		if wantsGeoJSON(c) {
+			features := make([]geo.Feature, 0, len(stops))
+			for _, stop := range stops {
+				features = append(features, stopFeature(stop))
+			}
+			c.Render(http.StatusOK, geoJSON{geo.NewFeatureCollection(features)})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"city":   cityID,
-			"routes": database.GetRoutes(db, cityID),
+			"city":  cityID,
+			"stops": stops,
 		})
 	})
 
-	r.GET("/api/:city/trips", func(c *gin.Context) {
+	r.GET("/api/:city/routes/:route/stops/nearby", func(c *gin.Context) {
+		cityID := c.Param("city")
+		routeID := c.Param("route")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		distance, ok := queryMeters(c, "distance", defaultRouteDistance, maxRouteDistance)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Distance must be a positive number of meters up to " + strconv.Itoa(maxRouteDistance)})
+			return
+		}
+
+		limit, ok := spatialLimit(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and " + strconv.Itoa(maxSpatialLimit)})
+			return
+		}
+
+		stops, found := st.StopsAlongRoute(cityID, routeID, distance, limit)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+			return
+		}
+
+		renderNearbyStops(c, cityID, getTranslator(c, st, cityID), stops)
+	})
+
+	r.GET("/api/:city/routes", listHandler(st, "routes", routeFields, st.Routes, (*models.Translator).Route, func(cityID string, routes []models.Route) []geo.Feature {
+		ids := make([]string, len(routes))
+		for i, route := range routes {
+			ids[i] = route.RouteId
+		}
+		lines := st.RouteShapes(cityID, ids)
+
+		features := make([]geo.Feature, len(routes))
+		for i, route := range routes {
+			features[i] = routeFeature(route, lines[route.RouteId])
+		}
+		return features
+	}))
+
+	r.GET("/api/:city/trips", listHandler(st, "trips", tripFields, st.Trips, (*models.Translator).Trip, nil))
+
+	r.GET("/api/:city/trips/:trip", func(c *gin.Context) {
 		cityID := c.Param("city")
+		tripID := c.Param("trip")
 
 		exists := slices.Contains(SCIdx, cityID)
 		if !exists {
@@ -72,9 +738,22 @@ func StartServer(db *gorm.DB) {
 			return
 		}
 
+		precision, ok := polylinePrecision(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Precision must be 5 or 6"})
+			return
+		}
+
+		trip, found := st.TripDetail(cityID, tripID, precision)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
+			return
+		}
+		getTranslator(c, st, cityID).TripDetail(&trip)
+
 		c.JSON(http.StatusOK, gin.H{
-			"city":  cityID,
-			"trips": database.GetTrips(db, cityID),
+			"city": cityID,
+			"trip": trip,
 		})
 	})
 
@@ -89,6 +768,15 @@ func StartServer(db *gorm.DB) {
 			return
 		}
 
+		filter, filterErr := parseDepartureFilter(c, false)
+		if filterErr != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"city":  cityID,
+				"error": filterErr,
+			})
+			return
+		}
+
 		if stopID != "" {
 			if date != "" {
 				parsedDate, err := parseDate(date)
@@ -97,15 +785,21 @@ func StartServer(db *gorm.DB) {
 					return
 				}
 
+				departures := st.Departures(cityID, stopID, parsedDate, filter, -1)
+				getTranslator(c, st, cityID).Departures(departures)
+
 				c.JSON(http.StatusOK, gin.H{
 					"city":       cityID,
 					"date":       date,
-					"departures": database.GetDeparturesForStopOnDate(db, cityID, stopID, parsedDate),
+					"departures": departures,
 				})
 			} else {
+				departures := st.Departures(cityID, stopID, time.Now(), filter, -1)
+				getTranslator(c, st, cityID).Departures(departures)
+
 				c.JSON(http.StatusOK, gin.H{
 					"city":       cityID,
-					"departures": database.GetDeparturesForStopToday(db, cityID, stopID),
+					"departures": departures,
 				})
 			}
 		} else {
@@ -155,6 +849,15 @@ func StartServer(db *gorm.DB) {
 			return
 		}
 
+		filter, filterErr := parseDepartureFilter(c, true)
+		if filterErr != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"city":  cityID,
+				"error": filterErr,
+			})
+			return
+		}
+
 		if date != "" {
 			parsedDate, err := parseDate(date)
 			if err != nil {
@@ -162,24 +865,32 @@ func StartServer(db *gorm.DB) {
 				return
 			}
 
+			departures := st.Departures(cityID, stopID, parsedDate, filter.FromNow(), limit)
+			getTranslator(c, st, cityID).Departures(departures)
+
 			c.JSON(http.StatusOK, gin.H{
 				"city":       cityID,
 				"date":       date,
 				"number":     number,
-				"departures": database.GetNextDeparturesForStopOnDate(db, cityID, stopID, parsedDate, limit),
+				"departures": departures,
 			})
 		} else {
+			departures := st.Departures(cityID, stopID, time.Now(), filter.FromNow(), limit)
+			getTranslator(c, st, cityID).Departures(departures)
+
 			c.JSON(http.StatusOK, gin.H{
 				"city":       cityID,
 				"number":     number,
-				"departures": database.GetNextDeparturesForStopOnDate(db, cityID, stopID, time.Now(), limit),
+				"departures": departures,
 			})
 		}
 	})
 
-	r.GET("/api/:city/shapes", func(c *gin.Context) {
+	r.GET("/api/:city/arrivals", func(c *gin.Context) {
 		cityID := c.Param("city")
-		shape := c.Query("shape")
+		stopID := c.Query("stop")
+		number := c.Query("number")
+		date := c.Query("date")
 
 		exists := slices.Contains(SCIdx, cityID)
 		if !exists {
@@ -187,19 +898,601 @@ func StartServer(db *gorm.DB) {
 			return
 		}
 
-		if shape != "" {
-			c.JSON(http.StatusOK, gin.H{
-				"city":   cityID,
-				"shapes": database.GetShapeById(db, cityID, shape),
+		if stopID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"city":  cityID,
+				"error": "You need to specify a stop!",
 			})
-		} else {
+			return
+		}
+
+		limit := -1
+		if number != "" {
+			var err error
+			limit, err = strconv.Atoi(number)
+			if err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"city":  cityID,
+					"error": "Invalid number parameter. Please provide a positive integer.",
+				})
+				return
+			}
+		}
+
+		filter, filterErr := parseDepartureFilter(c, false)
+		if filterErr != "" {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"city":  cityID,
-				"error": "You need to specify a shape!",
+				"error": filterErr,
 			})
+			return
+		}
+
+		parsedDate := time.Now()
+		if date != "" {
+			var err error
+			parsedDate, err = parseDate(date)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+				return
+			}
 		}
 
+		arrivals := st.Arrivals(cityID, stopID, parsedDate, filter, limit)
+		getTranslator(c, st, cityID).Departures(arrivals)
+
+		c.JSON(http.StatusOK, gin.H{
+			"city":     cityID,
+			"date":     parsedDate.Format("2006-01-02"),
+			"arrivals": arrivals,
+		})
 	})
 
-	r.Run()
+	r.GET("/api/:city/shapes", func(c *gin.Context) {
+		cityID := c.Param("city")
+		shape := c.Query("shape")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		precision, ok := polylinePrecision(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Precision must be 5 or 6"})
+			return
+		}
+
+		// In meters
+		var tolerance float64
+		if t := c.Query("tolerance"); t != "" {
+			var err error
+			if tolerance, err = strconv.ParseFloat(t, 64); err != nil || tolerance < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tolerance"})
+				return
+			}
+		}
+
+		if wantsGeoJSON(c) {
+			var features []geo.Feature
+			if shape != "" {
+				if shapes := st.Shape(cityID, shape); len(shapes) > 0 {
+					features = append(features, shapeFeature(shape, models.SimplifyShape(shapes, tolerance)))
+				}
+			} else {
+				for _, id := range st.ShapeIDs(cityID) {
+					features = append(features, shapeFeature(id, models.SimplifyShape(st.Shape(cityID, id), tolerance)))
+				}
+			}
+
+			c.Render(http.StatusOK, geoJSON{geo.NewFeatureCollection(features)})
+			return
+		}
+
+		if shape == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"city":  cityID,
+				"error": "You need to specify a shape!",
+			})
+			return
+		}
+
+		if precision != 0 {
+			info, found := st.ShapeInfo(cityID, shape)
+			if !found {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Shape not found"})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"city":  cityID,
+				"shape": models.EncodeShape(info, st.Shape(cityID, shape), precision, tolerance),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"city":   cityID,
+			"shapes": models.SimplifyShape(st.Shape(cityID, shape), tolerance),
+		})
+	})
+
+	r.GET("/api/:city/calendar", func(c *gin.Context) {
+		cityID := c.Param("city")
+		date := c.Query("date")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		parsedDate := time.Now()
+		if date != "" {
+			var err error
+			parsedDate, err = parseDate(date)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+				return
+			}
+		}
+
+		response := gin.H{
+			"city":     cityID,
+			"date":     parsedDate.Format("2006-01-02"),
+			"services": st.ServicesForDate(cityID, parsedDate),
+		}
+
+		// Overview of the days starting at date
+		if d := c.Query("days"); d != "" {
+			days, err := strconv.Atoi(d)
+			if err != nil || days < 1 || days > 366 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Days must be between 1 and 366"})
+				return
+			}
+			response["days"] = st.ServiceOverview(cityID, parsedDate, days)
+		}
+
+		c.JSON(http.StatusOK, response)
+	})
+
+	r.GET("/api/:city/services/:service", func(c *gin.Context) {
+		cityID := c.Param("city")
+		serviceID := c.Param("service")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		service, found := st.ServiceDetail(cityID, serviceID)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"city":    cityID,
+			"service": service,
+		})
+	})
+
+	r.GET("/api/:city/routes/:route", func(c *gin.Context) {
+		cityID := c.Param("city")
+		routeID := c.Param("route")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		route, found := st.RouteDetail(cityID, routeID)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+			return
+		}
+		getTranslator(c, st, cityID).RouteDetail(&route)
+
+		if wantsGeoJSON(c) {
+			c.Render(http.StatusOK, geoJSON{routeFeature(route.Route, st.RouteShapes(cityID, []string{routeID})[routeID])})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"city":  cityID,
+			"route": route,
+		})
+	})
+
+	registerCapabilityRoutes(r, st)
+
+	r.Run()
+}
+
+// Answers requests for what the store can't serve
+func notImplemented(c *gin.Context) {
+	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not available with this store"})
+}
+
+// Endpoints served through the optional store interfaces
+func registerCapabilityRoutes(r *gin.Engine, st store.Store) {
+	r.GET("/api/:city/routes/:route/timetable", func(c *gin.Context) {
+		cityID := c.Param("city")
+		routeID := c.Param("route")
+		date := c.Query("date")
+		direction := c.DefaultQuery("direction", "0")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		timetables, ok := st.(store.Timetables)
+		if !ok {
+			notImplemented(c)
+			return
+		}
+
+		parsedDate := time.Now()
+		if date != "" {
+			var err error
+			parsedDate, err = parseDate(date)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+				return
+			}
+		}
+
+		if direction != "0" && direction != "1" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Direction must be 0 or 1"})
+			return
+		}
+		dir := models.INBOUND
+		if direction == "1" {
+			dir = models.OUTBOUND
+		}
+
+		timetable, found := timetables.Timetable(cityID, routeID, parsedDate, dir)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+			return
+		}
+		getTranslator(c, st, cityID).Timetable(&timetable)
+
+		c.JSON(http.StatusOK, gin.H{
+			"city":      cityID,
+			"timetable": timetable,
+		})
+	})
+
+	r.GET("/api/:city/trips/:trip/shape", func(c *gin.Context) {
+		cityID := c.Param("city")
+		tripID := c.Param("trip")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		shapes, ok := st.(store.TripShapes)
+		if !ok {
+			notImplemented(c)
+			return
+		}
+
+		precision, ok := polylinePrecision(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Precision must be 5 or 6"})
+			return
+		}
+
+		segment, err := shapes.TripShapeSegment(cityID, tripID, c.Query("from_stop"), c.Query("to_stop"), precision)
+		switch {
+		case errors.Is(err, models.ErrTripNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
+			return
+		case errors.Is(err, models.ErrTripNoShape):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trip has no shape"})
+			return
+		case errors.Is(err, models.ErrStopNotOnTrip):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Stops are not served by this trip in that order"})
+			return
+		}
+
+		if wantsGeoJSON(c) {
+			c.Render(http.StatusOK, geoJSON{geo.NewFeature(tripID, geo.NewLineString(segment.Points), map[string]any{
+				"trip_id":       segment.TripId,
+				"shape_id":      segment.ShapeId,
+				"from_stop":     segment.FromStop,
+				"to_stop":       segment.ToStop,
+				"from_distance": segment.FromDistance,
+				"to_distance":   segment.ToDistance,
+			})})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"city":  cityID,
+			"shape": segment,
+		})
+	})
+
+	r.GET("/api/:city/vehicles/scheduled", func(c *gin.Context) {
+		cityID := c.Param("city")
+		date := c.Query("date")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		vehicleStore, ok := st.(store.Vehicles)
+		if !ok {
+			notImplemented(c)
+			return
+		}
+
+		now := time.Now()
+		parsedDate := now
+		if date != "" {
+			var err error
+			parsedDate, err = parseDate(date)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+				return
+			}
+		}
+
+		secs := now.Hour()*3600 + now.Minute()*60 + now.Second()
+		if t := c.Query("time"); t != "" {
+			parsed, ok := parseQueryTime(t)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time, use HH:MM or HH:MM:SS"})
+				return
+			}
+			secs, _ = utils.ParseGTFSTime(parsed)
+		}
+
+		vehicles := vehicleStore.ScheduledVehicles(cityID, parsedDate, secs)
+		tr := getTranslator(c, st, cityID)
+		for i := range vehicles {
+			tr.Trip(&vehicles[i].Trip)
+			tr.Route(&vehicles[i].Route)
+		}
+
+		if wantsGeoJSON(c) {
+			var features []geo.Feature
+			for _, v := range vehicles {
+				features = append(features, geo.NewFeature(v.Trip.TripId, geo.NewPoint(v.Lat, v.Lon), map[string]any{
+					"trip_id":          v.Trip.TripId,
+					"trip_headsign":    v.Trip.TripHeadsign,
+					"route_id":         v.Route.RouteId,
+					"route_short_name": v.Route.RouteShortName,
+					"route_type":       v.Route.RouteType,
+					"route_color":      hexColor(v.Route.RouteColor),
+					"start_time":       v.StartTime,
+					"bearing":          v.Bearing,
+					"previous_stop":    v.PreviousStop,
+					"next_stop":        v.NextStop,
+					"at_stop":          v.AtStop,
+				}))
+			}
+			c.Render(http.StatusOK, geoJSON{geo.NewFeatureCollection(features)})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"city":     cityID,
+			"time":     utils.FormatGTFSTime(secs),
+			"vehicles": vehicles,
+		})
+	})
+
+	r.GET("/api/:city/tiles/:z/:x/:y", func(c *gin.Context) {
+		cityID := c.Param("city")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		tileStore, ok := st.(store.Tiles)
+		if !ok {
+			notImplemented(c)
+			return
+		}
+
+		z, errZ := strconv.Atoi(c.Param("z"))
+		x, errX := strconv.Atoi(c.Param("x"))
+		y, errY := strconv.Atoi(strings.TrimSuffix(c.Param("y"), ".mvt"))
+		if errZ != nil || errX != nil || errY != nil ||
+			z < 0 || z > tiles.MaxZoom || x < 0 || x >= 1<<z || y < 0 || y >= 1<<z {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tile coordinates"})
+			return
+		}
+
+		tile := tileStore.Tile(cityID, z, x, y)
+		if len(tile) == 0 {
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		c.Data(http.StatusOK, "application/vnd.mapbox-vector-tile", tile)
+	})
+
+	r.GET("/api/:city/fares", func(c *gin.Context) {
+		cityID := c.Param("city")
+		from := c.Query("from")
+		to := c.Query("to")
+		route := c.Query("route")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		fareStore, ok := st.(store.Fares)
+		if !ok {
+			notImplemented(c)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"city":  cityID,
+			"fares": fareStore.Fares(cityID, from, to, route),
+		})
+	})
+
+	r.POST("/api/:city/fares/calculate", func(c *gin.Context) {
+		cityID := c.Param("city")
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		fareStore, ok := st.(store.Fares)
+		if !ok {
+			notImplemented(c)
+			return
+		}
+
+		var req fareRequest
+		if err := c.ShouldBindJSON(&req); err != nil || len(req.Legs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"city":  cityID,
+				"error": "You need to specify the legs to price!",
+			})
+			return
+		}
+
+		date := time.Now()
+		if req.Date != "" {
+			parsedDate, err := parseDate(req.Date)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+				return
+			}
+			date = parsedDate
+		}
+
+		var (
+			legs     []fares.Leg
+			stopIDs  []string
+			routeIDs []string
+		)
+		for _, l := range req.Legs {
+			departure, depOk := utils.ParseGTFSTime(l.Departure)
+			arrival, arrOk := utils.ParseGTFSTime(l.Arrival)
+			if !depOk || !arrOk {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format"})
+				return
+			}
+
+			legs = append(legs, fares.Leg{
+				RouteId:    l.Route,
+				FromStopId: l.From,
+				ToStopId:   l.To,
+				Departure:  departure,
+				Arrival:    arrival,
+			})
+			stopIDs = append(stopIDs, l.From, l.To)
+			routeIDs = append(routeIDs, l.Route)
+		}
+
+		calc := fares.NewCalculator(fareStore.FareData(cityID, stopIDs, routeIDs))
+
+		// Legs past midnight run on the next day's services
+		lastSecs := 0
+		for _, leg := range legs {
+			lastSecs = max(lastSecs, leg.Departure, leg.Arrival)
+		}
+		services := make([]map[string]bool, lastSecs/86400+1)
+		for day := range services {
+			services[day] = make(map[string]bool)
+			for _, service := range st.ServicesForDate(cityID, date.AddDate(0, 0, day)) {
+				services[day][service.ServiceId] = true
+			}
+		}
+
+		result := calc.Calculate(legs, services, req.Media)
+		tr := getTranslator(c, st, cityID)
+		for i := range result.Legs {
+			tr.FareProduct(result.Legs[i].Product)
+			tr.FareProduct(result.Legs[i].TransferProduct)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"city": cityID,
+			"fare": result,
+		})
+	})
+
+	r.GET("/api/:city/stations/:id", func(c *gin.Context) {
+		cityID := c.Param("city")
+		stationID := c.Param("id")
+		from := c.Query("from")
+		to := c.Query("to")
+		stepFree := c.Query("step_free") == "true"
+
+		exists := slices.Contains(SCIdx, cityID)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not supported"})
+			return
+		}
+
+		stations, ok := st.(store.Stations)
+		if !ok {
+			notImplemented(c)
+			return
+		}
+
+		station, ok := stations.Station(cityID, stationID)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Station not found"})
+			return
+		}
+		getTranslator(c, st, cityID).Station(&station)
+
+		if from == "" && to == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"city":    cityID,
+				"station": station,
+			})
+			return
+		}
+
+		if from == "" || to == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"city":  cityID,
+				"error": "You need to specify both from and to!",
+			})
+			return
+		}
+
+		route, found := models.FindStationRoute(station.Pathways, from, to, stepFree)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{
+				"city":    cityID,
+				"station": station,
+				"error":   "No route between these nodes",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"city":    cityID,
+			"station": station,
+			"route":   route,
+		})
+	})
 }
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const serviceDateFormat = "2006-01-02"
+
+func serviceDate(date time.Time) string {
+	return date.Format(serviceDateFormat)
+}
+
+// Joins the trips of q to the services running on date
+func joinServiceDate(q *gorm.DB, date time.Time) *gorm.DB {
+	return q.Joins("JOIN service_dates ON service_dates.city_id = trips.city_id AND service_dates.service_id = trips.service_id AND service_dates.date = ?", serviceDate(date))
+}
+
+// materializeServiceDates expands every calendar of a city with its
+// calendar_dates exceptions into the service_dates table
+func materializeServiceDates(db *gorm.DB, city string, batchSize int) {
+	var dbCalendars []Calendar
+	db.Table("calendars").Where("city_id = ?", city).Find(&dbCalendars)
+
+	calendars := make([]models.Calendar, 0, len(dbCalendars))
+	for _, dbCal := range dbCalendars {
+		calendars = append(calendars, DbCalendarToCalendar(dbCal))
+	}
+
+	var dbCalendarDates []CalendarDate
+	db.Table("calendar_dates").Where("city_id = ?", city).Find(&dbCalendarDates)
+
+	calendarDates := make([]models.CalendarDate, 0, len(dbCalendarDates))
+	for _, dbDate := range dbCalendarDates {
+		calendarDates = append(calendarDates, DbCalendarDateToCalendarDate(dbDate))
+	}
+
+	dates := models.ServiceDates(calendars, calendarDates)
+
+	var dbServiceDates []ServiceDate
+	for _, service := range slices.Sorted(maps.Keys(dates)) {
+		for _, date := range dates[service] {
+			dbServiceDates = append(dbServiceDates, ServiceDate{CityId: city, Date: serviceDate(date), ServiceId: service})
+		}
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbServiceDates, batchSize)
+}
+
+// Number of trips of each service in a city
+func getServiceTripCounts(db *gorm.DB, city string) map[string]int {
+	var rows []struct {
+		ServiceId string
+		Count     int
+	}
+	db.Table("trips").
+		Select("service_id, COUNT(*) AS count").
+		Where("city_id = ?", city).
+		Group("service_id").
+		Scan(&rows)
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.ServiceId] = row.Count
+	}
+	return counts
+}
+
+// GetServicesForDate lists the services running on a date, ordered by ID
+func GetServicesForDate(db *gorm.DB, city string, date time.Time) []models.ServiceSummary {
+	services := GetActiveServicesForDate(db, city, date)
+	counts := getServiceTripCounts(db, city)
+
+	summaries := make([]models.ServiceSummary, 0, len(services))
+	for _, id := range slices.Sorted(maps.Keys(services)) {
+		summaries = append(summaries, models.ServiceSummary{ServiceId: id, TripCount: counts[id]})
+	}
+	return summaries
+}
+
+// GetServiceOverview counts the services and trips running on each of the
+// given number of days starting at from
+func GetServiceOverview(db *gorm.DB, city string, from time.Time, days int) []models.ServiceDay {
+	start := models.LocalDate(from)
+	end := start.AddDate(0, 0, days-1)
+
+	var rows []ServiceDate
+	db.Model(&ServiceDate{}).
+		Select("date, service_id").
+		Where("city_id = ?", city).
+		Where("date BETWEEN ? AND ?", serviceDate(start), serviceDate(end)).
+		Find(&rows)
+
+	counts := getServiceTripCounts(db, city)
+	byDate := make(map[string]*models.ServiceDay)
+
+	overview := make([]models.ServiceDay, days)
+	for i := range overview {
+		overview[i].Date = serviceDate(start.AddDate(0, 0, i))
+		byDate[overview[i].Date] = &overview[i]
+	}
+
+	for _, row := range rows {
+		if day, ok := byDate[row.Date]; ok {
+			day.ServiceCount++
+			day.TripCount += counts[row.ServiceId]
+		}
+	}
+
+	return overview
+}
+
+func GetServiceDetail(db *gorm.DB, city string, service string) (models.ServiceDetail, bool) {
+	detail := models.ServiceDetail{ServiceId: service}
+
+	var dbCal Calendar
+	res := db.Table("calendars").Where("city_id = ?", city).Where("service_id = ?", service).Limit(1).Find(&dbCal)
+	if res.RowsAffected > 0 {
+		cal := DbCalendarToCalendar(dbCal)
+		detail.Calendar = &cal
+	}
+
+	var dbDates []CalendarDate
+	db.Table("calendar_dates").Where("city_id = ?", city).Where("service_id = ?", service).Order("date").Find(&dbDates)
+
+	if detail.Calendar == nil && len(dbDates) == 0 {
+		return detail, false
+	}
+
+	for _, dbDate := range dbDates {
+		cd := DbCalendarDateToCalendarDate(dbDate)
+		switch cd.ExceptionType {
+		case models.SERVICE_ADDED:
+			detail.AddedDates = append(detail.AddedDates, cd.Date.Format("2006-01-02"))
+		case models.SERVICE_REMOVED:
+			detail.RemovedDates = append(detail.RemovedDates, cd.Date.Format("2006-01-02"))
+		}
+	}
+
+	detail.Dates = []string{}
+	for _, d := range GetServiceDates(db, city, service) {
+		detail.Dates = append(detail.Dates, serviceDate(d))
+	}
+
+	var tripCount int64
+	db.Table("trips").Where("city_id = ?", city).Where("service_id = ?", service).Count(&tripCount)
+	detail.TripCount = int(tripCount)
+
+	return detail, true
+}
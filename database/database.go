@@ -12,30 +12,58 @@ import (
 	"gorm.io/gorm/clause"
 )
 
-func PreloadCities(db *gorm.DB) {
-	cities := utils.LoadCitiesFromYAML()
+var cityLoadedHooks []func(db *gorm.DB, city string)
+
+// OnCityLoaded registers fn to run every time a city's feed has finished
+// importing
+func OnCityLoaded(fn func(db *gorm.DB, city string)) {
+	cityLoadedHooks = append(cityLoadedHooks, fn)
+}
+
+// Tables the import fills, dropped and recreated on every start
+var tables = []any{
+	&Stop{},
+	&Route{},
+	&Trip{},
+	&Departure{},
+	&Calendar{},
+	&CalendarDate{},
+	&ServiceDate{},
+	&Shape{},
+	&ShapeInfo{},
+	&Frequency{},
+	&FareAttribute{},
+	&FareRule{},
+	&FareProduct{},
+	&FareMedia{},
+	&FareLegRule{},
+	&FareTransferRule{},
+	&Area{},
+	&StopArea{},
+	&Network{},
+	&RouteNetwork{},
+	&Timeframe{},
+	&Pathway{},
+	&Level{},
+	&Translation{},
+	&FeedInfo{},
+}
 
+// Migrate recreates the tables empty
+func Migrate(db *gorm.DB) {
 	// Fuck the entire db
-	db.Migrator().DropTable(
-		&Stop{},
-		&Route{},
-		&Trip{},
-		&Departure{},
-		&Calendar{},
-		&CalendarDate{},
-		&Shape{},
-	)
+	db.Migrator().DropTable(tables...)
 
 	// just kidding lmao
-	db.AutoMigrate(
-		&Stop{},
-		&Route{},
-		&Trip{},
-		&Departure{},
-		&Calendar{},
-		&CalendarDate{},
-		&Shape{},
-	)
+	db.AutoMigrate(tables...)
+
+	setupPostGIS(db)
+}
+
+func PreloadCities(db *gorm.DB) {
+	cities := utils.LoadCitiesFromYAML()
+
+	Migrate(db)
 
 	for _, city := range cities {
 		filePath := fmt.Sprintf("/tmp/%s.zip", city.ID)
@@ -49,125 +77,166 @@ func PreloadCities(db *gorm.DB) {
 			panic(err)
 		}
 
-		limit := 2000
+		ImportCity(db, city.ID, zipReader)
+		zipReader.Close()
+	}
+}
 
-		var dbStops []Stop
-		for _, stop := range parser.GetStops(zipReader) {
-			dbStops = append(dbStops, StopToDbStop(stop, city.ID))
-		}
-		db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbStops, limit)
+// ImportCity loads a city's feed into the migrated tables
+func ImportCity(db *gorm.DB, city string, zipReader *zip.ReadCloser) {
+	limit := 2000
 
-		dbStops = nil
+	// Stop coordinates are needed later on to interpolate stop times
+	stops := make(map[string]models.Stop)
 
-		var dbRoutes []Route
-		for _, route := range parser.GetRoutes(zipReader) {
-			dbRoutes = append(dbRoutes, RouteToDbRoute(route, city.ID))
-		}
-		db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbRoutes, limit)
+	var dbStops []Stop
+	for _, stop := range parser.GetStops(zipReader) {
+		stops[stop.StopId] = stop
+		dbStops = append(dbStops, StopToDbStop(stop, city))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbStops, limit)
 
-		dbRoutes = nil
+	dbStops = nil
 
-		var dbTrips []Trip
-		for _, trip := range parser.GetTrips(zipReader) {
-			dbTrips = append(dbTrips, TripToDbTrip(trip, city.ID))
-		}
-		db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbTrips, limit)
+	var dbRoutes []Route
+	for _, route := range parser.GetRoutes(zipReader) {
+		dbRoutes = append(dbRoutes, RouteToDbRoute(route, city))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbRoutes, limit)
 
-		dbTrips = nil
+	dbRoutes = nil
 
-		parser.ProcessDeparturesChunked(zipReader, 15000, func(departures []models.Departure) {
-			if len(departures) > 0 {
-				var dbDepartures []Departure
-				for _, dep := range departures {
-					dbDepartures = append(dbDepartures, DepartureToDbDeparture(dep, city.ID))
-				}
-				db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbDepartures, limit)
-			}
-		})
+	var dbTrips []Trip
+	for _, trip := range parser.GetTrips(zipReader) {
+		dbTrips = append(dbTrips, TripToDbTrip(trip, city))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbTrips, limit)
+
+	dbTrips = nil
 
-		var dbCalendars []Calendar
-		for _, cal := range parser.GetCalendar(zipReader) {
-			dbCalendars = append(dbCalendars, CalendarToDbCalendar(cal, city.ID))
+	spans := make(map[string]tripSpan)
+	parser.ProcessDeparturesChunked(zipReader, 15000, stops, func(departures []models.Departure) {
+		for _, dep := range departures {
+			addTripSpan(spans, dep)
+		}
+		if len(departures) > 0 {
+			var dbDepartures []Departure
+			for _, dep := range departures {
+				dbDepartures = append(dbDepartures, DepartureToDbDeparture(dep, city))
+			}
+			db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbDepartures, limit)
 		}
-		db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbCalendars, limit)
+	})
 
-		dbCalendars = nil
+	storeTripSpans(db, city, spans)
+	spans = nil
 
-		var dbCalendarDates []CalendarDate
-		for _, cd := range parser.GetCalendarDates(zipReader) {
-			dbCalendarDates = append(dbCalendarDates, CalendarDateToDbCalendarDate(cd, city.ID))
-		}
-		db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbCalendarDates, limit)
+	var dbCalendars []Calendar
+	for _, cal := range parser.GetCalendar(zipReader) {
+		dbCalendars = append(dbCalendars, CalendarToDbCalendar(cal, city))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbCalendars, limit)
 
-		dbCalendarDates = nil
+	dbCalendars = nil
+	stops = nil
 
-		var dbShapes []Shape
-		for _, shape := range parser.GetShapes(zipReader) {
-			dbShapes = append(dbShapes, ShapeToDbShape(shape, city.ID))
-		}
-		db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbShapes, limit)
+	var dbCalendarDates []CalendarDate
+	for _, cd := range parser.GetCalendarDates(zipReader) {
+		dbCalendarDates = append(dbCalendarDates, CalendarDateToDbCalendarDate(cd, city))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbCalendarDates, limit)
 
-		dbShapes = nil
+	dbCalendarDates = nil
 
-		zipReader.Close()
+	materializeServiceDates(db, city, limit)
 
-		// Clear interner cache between cities to prevent memory bloat
-		parser.ClearInterner()
+	shapes := parser.GetShapes(zipReader)
 
-		println("Successfully loaded GTFS data for city:", city.ID)
+	var dbShapes []Shape
+	for _, shape := range shapes {
+		dbShapes = append(dbShapes, ShapeToDbShape(shape, city))
 	}
-}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbShapes, limit)
 
-func GetStops(db *gorm.DB, city string) []models.Stop {
-	var dbdata []Stop
-	var data []models.Stop
+	dbShapes = nil
 
-	db.Table("stops").Where("city_id = ?", city).Find(&dbdata)
+	var dbShapeInfos []ShapeInfo
+	for _, info := range models.ComputeShapeInfos(shapes) {
+		dbShapeInfos = append(dbShapeInfos, ShapeInfoToDbShapeInfo(info, city))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbShapeInfos, limit)
 
-	for _, dat := range dbdata {
-		data = append(data, DbStopToStop(dat))
+	shapes = nil
+	dbShapeInfos = nil
+
+	synthesizeShapes(db, city, limit)
+	snapStopsToShapes(db, city)
+	indexGeometries(db, city)
+
+	var dbFrequencies []Frequency
+	for _, freq := range parser.GetFrequencies(zipReader) {
+		dbFrequencies = append(dbFrequencies, FrequencyToDbFrequency(freq, city))
 	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbFrequencies, limit)
 
-	return data
-}
+	dbFrequencies = nil
 
-func GetRoutes(db *gorm.DB, city string) []models.Route {
-	var dbdata []Route
-	var data []models.Route
+	var dbFareAttributes []FareAttribute
+	for _, fare := range parser.GetFareAttributes(zipReader) {
+		dbFareAttributes = append(dbFareAttributes, FareAttributeToDbFareAttribute(fare, city))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbFareAttributes, limit)
 
-	db.Table("routes").Where("city_id = ?", city).Find(&dbdata)
+	dbFareAttributes = nil
 
-	for _, dat := range dbdata {
-		data = append(data, DbRouteToRoute(dat))
+	var dbFareRules []FareRule
+	for _, rule := range parser.GetFareRules(zipReader) {
+		dbFareRules = append(dbFareRules, FareRuleToDbFareRule(rule, city))
 	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbFareRules, limit)
 
-	return data
-}
+	dbFareRules = nil
 
-func GetTrips(db *gorm.DB, city string) []models.Trip {
-	var dbdata []Trip
-	var data []models.Trip
+	preloadFaresV2(db, zipReader, city, limit)
 
-	db.Table("trips").Where("city_id = ?", city).Find(&dbdata)
+	var dbPathways []Pathway
+	for _, pathway := range parser.GetPathways(zipReader) {
+		dbPathways = append(dbPathways, PathwayToDbPathway(pathway, city))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbPathways, limit)
 
-	for _, dat := range dbdata {
-		data = append(data, DbTripToTrip(dat))
+	dbPathways = nil
+
+	var dbLevels []Level
+	for _, level := range parser.GetLevels(zipReader) {
+		dbLevels = append(dbLevels, LevelToDbLevel(level, city))
 	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbLevels, limit)
 
-	return data
-}
+	dbLevels = nil
 
-func GetDepartures(db *gorm.DB, city string) []models.Departure {
-	var dbdata []Departure
-	var data []models.Departure
+	var dbTranslations []Translation
+	for _, translation := range parser.GetTranslations(zipReader) {
+		dbTranslations = append(dbTranslations, TranslationToDbTranslation(translation, city))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbTranslations, limit)
 
-	db.Table("departures").Where("city_id = ?", city).Find(&dbdata)
+	dbTranslations = nil
 
-	for _, dat := range dbdata {
-		data = append(data, DbDepartureToDeparture(dat))
+	dbFeedInfo := FeedInfoToDbFeedInfo(parser.GetFeedInfo(zipReader), city)
+	db.Clauses(clause.OnConflict{DoNothing: true}).Create(&dbFeedInfo)
+
+	// Clear interner cache between cities to prevent memory bloat
+	parser.ClearInterner()
+	clearTranslators(city)
+	clearTiles(city)
+	clearLocators(city)
+
+	for _, hook := range cityLoadedHooks {
+		hook(db, city)
 	}
 
-	return data
+	println("Successfully loaded GTFS data for city:", city)
 }
 
 func GetShapes(db *gorm.DB, city string) []models.Shape {
@@ -196,147 +265,26 @@ func GetShapeById(db *gorm.DB, city string, id string) []models.Shape {
 	return shapes
 }
 
-func GetDeparturesForStop(db *gorm.DB, city string, id string) []models.Departure {
-	var dbdeps []Departure
-	var deps []models.Departure
-
-	db.Table("departures").Where("city_id = ?", city).Where("stop_id = ?", id).Order("arrival_time").Limit(-1).Find(&dbdeps)
-
-	for _, dep := range dbdeps {
-		deps = append(deps, DbDepartureToDeparture(dep))
-	}
-
-	return deps
-}
-
 func GetActiveServicesForDate(db *gorm.DB, city string, date time.Time) map[string]bool {
 	activeServices := make(map[string]bool)
-	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
 
-	var calendars []models.Calendar
-	db.Table("calendars").
+	var serviceIDs []string
+	db.Model(&ServiceDate{}).
 		Where("city_id = ?", city).
-		Where("start_date <= ?", date).
-		Where("end_date >= ?", date).
-		Find(&calendars)
-
-	for _, cal := range calendars {
-		var runs bool
-		switch date.Weekday() {
-		case time.Monday:
-			runs = cal.Monday
-		case time.Tuesday:
-			runs = cal.Tuesday
-		case time.Wednesday:
-			runs = cal.Wednesday
-		case time.Thursday:
-			runs = cal.Thursday
-		case time.Friday:
-			runs = cal.Friday
-		case time.Saturday:
-			runs = cal.Saturday
-		case time.Sunday:
-			runs = cal.Sunday
-		}
-		if runs {
-			activeServices[cal.ServiceId] = true
-		}
-	}
+		Where("date = ?", serviceDate(date)).
+		Pluck("service_id", &serviceIDs)
 
-	var calendarDates []models.CalendarDate
-	db.Table("calendar_dates").
-		Where("city_id = ?", city).
-		Where("date = ?", date).
-		Find(&calendarDates)
-
-	for _, cd := range calendarDates {
-		switch cd.ExceptionType {
-		case models.SERVICE_ADDED:
-			activeServices[cd.ServiceId] = true
-		case models.SERVICE_REMOVED:
-			delete(activeServices, cd.ServiceId)
-		}
+	for _, id := range serviceIDs {
+		activeServices[id] = true
 	}
 
 	return activeServices
 }
 
-func GetDeparturesForStopToday(db *gorm.DB, city string, stop string) []models.Departure {
-	date := time.Now()
-
-	return GetDeparturesForStopOnDate(db, city, stop, date)
-}
-
-func GetDeparturesForStopOnDate(db *gorm.DB, city string, stop string, date time.Time) []models.Departure {
-	var (
-		dbDeps []Departure
-		deps   []models.Departure
-	)
-
-	services := GetActiveServicesForDate(db, city, date)
-	if len(services) == 0 {
-		return deps
-	}
-
-	// Extract service IDs from the map for use in SQL IN clause
-	serviceIDs := make([]string, 0, len(services))
-	for id := range services {
-		serviceIDs = append(serviceIDs, id)
-	}
-
-	// Filter by active services in the DB query, avoiding in-memory filtering
-	db.Model(&Departure{}).
-		Preload("Trip.Route").
-		Joins("JOIN trips ON trips.trip_id = departures.trip_id AND trips.city_id = departures.city_id").
-		Where("departures.city_id = ?", city).
-		Where("departures.stop_id = ?", stop).
-		Where("trips.service_id IN ?", serviceIDs).
-		Order("departures.departure_time").
-		Find(&dbDeps)
-
-	for _, dep := range dbDeps {
-		deps = append(deps, DbDepartureToDeparture(dep))
-	}
-
-	return deps
+func GetDeparturesForStopOnDate(db *gorm.DB, city string, stop string, date time.Time, limit int, filter models.DepartureFilter) []models.Departure {
+	return queryDepartures(db, city, stop, runningOn(date), filter, limit, departureBoard)
 }
 
-func GetNextDeparturesForStopOnDate(db *gorm.DB, city string, stop string, date time.Time, limit int) []models.Departure {
-	var (
-		dbDeps []Departure
-		deps   []models.Departure
-	)
-
-	services := GetActiveServicesForDate(db, city, date)
-	if len(services) == 0 {
-		return deps
-	}
-
-	// Get current time to filter departures
-	currentTime := time.Now()
-	currentTimeStr := currentTime.Format("15:04:05")
-
-	// Extract service IDs from the map for use in SQL IN clause
-	serviceIDs := make([]string, 0, len(services))
-	for id := range services {
-		serviceIDs = append(serviceIDs, id)
-	}
-
-	// Filter by active services and current time in the DB query, avoiding in-memory filtering
-	db.Model(&Departure{}).
-		Preload("Trip.Route").
-		Joins("JOIN trips ON trips.trip_id = departures.trip_id AND trips.city_id = departures.city_id").
-		Where("departures.city_id = ?", city).
-		Where("departures.stop_id = ?", stop).
-		Where("trips.service_id IN ?", serviceIDs).
-		Where("departures.departure_time >= ?", currentTimeStr).
-		Order("departures.departure_time").
-		Limit(limit).
-		Find(&dbDeps)
-
-	for _, dep := range dbDeps {
-		deps = append(deps, DbDepartureToDeparture(dep))
-	}
-
-	return deps
+func GetNextDeparturesForStopOnDate(db *gorm.DB, city string, stop string, date time.Time, limit int, filter models.DepartureFilter) []models.Departure {
+	return GetDeparturesForStopOnDate(db, city, stop, date, limit, filter.FromNow())
 }
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+)
+
+type boardKind int
+
+const (
+	departureBoard boardKind = iota
+	arrivalBoard
+)
+
+// Column a board is ordered and windowed by
+func (b boardKind) timeColumn() string {
+	if b == arrivalBoard {
+		return "departures.arrival_time"
+	}
+	return "departures.departure_time"
+}
+
+func (b boardKind) time(dep models.Departure) string {
+	if b == arrivalBoard {
+		return dep.ArrivalTime
+	}
+	return dep.DepartureTime
+}
+
+// Everything except the time window, which can't be applied in SQL to
+// frequency-based trips
+func applyFilter(q *gorm.DB, f models.DepartureFilter) *gorm.DB {
+	if len(f.Routes) > 0 {
+		q = q.Where("trips.route_id IN ?", f.Routes)
+	}
+	if len(f.RouteTypes) > 0 {
+		q = q.Joins("JOIN routes ON routes.route_id = trips.route_id AND routes.city_id = trips.city_id").
+			Where("routes.route_type IN ?", f.RouteTypes)
+	}
+	if f.Direction != nil {
+		q = q.Where("trips.direction_id = ?", *f.Direction)
+	}
+	if f.Headsign != "" {
+		q = q.Where("LOWER(COALESCE(departures.stop_headsign, trips.trip_headsign)) LIKE ?", "%"+strings.ToLower(f.Headsign)+"%")
+	}
+	if f.Wheelchair {
+		q = q.Where("trips.wheelchair_accessible = ?", models.ACCESSIBLE)
+	}
+	if f.Bikes {
+		q = q.Where("trips.bike_accessible = ?", models.ACCESSIBLE)
+	}
+
+	return q
+}
+
+// Trip has a later or earlier stop than the current row
+const hasLaterStop = "departures.stop_sequence < trips.last_stop_sequence"
+const hasEarlierStop = "EXISTS (SELECT 1 FROM departures d2 WHERE d2.city_id = departures.city_id AND d2.trip_id = departures.trip_id AND d2.stop_sequence < departures.stop_sequence)"
+
+func applyBoardable(q *gorm.DB, f models.DepartureFilter, board boardKind) *gorm.DB {
+	if board == arrivalBoard {
+		// Arrival boards never list a trip at its first stop
+		q = q.Where(hasEarlierStop)
+		if f.Boardable {
+			q = q.Where("departures.dropoff_type IS NULL OR departures.dropoff_type <> ?", models.DROPOFF_NOT_AVAILABLE)
+		}
+		return q
+	}
+
+	if f.Boardable {
+		q = q.Where("departures.pickup_type IS NULL OR departures.pickup_type <> ?", models.PICKUP_NOT_AVAILABLE).
+			Where(hasLaterStop)
+	}
+	return q
+}
+
+func applyTimeWindow(q *gorm.DB, f models.DepartureFilter, board boardKind) *gorm.DB {
+	if f.From != "" {
+		q = q.Where(board.timeColumn()+" >= ?", f.From)
+	}
+	if f.To != "" {
+		q = q.Where(board.timeColumn()+" <= ?", f.To)
+	}
+
+	return q
+}
+
+func inTimeWindow(f models.DepartureFilter, dep models.Departure, board boardKind) bool {
+	t := board.time(dep)
+	return (f.From == "" || t >= f.From) && (f.To == "" || t <= f.To)
+}
+
+// toBoardDeparture flags stop times nobody can board at: the last stop of a
+// trip and stops with no pickup. The trip must have been preloaded.
+func toBoardDeparture(dbDep Departure) models.Departure {
+	dep := DbDepartureToDeparture(dbDep)
+	last := dbDep.Trip.LastStopSequence
+	dep.ArrivalOnly = dep.PickupType == models.PICKUP_NOT_AVAILABLE || (last.Valid && dep.StopSequence == int(last.Int32))
+	return dep
+}
+
+// runningOn narrows a query joined with trips to the services running on a
+// date
+func runningOn(date time.Time) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		return joinServiceDate(q, date)
+	}
+}
+
+// queryDepartures returns the departures from a stop or station by the trips
+// services lets through, ordered by departure time, or arrival time on
+// arrival boards. A negative limit returns all of them.
+func queryDepartures(db *gorm.DB, city string, stop string, services func(*gorm.DB) *gorm.DB, filter models.DepartureFilter, limit int, board boardKind) []models.Departure {
+	var (
+		dbDeps []Departure
+		deps   []models.Departure
+	)
+
+	// A station stands for all of its platforms
+	stopIDs := resolveStopIDs(db, city, stop)
+
+	base := func() *gorm.DB {
+		q := db.Model(&Departure{}).
+			Preload("Trip.Route").
+			Preload("Stop").
+			Joins("JOIN trips ON trips.trip_id = departures.trip_id AND trips.city_id = departures.city_id")
+		q = services(q).
+			Where("departures.city_id = ?", city).
+			Where("departures.stop_id IN ?", stopIDs).
+			Where(board.timeColumn() + " <> ''")
+
+		return applyBoardable(applyFilter(q, filter), filter, board)
+	}
+
+	// Filter by active services and time in the DB query, avoiding in-memory filtering.
+	// Frequency-based trips are fetched separately, their template times say nothing about
+	// when the instances leave.
+	applyTimeWindow(base(), filter, board).
+		Where("departures.trip_id NOT IN (?)", frequencyTrips(db, city)).
+		Order(board.timeColumn()).
+		Limit(limit).
+		Find(&dbDeps)
+
+	for _, dep := range dbDeps {
+		deps = append(deps, toBoardDeparture(dep))
+	}
+
+	var dbFreqDeps []Departure
+	base().
+		Where("departures.trip_id IN (?)", frequencyTrips(db, city)).
+		Find(&dbFreqDeps)
+
+	if len(dbFreqDeps) == 0 {
+		return deps
+	}
+
+	var freqDeps []models.Departure
+	for _, dep := range dbFreqDeps {
+		freqDeps = append(freqDeps, toBoardDeparture(dep))
+	}
+
+	for _, dep := range expandFrequencies(db, city, freqDeps) {
+		if inTimeWindow(filter, dep, board) {
+			deps = append(deps, dep)
+		}
+	}
+
+	if board == arrivalBoard {
+		sortArrivals(deps)
+	} else {
+		sortDepartures(deps)
+	}
+	if limit >= 0 && len(deps) > limit {
+		deps = deps[:limit]
+	}
+
+	return deps
+}
+
+func GetArrivalsForStopOnDate(db *gorm.DB, city string, stop string, date time.Time, limit int, filter models.DepartureFilter) []models.Departure {
+	return queryDepartures(db, city, stop, runningOn(date), filter, limit, arrivalBoard)
+}
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	benchCity     = "bench"
+	benchServices = 3000
+	benchStops    = 100
+	// Every trip passes the hub, the stop the benchmarks query
+	benchHub = "HUB"
+	// A page of a departure board
+	benchLimit = 50
+)
+
+var (
+	benchDB   *gorm.DB
+	benchOnce sync.Once
+	benchDate = time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)
+)
+
+// Generates a feed with benchServices services running on varying weekdays
+// over two months, a third of them with calendar_dates exceptions, and four
+// trips per service
+func benchFeed() *gorm.DB {
+	benchOnce.Do(func() {
+		db, err := gorm.Open(sqlite.Open("file:bench?mode=memory&cache=shared"), &gorm.Config{
+			SkipDefaultTransaction: true,
+			Logger:                 logger.Default.LogMode(logger.Error),
+		})
+		if err != nil {
+			panic(err)
+		}
+		db.AutoMigrate(&Stop{}, &Route{}, &Trip{}, &Departure{}, &Calendar{}, &CalendarDate{}, &ServiceDate{}, &Frequency{})
+
+		rng := rand.New(rand.NewSource(1))
+
+		stops := []Stop{StopToDbStop(models.Stop{StopId: benchHub, StopName: "Hub", StopLat: 52.23, StopLon: 21.01}, benchCity)}
+		for i := range benchStops {
+			stops = append(stops, StopToDbStop(models.Stop{
+				StopId:  fmt.Sprintf("S%d", i),
+				StopLat: 52.2 + rng.Float64()/10,
+				StopLon: 21.0 + rng.Float64()/10,
+			}, benchCity))
+		}
+		db.CreateInBatches(stops, 1000)
+
+		db.Create(&[]Route{RouteToDbRoute(models.Route{RouteId: "R", RouteType: models.BUS}, benchCity)})
+
+		start := benchDate.AddDate(0, -1, 0)
+		end := benchDate.AddDate(0, 1, 0)
+
+		var (
+			calendars     []Calendar
+			calendarDates []CalendarDate
+			trips         []Trip
+			deps          []Departure
+		)
+		for s := range benchServices {
+			service := fmt.Sprintf("SV%d", s)
+			days := rng.Intn(127) + 1
+			calendars = append(calendars, CalendarToDbCalendar(models.Calendar{
+				ServiceId: service,
+				Monday:    days&1 != 0,
+				Tuesday:   days&2 != 0,
+				Wednesday: days&4 != 0,
+				Thursday:  days&8 != 0,
+				Friday:    days&16 != 0,
+				Saturday:  days&32 != 0,
+				Sunday:    days&64 != 0,
+				StartDate: start,
+				EndDate:   end,
+			}, benchCity))
+
+			if s%3 == 0 {
+				for range 5 {
+					calendarDates = append(calendarDates, CalendarDateToDbCalendarDate(models.CalendarDate{
+						ServiceId:     service,
+						Date:          benchDate.AddDate(0, 0, rng.Intn(14)-7),
+						ExceptionType: models.ExceptionType(rng.Intn(2) + 1),
+					}, benchCity))
+				}
+			}
+
+			for t := range 4 {
+				trip := fmt.Sprintf("%s-T%d", service, t)
+				trips = append(trips, TripToDbTrip(models.Trip{TripId: trip, RouteId: "R", ServiceId: service}, benchCity))
+
+				secs := 5*3600 + rng.Intn(18*3600)
+				route := []string{benchHub}
+				for _, i := range rng.Perm(benchStops)[:7] {
+					route = append(route, fmt.Sprintf("S%d", i))
+				}
+				for seq, stop := range route {
+					at := utils.FormatGTFSTime(secs + seq*120)
+					deps = append(deps, DepartureToDbDeparture(models.Departure{
+						TripId:        trip,
+						StopId:        stop,
+						StopSequence:  seq + 1,
+						ArrivalTime:   at,
+						DepartureTime: at,
+					}, benchCity))
+				}
+			}
+		}
+
+		db.CreateInBatches(calendars, 1000)
+		// Repeated draws of a date hit the unique index
+		db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(calendarDates, 1000)
+		db.CreateInBatches(trips, 1000)
+		db.CreateInBatches(deps, 1000)
+
+		spans := make(map[string]tripSpan)
+		for _, dep := range deps {
+			addTripSpan(spans, DbDepartureToDeparture(dep))
+		}
+		storeTripSpans(db, benchCity, spans)
+		materializeServiceDates(db, benchCity, 1000)
+
+		benchDB = db
+	})
+
+	return benchDB
+}
+
+// Active services the way they were found before service_dates existed:
+// calendars covering the date, then the calendar_dates exceptions
+func activeServicesFromCalendars(db *gorm.DB, city string, date time.Time) []string {
+	active := make(map[string]bool)
+
+	var calendars []Calendar
+	db.Table("calendars").
+		Where("city_id = ?", city).
+		Where("start_date <= ?", date).
+		Where("end_date >= ?", date).
+		Find(&calendars)
+
+	for _, dbCal := range calendars {
+		cal := DbCalendarToCalendar(dbCal)
+		runs := map[time.Weekday]bool{
+			time.Monday:    cal.Monday,
+			time.Tuesday:   cal.Tuesday,
+			time.Wednesday: cal.Wednesday,
+			time.Thursday:  cal.Thursday,
+			time.Friday:    cal.Friday,
+			time.Saturday:  cal.Saturday,
+			time.Sunday:    cal.Sunday,
+		}[date.Weekday()]
+		if runs {
+			active[cal.ServiceId] = true
+		}
+	}
+
+	var calendarDates []CalendarDate
+	db.Table("calendar_dates").
+		Where("city_id = ?", city).
+		Where("date = ?", date).
+		Find(&calendarDates)
+
+	for _, dbDate := range calendarDates {
+		cd := DbCalendarDateToCalendarDate(dbDate)
+		switch cd.ExceptionType {
+		case models.SERVICE_ADDED:
+			active[cd.ServiceId] = true
+		case models.SERVICE_REMOVED:
+			delete(active, cd.ServiceId)
+		}
+	}
+
+	ids := make([]string, 0, len(active))
+	for id := range active {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// The board before service_dates: an IN list of every service running that
+// day, found from the calendars on each request
+func boardByServiceList(db *gorm.DB, limit int) []models.Departure {
+	serviceIDs := activeServicesFromCalendars(db, benchCity, benchDate)
+	services := func(q *gorm.DB) *gorm.DB {
+		return q.Where("trips.service_id IN ?", serviceIDs)
+	}
+	return queryDepartures(db, benchCity, benchHub, services, models.DepartureFilter{}, limit, departureBoard)
+}
+
+func boardByServiceDate(db *gorm.DB, limit int) []models.Departure {
+	return GetDeparturesForStopOnDate(db, benchCity, benchHub, benchDate, limit, models.DepartureFilter{})
+}
+
+// Departures sharing a time may come in either order
+func boardKeys(deps []models.Departure) []string {
+	keys := make([]string, 0, len(deps))
+	for _, dep := range deps {
+		keys = append(keys, dep.DepartureTime+" "+dep.TripId)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestDeparturesServiceDatesMatchServiceList(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates a large feed")
+	}
+	db := benchFeed()
+
+	byList := boardKeys(boardByServiceList(db, -1))
+	byDate := boardKeys(boardByServiceDate(db, -1))
+	if len(byList) == 0 {
+		t.Fatal("no departures on the benchmark date")
+	}
+	if !slices.Equal(byList, byDate) {
+		t.Fatalf("IN list found %d departures, service_dates %d, and they differ", len(byList), len(byDate))
+	}
+}
+
+// Both benchmarks time the whole departure board a request gets, frequencies
+// and arrival-only marking included, and differ only in how the services
+// running that day are found
+
+func BenchmarkDeparturesServiceList(b *testing.B) {
+	db := benchFeed()
+	for b.Loop() {
+		boardByServiceList(db, benchLimit)
+	}
+}
+
+func BenchmarkDeparturesServiceDates(b *testing.B) {
+	db := benchFeed()
+	for b.Loop() {
+		boardByServiceDate(db, benchLimit)
+	}
+}
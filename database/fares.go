@@ -0,0 +1,198 @@
+package database
+
+import (
+	"archive/zip"
+	"slices"
+
+	"git.marceeli.ovh/vectura/vectura-api/fares"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/parser"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func GetFareAttributes(db *gorm.DB, city string) []models.FareAttribute {
+	var dbdata []FareAttribute
+	var data []models.FareAttribute
+
+	db.Table("fare_attributes").Where("city_id = ?", city).Find(&dbdata)
+
+	for _, dat := range dbdata {
+		data = append(data, DbFareAttributeToFareAttribute(dat))
+	}
+
+	return data
+}
+
+func GetFareRules(db *gorm.DB, city string) []models.FareRule {
+	var dbdata []FareRule
+	var data []models.FareRule
+
+	db.Table("fare_rules").Where("city_id = ?", city).Find(&dbdata)
+
+	for _, dat := range dbdata {
+		data = append(data, DbFareRuleToFareRule(dat))
+	}
+
+	return data
+}
+
+func getStopZone(db *gorm.DB, city string, stop string) string {
+	var dbStop Stop
+	db.Table("stops").Where("city_id = ?", city).Where("stop_id = ?", stop).Limit(1).Find(&dbStop)
+
+	return nullStringToString(dbStop.ZoneId)
+}
+
+// GetFares returns the fares applicable to a ride from one stop to another,
+// cheapest first. Any of from, to and route may be empty, in which case
+// the rules are not narrowed down by it.
+func GetFares(db *gorm.DB, city string, from string, to string, route string) []models.FareAttribute {
+	ride := fares.Ride{FromStop: from, ToStop: to, RouteId: route}
+	if from != "" {
+		ride.FromZone = getStopZone(db, city, from)
+	}
+	if to != "" {
+		ride.ToZone = getStopZone(db, city, to)
+	}
+
+	return fares.MatchAttributes(GetFareAttributes(db, city), GetFareRules(db, city), ride)
+}
+
+// GetFareData loads the Fares v2 rules of a city, with stop areas and route
+// networks limited to the given stops and routes. A stop also belongs to
+// the areas of its parent station.
+func GetFareData(db *gorm.DB, city string, stopIDs []string, routeIDs []string) fares.Data {
+	data := getFareRulesV2(db, city)
+	data.StopAreas = make(map[string][]string)
+	data.RouteNetworks = make(map[string][]string)
+
+	var dbStops []Stop
+	db.Table("stops").Where("city_id = ?", city).Where("stop_id IN ?", stopIDs).Find(&dbStops)
+
+	parents := make(map[string][]string)
+	lookup := slices.Clone(stopIDs)
+	for _, stop := range dbStops {
+		if parent := nullStringToString(stop.ParentStation); parent != "" {
+			parents[parent] = append(parents[parent], stop.StopId)
+			lookup = append(lookup, parent)
+		}
+	}
+
+	var dbStopAreas []StopArea
+	db.Model(&StopArea{}).Where("city_id = ?", city).Where("stop_id IN ?", lookup).Order("id").Find(&dbStopAreas)
+	for _, dat := range dbStopAreas {
+		// Parents are only looked up for their platforms
+		if slices.Contains(stopIDs, dat.StopId) {
+			data.StopAreas[dat.StopId] = append(data.StopAreas[dat.StopId], dat.AreaId)
+		}
+		for _, child := range parents[dat.StopId] {
+			data.StopAreas[child] = append(data.StopAreas[child], dat.AreaId)
+		}
+	}
+
+	var dbRouteNetworks []RouteNetwork
+	db.Model(&RouteNetwork{}).Where("city_id = ?", city).Where("route_id IN ?", routeIDs).Order("id").Find(&dbRouteNetworks)
+	for _, dat := range dbRouteNetworks {
+		data.RouteNetworks[dat.RouteId] = append(data.RouteNetworks[dat.RouteId], dat.NetworkId)
+	}
+
+	// Feeds may also assign networks directly in routes.txt
+	var dbRoutes []Route
+	db.Table("routes").Where("city_id = ?", city).Where("route_id IN ?", routeIDs).Find(&dbRoutes)
+	for _, route := range dbRoutes {
+		if network := nullStringToString(route.NetworkId); network != "" {
+			data.RouteNetworks[route.RouteId] = append(data.RouteNetworks[route.RouteId], network)
+		}
+	}
+
+	return data
+}
+
+// Products, leg and transfer rules and timeframes of a city
+func getFareRulesV2(db *gorm.DB, city string) fares.Data {
+	var data fares.Data
+
+	var dbProducts []FareProduct
+	db.Model(&FareProduct{}).Where("city_id = ?", city).Order("id").Find(&dbProducts)
+	for _, dat := range dbProducts {
+		data.Products = append(data.Products, DbFareProductToFareProduct(dat))
+	}
+
+	var dbLegRules []FareLegRule
+	db.Model(&FareLegRule{}).Where("city_id = ?", city).Order("id").Find(&dbLegRules)
+	for _, dat := range dbLegRules {
+		data.LegRules = append(data.LegRules, DbFareLegRuleToFareLegRule(dat))
+	}
+
+	var dbTransferRules []FareTransferRule
+	db.Model(&FareTransferRule{}).Where("city_id = ?", city).Order("id").Find(&dbTransferRules)
+	for _, dat := range dbTransferRules {
+		data.TransferRules = append(data.TransferRules, DbFareTransferRuleToFareTransferRule(dat))
+	}
+
+	var dbTimeframes []Timeframe
+	db.Model(&Timeframe{}).Where("city_id = ?", city).Order("id").Find(&dbTimeframes)
+	for _, dat := range dbTimeframes {
+		data.Timeframes = append(data.Timeframes, DbTimeframeToTimeframe(dat))
+	}
+
+	return data
+}
+
+// Fares v2 files, all of them are optional
+func preloadFaresV2(db *gorm.DB, zipReader *zip.ReadCloser, cityID string, limit int) {
+	var dbFareProducts []FareProduct
+	for _, product := range parser.GetFareProducts(zipReader) {
+		dbFareProducts = append(dbFareProducts, FareProductToDbFareProduct(product, cityID))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbFareProducts, limit)
+
+	var dbFareMedia []FareMedia
+	for _, media := range parser.GetFareMedia(zipReader) {
+		dbFareMedia = append(dbFareMedia, FareMediaToDbFareMedia(media, cityID))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbFareMedia, limit)
+
+	var dbFareLegRules []FareLegRule
+	for _, rule := range parser.GetFareLegRules(zipReader) {
+		dbFareLegRules = append(dbFareLegRules, FareLegRuleToDbFareLegRule(rule, cityID))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbFareLegRules, limit)
+
+	var dbFareTransferRules []FareTransferRule
+	for _, rule := range parser.GetFareTransferRules(zipReader) {
+		dbFareTransferRules = append(dbFareTransferRules, FareTransferRuleToDbFareTransferRule(rule, cityID))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbFareTransferRules, limit)
+
+	var dbAreas []Area
+	for _, area := range parser.GetAreas(zipReader) {
+		dbAreas = append(dbAreas, AreaToDbArea(area, cityID))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbAreas, limit)
+
+	var dbStopAreas []StopArea
+	for _, stopArea := range parser.GetStopAreas(zipReader) {
+		dbStopAreas = append(dbStopAreas, StopAreaToDbStopArea(stopArea, cityID))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbStopAreas, limit)
+
+	var dbNetworks []Network
+	for _, network := range parser.GetNetworks(zipReader) {
+		dbNetworks = append(dbNetworks, NetworkToDbNetwork(network, cityID))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbNetworks, limit)
+
+	var dbRouteNetworks []RouteNetwork
+	for _, routeNetwork := range parser.GetRouteNetworks(zipReader) {
+		dbRouteNetworks = append(dbRouteNetworks, RouteNetworkToDbRouteNetwork(routeNetwork, cityID))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbRouteNetworks, limit)
+
+	var dbTimeframes []Timeframe
+	for _, timeframe := range parser.GetTimeframes(zipReader) {
+		dbTimeframes = append(dbTimeframes, TimeframeToDbTimeframe(timeframe, cityID))
+	}
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbTimeframes, limit)
+}
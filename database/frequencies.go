@@ -0,0 +1,129 @@
+package database
+
+import (
+	"sort"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+	"gorm.io/gorm"
+)
+
+func GetFrequencies(db *gorm.DB, city string) []models.Frequency {
+	var dbdata []Frequency
+	var data []models.Frequency
+
+	db.Table("frequencies").Where("city_id = ?", city).Order("trip_id, start_time").Find(&dbdata)
+
+	for _, dat := range dbdata {
+		data = append(data, DbFrequencyToFrequency(dat))
+	}
+
+	return data
+}
+
+func GetFrequenciesForTrips(db *gorm.DB, city string, tripIDs []string) map[string][]models.Frequency {
+	freqs := make(map[string][]models.Frequency)
+	if len(tripIDs) == 0 {
+		return freqs
+	}
+
+	var dbdata []Frequency
+	db.Table("frequencies").
+		Where("city_id = ?", city).
+		Where("trip_id IN ?", tripIDs).
+		Order("start_time").
+		Find(&dbdata)
+
+	for _, dat := range dbdata {
+		freqs[dat.TripId] = append(freqs[dat.TripId], DbFrequencyToFrequency(dat))
+	}
+
+	return freqs
+}
+
+// Subquery selecting the IDs of all headway-based trips in a city
+func frequencyTrips(db *gorm.DB, city string) *gorm.DB {
+	return db.Model(&Frequency{}).Select("trip_id").Where("city_id = ?", city)
+}
+
+// Departure time of the first stop of each trip, which is what frequencies.txt
+// start times refer to
+func getTripStartTimes(db *gorm.DB, city string, tripIDs []string) map[string]int {
+	starts := make(map[string]int)
+
+	var rows []struct {
+		TripId    string
+		StartSecs int
+	}
+	db.Model(&Trip{}).
+		Select("trip_id, start_secs").
+		Where("city_id = ?", city).
+		Where("trip_id IN ?", tripIDs).
+		Where("start_secs IS NOT NULL").
+		Scan(&rows)
+
+	for _, row := range rows {
+		starts[row.TripId] = row.StartSecs
+	}
+
+	return starts
+}
+
+// Replaces the template stop time of every headway-based trip with one
+// departure per headway instance. Other departures are passed through as is.
+func expandFrequencies(db *gorm.DB, city string, deps []models.Departure) []models.Departure {
+	if len(deps) == 0 {
+		return deps
+	}
+
+	tripIDs := make([]string, 0, len(deps))
+	seen := make(map[string]bool)
+	for _, dep := range deps {
+		if !seen[dep.TripId] {
+			seen[dep.TripId] = true
+			tripIDs = append(tripIDs, dep.TripId)
+		}
+	}
+
+	freqs := GetFrequenciesForTrips(db, city, tripIDs)
+	if len(freqs) == 0 {
+		return deps
+	}
+
+	freqTripIDs := make([]string, 0, len(freqs))
+	for id := range freqs {
+		freqTripIDs = append(freqTripIDs, id)
+	}
+	starts := getTripStartTimes(db, city, freqTripIDs)
+
+	expanded := make([]models.Departure, 0, len(deps))
+	for _, dep := range deps {
+		tripFreqs, ok := freqs[dep.TripId]
+		if !ok {
+			expanded = append(expanded, dep)
+			continue
+		}
+
+		expanded = append(expanded, models.ExpandFrequencyDeparture(dep, tripFreqs, starts[dep.TripId])...)
+	}
+
+	sortDepartures(expanded)
+
+	return expanded
+}
+
+func sortDepartures(deps []models.Departure) {
+	sort.SliceStable(deps, func(i, j int) bool {
+		a, _ := utils.ParseGTFSTime(deps[i].DepartureTime)
+		b, _ := utils.ParseGTFSTime(deps[j].DepartureTime)
+		return a < b
+	})
+}
+
+func sortArrivals(deps []models.Departure) {
+	sort.SliceStable(deps, func(i, j int) bool {
+		a, _ := utils.ParseGTFSTime(deps[i].ArrivalTime)
+		b, _ := utils.ParseGTFSTime(deps[j].ArrivalTime)
+		return a < b
+	})
+}
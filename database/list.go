@@ -0,0 +1,138 @@
+package database
+
+import (
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+)
+
+// sortExpr is the SQL a sort field orders by. NULLs are coalesced so keyset
+// comparisons work, text is compared byte by byte as Postgres would
+// otherwise follow the collation of the database.
+func sortExpr[M any](db *gorm.DB, f models.SortField[M]) string {
+	expr := f.Column
+	if f.Nullable {
+		zero := "0"
+		if f.Text {
+			zero = "''"
+		}
+		expr = "COALESCE(" + expr + ", " + zero + ")"
+	}
+	if f.Text && db.Dialector.Name() == "postgres" {
+		expr += ` COLLATE "C"`
+	}
+	return expr
+}
+
+// Rows a list reads at a time. Each batch is read in full and the
+// connection handed back before fn sees it, so a slow client doesn't hold on
+// to a pooled connection.
+var listBatchSize = 1000
+
+// streamList runs a keyset-paginated query over one of the per-city tables
+// and hands the rows to fn one at a time, without loading the whole table.
+// It returns the cursor of the next page, empty on the last one.
+func streamList[T any, M any](db *gorm.DB, table string, city string, q models.ListQuery, fields map[string]models.SortField[M], id func(T) uint, conv func(T) M, fn func(M) error) (string, error) {
+	var (
+		field models.SortField[M]
+		expr  string
+	)
+	if q.Sort != "" {
+		var ok bool
+		if field, ok = fields[q.Sort]; !ok {
+			return "", models.ErrInvalidSort
+		}
+		expr = sortExpr(db, field)
+	}
+
+	dir, cmp := " ASC", ">"
+	if q.Desc {
+		dir, cmp = " DESC", "<"
+	}
+
+	var after *models.ListCursor
+	if q.Cursor != "" {
+		cursor, err := models.DecodeCursor(q.Cursor)
+		if err != nil || cursor.Sort != q.Sort || cursor.Desc != q.Desc {
+			return "", models.ErrInvalidCursor
+		}
+		after = &cursor
+	}
+
+	// The rows after a position in the list
+	batch := func(after *models.ListCursor, limit int) ([]T, error) {
+		query := db.Table(table).Where("city_id = ?", city)
+
+		if after != nil {
+			if q.Sort == "" {
+				query = query.Where("id "+cmp+" ?", after.ID)
+			} else {
+				query = query.Where("("+expr+" "+cmp+" ?) OR ("+expr+" = ? AND id "+cmp+" ?)", after.Value, after.Value, after.ID)
+			}
+		}
+
+		if q.Sort != "" {
+			query = query.Order(expr + dir)
+		}
+		query = query.Order("id" + dir)
+
+		var rows []T
+		err := query.Limit(limit).Find(&rows).Error
+		return rows, err
+	}
+
+	var (
+		count    int
+		lastID   uint
+		lastItem M
+	)
+	for {
+		size := listBatchSize
+		if q.Limit > 0 {
+			// One extra row tells whether there is a next page
+			size = min(size, q.Limit-count+1)
+		}
+
+		rows, err := batch(after, size)
+		if err != nil {
+			return "", err
+		}
+
+		for _, row := range rows {
+			if q.Limit > 0 && count == q.Limit {
+				next := models.ListCursor{Sort: q.Sort, Desc: q.Desc, ID: lastID}
+				if q.Sort != "" {
+					next.Value = field.Value(lastItem)
+				}
+				return models.EncodeCursor(next), nil
+			}
+
+			item := conv(row)
+			if err := fn(item); err != nil {
+				return "", err
+			}
+			lastID, lastItem = id(row), item
+			count++
+		}
+
+		if len(rows) < size {
+			return "", nil
+		}
+
+		after = &models.ListCursor{ID: lastID}
+		if q.Sort != "" {
+			after.Value = field.Value(lastItem)
+		}
+	}
+}
+
+func GetStops(db *gorm.DB, city string, q models.ListQuery, fn func(models.Stop) error) (string, error) {
+	return streamList(db, "stops", city, q, models.StopSortFields, func(s Stop) uint { return s.ID }, DbStopToStop, fn)
+}
+
+func GetRoutes(db *gorm.DB, city string, q models.ListQuery, fn func(models.Route) error) (string, error) {
+	return streamList(db, "routes", city, q, models.RouteSortFields, func(r Route) uint { return r.ID }, DbRouteToRoute, fn)
+}
+
+func GetTrips(db *gorm.DB, city string, q models.ListQuery, fn func(models.Trip) error) (string, error) {
+	return streamList(db, "trips", city, q, models.TripSortFields, func(t Trip) uint { return t.ID }, DbTripToTrip, fn)
+}
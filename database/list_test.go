@@ -0,0 +1,107 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const listTestCity = "list-test"
+
+func openListDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:list?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Error),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Migrator().DropTable(&Stop{})
+	db.AutoMigrate(&Stop{})
+
+	// Names repeat so sorting by them needs the id to break ties
+	var stops []Stop
+	for i, name := range []string{"Centrum", "Arkadia", "Centrum", "", "Bemowo", "Arkadia", "Centrum"} {
+		stops = append(stops, StopToDbStop(models.Stop{StopId: fmt.Sprintf("S%d", i), StopName: name}, listTestCity))
+	}
+	db.Create(&stops)
+
+	return db
+}
+
+// Every page of a listing, following its cursors
+func listAll(t *testing.T, db *gorm.DB, q models.ListQuery) [][]string {
+	t.Helper()
+
+	var pages [][]string
+	for {
+		var page []string
+		next, err := GetStops(db, listTestCity, q, func(s models.Stop) error {
+			page = append(page, s.StopId)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+
+		if next == "" {
+			return pages
+		}
+		q.Cursor = next
+	}
+}
+
+func TestListBatches(t *testing.T) {
+	db := openListDB(t)
+
+	batchSize := listBatchSize
+	t.Cleanup(func() { listBatchSize = batchSize })
+
+	for _, sort := range []string{"", "stop_name"} {
+		for _, desc := range []bool{false, true} {
+			for _, limit := range []int{0, 1, 2, 3, 7, 8} {
+				q := models.ListQuery{Sort: sort, Desc: desc, Limit: limit}
+
+				listBatchSize = batchSize
+				want := listAll(t, db, q)
+
+				// Batches ending before, on and after the page boundaries
+				for _, size := range []int{1, 2, 3} {
+					listBatchSize = size
+					if got := listAll(t, db, q); !slices.EqualFunc(got, want, slices.Equal) {
+						t.Errorf("%+v in batches of %d: got %v, expected %v", q, size, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestListReleasesConnection(t *testing.T) {
+	db := openListDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batchSize := listBatchSize
+	t.Cleanup(func() { listBatchSize = batchSize })
+	listBatchSize = 2
+
+	calls := 0
+	GetStops(db, listTestCity, models.ListQuery{}, func(models.Stop) error {
+		calls++
+		if inUse := sqlDB.Stats().InUse; inUse != 0 {
+			t.Errorf("%d connections in use while handing out a row", inUse)
+		}
+		return nil
+	})
+	if calls != 7 {
+		t.Errorf("expected 7 stops, got %d", calls)
+	}
+}
@@ -20,6 +20,7 @@ type Route struct {
 	RouteUrl         sql.NullString
 	RouteColor       sql.NullString
 	RouteTextColor   sql.NullString
+	NetworkId        sql.NullString `gorm:"index"`
 }
 
 type Stop struct {
@@ -36,6 +37,7 @@ type Stop struct {
 	PlatformCode       sql.NullString
 	WheelchairBoarding sql.NullInt16
 	LocationType       sql.NullInt16
+	LevelId            sql.NullString
 }
 
 type Trip struct {
@@ -52,20 +54,32 @@ type Trip struct {
 	ShapeId              sql.NullString `gorm:"index"`
 	WheelchairAccessible sql.NullInt16
 	BikeAccessible       sql.NullInt16
+	// Seconds of the first departure and the last arrival, and the last
+	// stop_sequence, set on import
+	StartSecs        sql.NullInt32 `gorm:"index"`
+	EndSecs          sql.NullInt32
+	LastStopSequence sql.NullInt32
 }
 
 type Departure struct {
 	gorm.Model
-	CityId        string
-	TripId        string `gorm:"index:idx_trip"`
-	Trip          Trip   `gorm:"foreignKey:TripId,CityId;references:TripId,CityId"`
-	StopId        string `gorm:"index:idx_stop;index:idx_stop_departure"`
-	Stop          Stop   `gorm:"foreignKey:StopId,CityId;references:StopId,CityId"`
-	ArrivalTime   string `gorm:"index:idx_arrival"`
-	DepartureTime string `gorm:"index:idx_stop_departure;index:idx_departure_time"`
-	StopSequence  int    `gorm:"index"`
-	PickupType    sql.NullInt16
-	DropoffType   sql.NullInt16
+	CityId            string
+	TripId            string `gorm:"index:idx_trip"`
+	Trip              Trip   `gorm:"foreignKey:TripId,CityId;references:TripId,CityId"`
+	StopId            string `gorm:"index:idx_stop;index:idx_stop_departure"`
+	Stop              Stop   `gorm:"foreignKey:StopId,CityId;references:StopId,CityId"`
+	ArrivalTime       string `gorm:"index:idx_arrival"`
+	DepartureTime     string `gorm:"index:idx_stop_departure;index:idx_departure_time"`
+	StopSequence      int    `gorm:"index"`
+	PickupType        sql.NullInt16
+	DropoffType       sql.NullInt16
+	StopHeadsign      sql.NullString
+	Timepoint         sql.NullInt16
+	ShapeDistTraveled sql.NullFloat64
+	ShapeDistance     sql.NullFloat64
+	ContinuousPickup  sql.NullInt16
+	ContinuousDropOff sql.NullInt16
+	Interpolated      bool
 }
 
 type Calendar struct {
@@ -91,6 +105,15 @@ type CalendarDate struct {
 	ExceptionType int
 }
 
+// ServiceDate is one day a service runs on, calendar and calendar_dates
+// expanded at import so date lookups are a plain join
+type ServiceDate struct {
+	gorm.Model
+	CityId    string `gorm:"uniqueIndex:idx_city_date_service"`
+	Date      string `gorm:"uniqueIndex:idx_city_date_service"`
+	ServiceId string `gorm:"uniqueIndex:idx_city_date_service;index"`
+}
+
 type Shape struct {
 	gorm.Model
 	CityId          string
@@ -100,6 +123,182 @@ type Shape struct {
 	ShapePtSequence int `gorm:"uniqueIndex:idx_shape_sequence"`
 }
 
+type ShapeInfo struct {
+	gorm.Model
+	CityId     string `gorm:"uniqueIndex:idx_city_shape_info"`
+	ShapeId    string `gorm:"uniqueIndex:idx_city_shape_info"`
+	MinLat     float64
+	MinLon     float64
+	MaxLat     float64
+	MaxLon     float64
+	Length     float64
+	PointCount int
+	Synthetic  bool
+}
+
+type Frequency struct {
+	gorm.Model
+	CityId      string `gorm:"uniqueIndex:idx_city_trip_start"`
+	TripId      string `gorm:"index:idx_frequency_trip;uniqueIndex:idx_city_trip_start"`
+	StartTime   string `gorm:"uniqueIndex:idx_city_trip_start"`
+	EndTime     string
+	HeadwaySecs int
+	ExactTimes  bool
+}
+
+type FareAttribute struct {
+	gorm.Model
+	CityId           string `gorm:"uniqueIndex:idx_city_fare"`
+	FareId           string `gorm:"uniqueIndex:idx_city_fare"`
+	Price            float64
+	CurrencyType     string
+	PaymentMethod    int16
+	Transfers        int
+	AgencyId         sql.NullString
+	TransferDuration sql.NullInt32
+}
+
+type FareRule struct {
+	gorm.Model
+	CityId        string `gorm:"index:idx_city_fare_rule"`
+	FareId        string `gorm:"index:idx_city_fare_rule"`
+	RouteId       sql.NullString
+	OriginId      sql.NullString
+	DestinationId sql.NullString
+	ContainsId    sql.NullString
+}
+
+type FareProduct struct {
+	gorm.Model
+	CityId          string `gorm:"index:idx_city_fare_product"`
+	FareProductId   string `gorm:"index:idx_city_fare_product"`
+	FareProductName sql.NullString
+	FareMediaId     sql.NullString
+	Amount          float64
+	Currency        string
+}
+
+type FareMedia struct {
+	gorm.Model
+	CityId        string `gorm:"uniqueIndex:idx_city_fare_media"`
+	FareMediaId   string `gorm:"uniqueIndex:idx_city_fare_media"`
+	FareMediaName sql.NullString
+	FareMediaType int16
+}
+
+type FareLegRule struct {
+	gorm.Model
+	CityId               string `gorm:"index"`
+	LegGroupId           sql.NullString
+	NetworkId            sql.NullString
+	FromAreaId           sql.NullString
+	ToAreaId             sql.NullString
+	FromTimeframeGroupId sql.NullString
+	ToTimeframeGroupId   sql.NullString
+	FareProductId        string
+	RulePriority         sql.NullInt32
+}
+
+type FareTransferRule struct {
+	gorm.Model
+	CityId            string `gorm:"index"`
+	FromLegGroupId    sql.NullString
+	ToLegGroupId      sql.NullString
+	TransferCount     int
+	DurationLimit     sql.NullInt32
+	DurationLimitType int16
+	FareTransferType  int16
+	FareProductId     sql.NullString
+}
+
+type Area struct {
+	gorm.Model
+	CityId   string `gorm:"uniqueIndex:idx_city_area"`
+	AreaId   string `gorm:"uniqueIndex:idx_city_area"`
+	AreaName sql.NullString
+}
+
+type StopArea struct {
+	gorm.Model
+	CityId string `gorm:"index:idx_city_stop_area"`
+	AreaId string
+	StopId string `gorm:"index:idx_city_stop_area"`
+}
+
+type Network struct {
+	gorm.Model
+	CityId      string `gorm:"uniqueIndex:idx_city_network"`
+	NetworkId   string `gorm:"uniqueIndex:idx_city_network"`
+	NetworkName sql.NullString
+}
+
+type RouteNetwork struct {
+	gorm.Model
+	CityId    string `gorm:"index:idx_city_route_network"`
+	NetworkId string
+	RouteId   string `gorm:"index:idx_city_route_network"`
+}
+
+type Timeframe struct {
+	gorm.Model
+	CityId           string `gorm:"index:idx_city_timeframe"`
+	TimeframeGroupId string `gorm:"index:idx_city_timeframe"`
+	StartTime        sql.NullString
+	EndTime          sql.NullString
+	ServiceId        string
+}
+
+type Pathway struct {
+	gorm.Model
+	CityId               string `gorm:"uniqueIndex:idx_city_pathway;index:idx_city_pathway_from;index:idx_city_pathway_to"`
+	PathwayId            string `gorm:"uniqueIndex:idx_city_pathway"`
+	FromStopId           string `gorm:"index:idx_city_pathway_from"`
+	ToStopId             string `gorm:"index:idx_city_pathway_to"`
+	PathwayMode          int16
+	IsBidirectional      bool
+	Length               sql.NullFloat64
+	TraversalTime        sql.NullInt32
+	StairCount           sql.NullInt32
+	MaxSlope             sql.NullFloat64
+	MinWidth             sql.NullFloat64
+	SignpostedAs         sql.NullString
+	ReversedSignpostedAs sql.NullString
+}
+
+type Level struct {
+	gorm.Model
+	CityId     string `gorm:"uniqueIndex:idx_city_level"`
+	LevelId    string `gorm:"uniqueIndex:idx_city_level"`
+	LevelIndex float64
+	LevelName  sql.NullString
+}
+
+type Translation struct {
+	gorm.Model
+	CityId      string `gorm:"index:idx_city_translation"`
+	TableName   string `gorm:"index:idx_city_translation"`
+	FieldName   string
+	Language    string `gorm:"index:idx_city_translation"`
+	Translation string
+	RecordId    sql.NullString
+	RecordSubId sql.NullString
+	FieldValue  sql.NullString
+}
+
+type FeedInfo struct {
+	gorm.Model
+	CityId            string `gorm:"uniqueIndex"`
+	FeedPublisherName sql.NullString
+	FeedPublisherUrl  sql.NullString
+	FeedLang          sql.NullString
+	DefaultLang       sql.NullString
+	FeedStartDate     sql.NullTime `gorm:"type:date"`
+	FeedEndDate       sql.NullTime `gorm:"type:date"`
+	FeedVersion       sql.NullString
+	FeedContactEmail  sql.NullString
+	FeedContactUrl    sql.NullString
+}
+
 func DbRouteToRoute(dbRoute Route) models.Route {
 	return models.Route{
 		RouteId:          dbRoute.RouteId,
@@ -111,6 +310,7 @@ func DbRouteToRoute(dbRoute Route) models.Route {
 		RouteUrl:         nullStringToString(dbRoute.RouteUrl),
 		RouteColor:       nullStringToString(dbRoute.RouteColor),
 		RouteTextColor:   nullStringToString(dbRoute.RouteTextColor),
+		NetworkId:        nullStringToString(dbRoute.NetworkId),
 	}
 }
 
@@ -127,6 +327,7 @@ func DbStopToStop(dbStop Stop) models.Stop {
 		PlatformCode:       nullStringToString(dbStop.PlatformCode),
 		WheelchairBoarding: models.Accessibility(nullInt16ToInt16(dbStop.WheelchairBoarding)),
 		LocationType:       models.Location(nullInt16ToInt16(dbStop.LocationType)),
+		LevelId:            nullStringToString(dbStop.LevelId),
 	}
 }
 
@@ -146,17 +347,35 @@ func DbTripToTrip(dbTrip Trip) models.Trip {
 }
 
 func DbDepartureToDeparture(dbDep Departure) models.Departure {
-	return models.Departure{
-		Trip:          DbTripToTrip(dbDep.Trip),
-		Route:         DbRouteToRoute(dbDep.Trip.Route),
-		TripId:        dbDep.TripId,
-		StopId:        dbDep.StopId,
-		ArrivalTime:   dbDep.ArrivalTime,
-		DepartureTime: dbDep.DepartureTime,
-		StopSequence:  dbDep.StopSequence,
-		PickupType:    models.PickupOrDropoff(nullInt16ToInt16(dbDep.PickupType)),
-		DropoffType:   models.PickupOrDropoff(nullInt16ToInt16(dbDep.DropoffType)),
+	dep := models.Departure{
+		Trip:              DbTripToTrip(dbDep.Trip),
+		Route:             DbRouteToRoute(dbDep.Trip.Route),
+		TripId:            dbDep.TripId,
+		StopId:            dbDep.StopId,
+		ArrivalTime:       dbDep.ArrivalTime,
+		DepartureTime:     dbDep.DepartureTime,
+		StopSequence:      dbDep.StopSequence,
+		PickupType:        models.PickupOrDropoff(nullInt16ToInt16(dbDep.PickupType)),
+		DropoffType:       models.PickupOrDropoff(nullInt16ToInt16(dbDep.DropoffType)),
+		StopHeadsign:      nullStringToString(dbDep.StopHeadsign),
+		Timepoint:         models.Timepoint(nullInt16ToInt16(dbDep.Timepoint)),
+		ShapeDistTraveled: nullFloat64ToFloat64Ptr(dbDep.ShapeDistTraveled),
+		ShapeDistance:     nullFloat64ToFloat64Ptr(dbDep.ShapeDistance),
+		ContinuousPickup:  models.PickupOrDropoff(nullInt16ToInt16(dbDep.ContinuousPickup)),
+		ContinuousDropOff: models.PickupOrDropoff(nullInt16ToInt16(dbDep.ContinuousDropOff)),
+		Interpolated:      dbDep.Interpolated,
+		PlatformCode:      nullStringToString(dbDep.Stop.PlatformCode),
 	}
+	dep.Headsign = departureHeadsign(dep)
+
+	return dep
+}
+
+func departureHeadsign(dep models.Departure) string {
+	if dep.StopHeadsign != "" {
+		return dep.StopHeadsign
+	}
+	return dep.Trip.TripHeadsign
 }
 
 func DbCalendarToCalendar(dbCal Calendar) models.Calendar {
@@ -191,6 +410,182 @@ func DbShapeToShape(dbShape Shape) models.Shape {
 	}
 }
 
+func DbFrequencyToFrequency(dbFreq Frequency) models.Frequency {
+	return models.Frequency{
+		TripId:      dbFreq.TripId,
+		StartTime:   dbFreq.StartTime,
+		EndTime:     dbFreq.EndTime,
+		HeadwaySecs: dbFreq.HeadwaySecs,
+		ExactTimes:  dbFreq.ExactTimes,
+	}
+}
+
+func DbFareAttributeToFareAttribute(dbFare FareAttribute) models.FareAttribute {
+	return models.FareAttribute{
+		FareId:           dbFare.FareId,
+		Price:            dbFare.Price,
+		CurrencyType:     dbFare.CurrencyType,
+		PaymentMethod:    models.PaymentMethod(dbFare.PaymentMethod),
+		Transfers:        dbFare.Transfers,
+		AgencyId:         nullStringToString(dbFare.AgencyId),
+		TransferDuration: int(dbFare.TransferDuration.Int32),
+	}
+}
+
+func DbFareRuleToFareRule(dbRule FareRule) models.FareRule {
+	return models.FareRule{
+		FareId:        dbRule.FareId,
+		RouteId:       nullStringToString(dbRule.RouteId),
+		OriginId:      nullStringToString(dbRule.OriginId),
+		DestinationId: nullStringToString(dbRule.DestinationId),
+		ContainsId:    nullStringToString(dbRule.ContainsId),
+	}
+}
+
+func DbFareProductToFareProduct(dbProduct FareProduct) models.FareProduct {
+	return models.FareProduct{
+		FareProductId:   dbProduct.FareProductId,
+		FareProductName: nullStringToString(dbProduct.FareProductName),
+		FareMediaId:     nullStringToString(dbProduct.FareMediaId),
+		Amount:          dbProduct.Amount,
+		Currency:        dbProduct.Currency,
+	}
+}
+
+func DbFareMediaToFareMedia(dbMedia FareMedia) models.FareMedia {
+	return models.FareMedia{
+		FareMediaId:   dbMedia.FareMediaId,
+		FareMediaName: nullStringToString(dbMedia.FareMediaName),
+		FareMediaType: models.FareMediaType(dbMedia.FareMediaType),
+	}
+}
+
+func DbFareLegRuleToFareLegRule(dbRule FareLegRule) models.FareLegRule {
+	return models.FareLegRule{
+		LegGroupId:           nullStringToString(dbRule.LegGroupId),
+		NetworkId:            nullStringToString(dbRule.NetworkId),
+		FromAreaId:           nullStringToString(dbRule.FromAreaId),
+		ToAreaId:             nullStringToString(dbRule.ToAreaId),
+		FromTimeframeGroupId: nullStringToString(dbRule.FromTimeframeGroupId),
+		ToTimeframeGroupId:   nullStringToString(dbRule.ToTimeframeGroupId),
+		FareProductId:        dbRule.FareProductId,
+		RulePriority:         nullInt32ToIntPtr(dbRule.RulePriority),
+	}
+}
+
+func DbFareTransferRuleToFareTransferRule(dbRule FareTransferRule) models.FareTransferRule {
+	return models.FareTransferRule{
+		FromLegGroupId:    nullStringToString(dbRule.FromLegGroupId),
+		ToLegGroupId:      nullStringToString(dbRule.ToLegGroupId),
+		TransferCount:     dbRule.TransferCount,
+		DurationLimit:     int(dbRule.DurationLimit.Int32),
+		DurationLimitType: models.DurationLimitType(dbRule.DurationLimitType),
+		FareTransferType:  models.FareTransferType(dbRule.FareTransferType),
+		FareProductId:     nullStringToString(dbRule.FareProductId),
+	}
+}
+
+func DbAreaToArea(dbArea Area) models.Area {
+	return models.Area{
+		AreaId:   dbArea.AreaId,
+		AreaName: nullStringToString(dbArea.AreaName),
+	}
+}
+
+func DbStopAreaToStopArea(dbStopArea StopArea) models.StopArea {
+	return models.StopArea{
+		AreaId: dbStopArea.AreaId,
+		StopId: dbStopArea.StopId,
+	}
+}
+
+func DbNetworkToNetwork(dbNetwork Network) models.Network {
+	return models.Network{
+		NetworkId:   dbNetwork.NetworkId,
+		NetworkName: nullStringToString(dbNetwork.NetworkName),
+	}
+}
+
+func DbRouteNetworkToRouteNetwork(dbRouteNetwork RouteNetwork) models.RouteNetwork {
+	return models.RouteNetwork{
+		NetworkId: dbRouteNetwork.NetworkId,
+		RouteId:   dbRouteNetwork.RouteId,
+	}
+}
+
+func DbTimeframeToTimeframe(dbTimeframe Timeframe) models.Timeframe {
+	return models.Timeframe{
+		TimeframeGroupId: dbTimeframe.TimeframeGroupId,
+		StartTime:        nullStringToString(dbTimeframe.StartTime),
+		EndTime:          nullStringToString(dbTimeframe.EndTime),
+		ServiceId:        dbTimeframe.ServiceId,
+	}
+}
+
+func DbPathwayToPathway(dbPathway Pathway) models.Pathway {
+	return models.Pathway{
+		PathwayId:            dbPathway.PathwayId,
+		FromStopId:           dbPathway.FromStopId,
+		ToStopId:             dbPathway.ToStopId,
+		PathwayMode:          models.PathwayMode(dbPathway.PathwayMode),
+		IsBidirectional:      dbPathway.IsBidirectional,
+		Length:               nullFloat64ToFloat64(dbPathway.Length),
+		TraversalTime:        int(dbPathway.TraversalTime.Int32),
+		StairCount:           int(dbPathway.StairCount.Int32),
+		MaxSlope:             nullFloat64ToFloat64(dbPathway.MaxSlope),
+		MinWidth:             nullFloat64ToFloat64(dbPathway.MinWidth),
+		SignpostedAs:         nullStringToString(dbPathway.SignpostedAs),
+		ReversedSignpostedAs: nullStringToString(dbPathway.ReversedSignpostedAs),
+	}
+}
+
+func DbShapeInfoToShapeInfo(dbInfo ShapeInfo) models.ShapeInfo {
+	return models.ShapeInfo{
+		ShapeId:    dbInfo.ShapeId,
+		MinLat:     dbInfo.MinLat,
+		MinLon:     dbInfo.MinLon,
+		MaxLat:     dbInfo.MaxLat,
+		MaxLon:     dbInfo.MaxLon,
+		Length:     dbInfo.Length,
+		PointCount: dbInfo.PointCount,
+		Synthetic:  dbInfo.Synthetic,
+	}
+}
+
+func DbLevelToLevel(dbLevel Level) models.Level {
+	return models.Level{
+		LevelId:    dbLevel.LevelId,
+		LevelIndex: dbLevel.LevelIndex,
+		LevelName:  nullStringToString(dbLevel.LevelName),
+	}
+}
+
+func DbTranslationToTranslation(dbTranslation Translation) models.Translation {
+	return models.Translation{
+		TableName:   dbTranslation.TableName,
+		FieldName:   dbTranslation.FieldName,
+		Language:    dbTranslation.Language,
+		Translation: dbTranslation.Translation,
+		RecordId:    nullStringToString(dbTranslation.RecordId),
+		RecordSubId: nullStringToString(dbTranslation.RecordSubId),
+		FieldValue:  nullStringToString(dbTranslation.FieldValue),
+	}
+}
+
+func DbFeedInfoToFeedInfo(dbInfo FeedInfo) models.FeedInfo {
+	return models.FeedInfo{
+		FeedPublisherName: nullStringToString(dbInfo.FeedPublisherName),
+		FeedPublisherUrl:  nullStringToString(dbInfo.FeedPublisherUrl),
+		FeedLang:          nullStringToString(dbInfo.FeedLang),
+		DefaultLang:       nullStringToString(dbInfo.DefaultLang),
+		FeedStartDate:     dbInfo.FeedStartDate.Time,
+		FeedEndDate:       dbInfo.FeedEndDate.Time,
+		FeedVersion:       nullStringToString(dbInfo.FeedVersion),
+		FeedContactEmail:  nullStringToString(dbInfo.FeedContactEmail),
+		FeedContactUrl:    nullStringToString(dbInfo.FeedContactUrl),
+	}
+}
+
 func RouteToDbRoute(route models.Route, cityId string) Route {
 	return Route{
 		CityId:           cityId,
@@ -203,6 +598,7 @@ func RouteToDbRoute(route models.Route, cityId string) Route {
 		RouteUrl:         stringToNullString(route.RouteUrl),
 		RouteColor:       stringToNullString(route.RouteColor),
 		RouteTextColor:   stringToNullString(route.RouteTextColor),
+		NetworkId:        stringToNullString(route.NetworkId),
 	}
 }
 
@@ -220,6 +616,7 @@ func StopToDbStop(stop models.Stop, cityId string) Stop {
 		PlatformCode:       stringToNullString(stop.PlatformCode),
 		WheelchairBoarding: sql.NullInt16{Int16: int16(stop.WheelchairBoarding), Valid: true},
 		LocationType:       sql.NullInt16{Int16: int16(stop.LocationType), Valid: true},
+		LevelId:            stringToNullString(stop.LevelId),
 	}
 }
 
@@ -241,14 +638,21 @@ func TripToDbTrip(trip models.Trip, cityId string) Trip {
 
 func DepartureToDbDeparture(dep models.Departure, cityId string) Departure {
 	return Departure{
-		CityId:        cityId,
-		TripId:        dep.TripId,
-		StopId:        dep.StopId,
-		ArrivalTime:   dep.ArrivalTime,
-		DepartureTime: dep.DepartureTime,
-		StopSequence:  dep.StopSequence,
-		PickupType:    sql.NullInt16{Int16: int16(dep.PickupType), Valid: true},
-		DropoffType:   sql.NullInt16{Int16: int16(dep.DropoffType), Valid: true},
+		CityId:            cityId,
+		TripId:            dep.TripId,
+		StopId:            dep.StopId,
+		ArrivalTime:       dep.ArrivalTime,
+		DepartureTime:     dep.DepartureTime,
+		StopSequence:      dep.StopSequence,
+		PickupType:        sql.NullInt16{Int16: int16(dep.PickupType), Valid: true},
+		DropoffType:       sql.NullInt16{Int16: int16(dep.DropoffType), Valid: true},
+		StopHeadsign:      stringToNullString(dep.StopHeadsign),
+		Timepoint:         sql.NullInt16{Int16: int16(dep.Timepoint), Valid: true},
+		ShapeDistTraveled: float64PtrToNullFloat64(dep.ShapeDistTraveled),
+		ShapeDistance:     float64PtrToNullFloat64(dep.ShapeDistance),
+		ContinuousPickup:  sql.NullInt16{Int16: int16(dep.ContinuousPickup), Valid: true},
+		ContinuousDropOff: sql.NullInt16{Int16: int16(dep.ContinuousDropOff), Valid: true},
+		Interpolated:      dep.Interpolated,
 	}
 }
 
@@ -287,6 +691,199 @@ func ShapeToDbShape(shape models.Shape, cityId string) Shape {
 	}
 }
 
+func FrequencyToDbFrequency(freq models.Frequency, cityId string) Frequency {
+	return Frequency{
+		CityId:      cityId,
+		TripId:      freq.TripId,
+		StartTime:   freq.StartTime,
+		EndTime:     freq.EndTime,
+		HeadwaySecs: freq.HeadwaySecs,
+		ExactTimes:  freq.ExactTimes,
+	}
+}
+
+func FareAttributeToDbFareAttribute(fare models.FareAttribute, cityId string) FareAttribute {
+	return FareAttribute{
+		CityId:           cityId,
+		FareId:           fare.FareId,
+		Price:            fare.Price,
+		CurrencyType:     fare.CurrencyType,
+		PaymentMethod:    int16(fare.PaymentMethod),
+		Transfers:        fare.Transfers,
+		AgencyId:         stringToNullString(fare.AgencyId),
+		TransferDuration: sql.NullInt32{Int32: int32(fare.TransferDuration), Valid: fare.TransferDuration > 0},
+	}
+}
+
+func FareRuleToDbFareRule(rule models.FareRule, cityId string) FareRule {
+	return FareRule{
+		CityId:        cityId,
+		FareId:        rule.FareId,
+		RouteId:       stringToNullString(rule.RouteId),
+		OriginId:      stringToNullString(rule.OriginId),
+		DestinationId: stringToNullString(rule.DestinationId),
+		ContainsId:    stringToNullString(rule.ContainsId),
+	}
+}
+
+func FareProductToDbFareProduct(product models.FareProduct, cityId string) FareProduct {
+	return FareProduct{
+		CityId:          cityId,
+		FareProductId:   product.FareProductId,
+		FareProductName: stringToNullString(product.FareProductName),
+		FareMediaId:     stringToNullString(product.FareMediaId),
+		Amount:          product.Amount,
+		Currency:        product.Currency,
+	}
+}
+
+func FareMediaToDbFareMedia(media models.FareMedia, cityId string) FareMedia {
+	return FareMedia{
+		CityId:        cityId,
+		FareMediaId:   media.FareMediaId,
+		FareMediaName: stringToNullString(media.FareMediaName),
+		FareMediaType: int16(media.FareMediaType),
+	}
+}
+
+func FareLegRuleToDbFareLegRule(rule models.FareLegRule, cityId string) FareLegRule {
+	return FareLegRule{
+		CityId:               cityId,
+		LegGroupId:           stringToNullString(rule.LegGroupId),
+		NetworkId:            stringToNullString(rule.NetworkId),
+		FromAreaId:           stringToNullString(rule.FromAreaId),
+		ToAreaId:             stringToNullString(rule.ToAreaId),
+		FromTimeframeGroupId: stringToNullString(rule.FromTimeframeGroupId),
+		ToTimeframeGroupId:   stringToNullString(rule.ToTimeframeGroupId),
+		FareProductId:        rule.FareProductId,
+		RulePriority:         intPtrToNullInt32(rule.RulePriority),
+	}
+}
+
+func FareTransferRuleToDbFareTransferRule(rule models.FareTransferRule, cityId string) FareTransferRule {
+	return FareTransferRule{
+		CityId:            cityId,
+		FromLegGroupId:    stringToNullString(rule.FromLegGroupId),
+		ToLegGroupId:      stringToNullString(rule.ToLegGroupId),
+		TransferCount:     rule.TransferCount,
+		DurationLimit:     sql.NullInt32{Int32: int32(rule.DurationLimit), Valid: rule.DurationLimit > 0},
+		DurationLimitType: int16(rule.DurationLimitType),
+		FareTransferType:  int16(rule.FareTransferType),
+		FareProductId:     stringToNullString(rule.FareProductId),
+	}
+}
+
+func AreaToDbArea(area models.Area, cityId string) Area {
+	return Area{
+		CityId:   cityId,
+		AreaId:   area.AreaId,
+		AreaName: stringToNullString(area.AreaName),
+	}
+}
+
+func StopAreaToDbStopArea(stopArea models.StopArea, cityId string) StopArea {
+	return StopArea{
+		CityId: cityId,
+		AreaId: stopArea.AreaId,
+		StopId: stopArea.StopId,
+	}
+}
+
+func NetworkToDbNetwork(network models.Network, cityId string) Network {
+	return Network{
+		CityId:      cityId,
+		NetworkId:   network.NetworkId,
+		NetworkName: stringToNullString(network.NetworkName),
+	}
+}
+
+func RouteNetworkToDbRouteNetwork(routeNetwork models.RouteNetwork, cityId string) RouteNetwork {
+	return RouteNetwork{
+		CityId:    cityId,
+		NetworkId: routeNetwork.NetworkId,
+		RouteId:   routeNetwork.RouteId,
+	}
+}
+
+func TimeframeToDbTimeframe(timeframe models.Timeframe, cityId string) Timeframe {
+	return Timeframe{
+		CityId:           cityId,
+		TimeframeGroupId: timeframe.TimeframeGroupId,
+		StartTime:        stringToNullString(timeframe.StartTime),
+		EndTime:          stringToNullString(timeframe.EndTime),
+		ServiceId:        timeframe.ServiceId,
+	}
+}
+
+func PathwayToDbPathway(pathway models.Pathway, cityId string) Pathway {
+	return Pathway{
+		CityId:               cityId,
+		PathwayId:            pathway.PathwayId,
+		FromStopId:           pathway.FromStopId,
+		ToStopId:             pathway.ToStopId,
+		PathwayMode:          int16(pathway.PathwayMode),
+		IsBidirectional:      pathway.IsBidirectional,
+		Length:               sql.NullFloat64{Float64: pathway.Length, Valid: pathway.Length > 0},
+		TraversalTime:        sql.NullInt32{Int32: int32(pathway.TraversalTime), Valid: pathway.TraversalTime > 0},
+		StairCount:           sql.NullInt32{Int32: int32(pathway.StairCount), Valid: pathway.StairCount != 0},
+		MaxSlope:             sql.NullFloat64{Float64: pathway.MaxSlope, Valid: pathway.MaxSlope != 0},
+		MinWidth:             sql.NullFloat64{Float64: pathway.MinWidth, Valid: pathway.MinWidth > 0},
+		SignpostedAs:         stringToNullString(pathway.SignpostedAs),
+		ReversedSignpostedAs: stringToNullString(pathway.ReversedSignpostedAs),
+	}
+}
+
+func ShapeInfoToDbShapeInfo(info models.ShapeInfo, cityId string) ShapeInfo {
+	return ShapeInfo{
+		CityId:     cityId,
+		ShapeId:    info.ShapeId,
+		MinLat:     info.MinLat,
+		MinLon:     info.MinLon,
+		MaxLat:     info.MaxLat,
+		MaxLon:     info.MaxLon,
+		Length:     info.Length,
+		PointCount: info.PointCount,
+		Synthetic:  info.Synthetic,
+	}
+}
+
+func LevelToDbLevel(level models.Level, cityId string) Level {
+	return Level{
+		CityId:     cityId,
+		LevelId:    level.LevelId,
+		LevelIndex: level.LevelIndex,
+		LevelName:  stringToNullString(level.LevelName),
+	}
+}
+
+func TranslationToDbTranslation(translation models.Translation, cityId string) Translation {
+	return Translation{
+		CityId:      cityId,
+		TableName:   translation.TableName,
+		FieldName:   translation.FieldName,
+		Language:    translation.Language,
+		Translation: translation.Translation,
+		RecordId:    stringToNullString(translation.RecordId),
+		RecordSubId: stringToNullString(translation.RecordSubId),
+		FieldValue:  stringToNullString(translation.FieldValue),
+	}
+}
+
+func FeedInfoToDbFeedInfo(info models.FeedInfo, cityId string) FeedInfo {
+	return FeedInfo{
+		CityId:            cityId,
+		FeedPublisherName: stringToNullString(info.FeedPublisherName),
+		FeedPublisherUrl:  stringToNullString(info.FeedPublisherUrl),
+		FeedLang:          stringToNullString(info.FeedLang),
+		DefaultLang:       stringToNullString(info.DefaultLang),
+		FeedStartDate:     sql.NullTime{Time: info.FeedStartDate, Valid: !info.FeedStartDate.IsZero()},
+		FeedEndDate:       sql.NullTime{Time: info.FeedEndDate, Valid: !info.FeedEndDate.IsZero()},
+		FeedVersion:       stringToNullString(info.FeedVersion),
+		FeedContactEmail:  stringToNullString(info.FeedContactEmail),
+		FeedContactUrl:    stringToNullString(info.FeedContactUrl),
+	}
+}
+
 func nullStringToString(ns sql.NullString) string {
 	if ns.Valid {
 		return ns.String
@@ -311,3 +908,32 @@ func nullFloat64ToFloat64(nf sql.NullFloat64) float64 {
 	}
 	return 0.0
 }
+
+func nullFloat64ToFloat64Ptr(nf sql.NullFloat64) *float64 {
+	if nf.Valid {
+		return &nf.Float64
+	}
+	return nil
+}
+
+func float64PtrToNullFloat64(f *float64) sql.NullFloat64 {
+	if f != nil {
+		return sql.NullFloat64{Float64: *f, Valid: true}
+	}
+	return sql.NullFloat64{}
+}
+
+func nullInt32ToIntPtr(ni sql.NullInt32) *int {
+	if ni.Valid {
+		v := int(ni.Int32)
+		return &v
+	}
+	return nil
+}
+
+func intPtrToNullInt32(i *int) sql.NullInt32 {
+	if i != nil {
+		return sql.NullInt32{Int32: int32(*i), Valid: true}
+	}
+	return sql.NullInt32{}
+}
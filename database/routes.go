@@ -0,0 +1,143 @@
+package database
+
+import (
+	"maps"
+	"slices"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+)
+
+func GetRoute(db *gorm.DB, city string, id string) (models.Route, bool) {
+	var dbRoute Route
+
+	res := db.Table("routes").Where("city_id = ?", city).Where("route_id = ?", id).Limit(1).Find(&dbRoute)
+	if res.RowsAffected == 0 {
+		return models.Route{}, false
+	}
+
+	return DbRouteToRoute(dbRoute), true
+}
+
+func GetTripsForRoute(db *gorm.DB, city string, route string) []models.Trip {
+	var dbTrips []Trip
+	var trips []models.Trip
+
+	db.Table("trips").Where("city_id = ?", city).Where("route_id = ?", route).Find(&dbTrips)
+
+	for _, dbTrip := range dbTrips {
+		trips = append(trips, DbTripToTrip(dbTrip))
+	}
+
+	return trips
+}
+
+// Ordered stop IDs of every trip in tripIDs
+func getTripStopSequences(db *gorm.DB, city string, tripIDs []string) map[string][]string {
+	sequences := make(map[string][]string)
+	if len(tripIDs) == 0 {
+		return sequences
+	}
+
+	var rows []Departure
+	db.Model(&Departure{}).
+		Select("trip_id, stop_id, stop_sequence").
+		Where("city_id = ?", city).
+		Where("trip_id IN ?", tripIDs).
+		Order("trip_id, stop_sequence").
+		Find(&rows)
+
+	for _, row := range rows {
+		sequences[row.TripId] = append(sequences[row.TripId], row.StopId)
+	}
+
+	return sequences
+}
+
+func getStopsByID(db *gorm.DB, city string, stopIDs []string) map[string]models.Stop {
+	stops := make(map[string]models.Stop)
+	if len(stopIDs) == 0 {
+		return stops
+	}
+
+	var dbStops []Stop
+	db.Table("stops").Where("city_id = ?", city).Where("stop_id IN ?", stopIDs).Find(&dbStops)
+
+	for _, dbStop := range dbStops {
+		stops[dbStop.StopId] = DbStopToStop(dbStop)
+	}
+
+	return stops
+}
+
+func GetRoutePatterns(db *gorm.DB, city string, route string) []models.RoutePattern {
+	trips := GetTripsForRoute(db, city, route)
+
+	tripIDs := make([]string, 0, len(trips))
+	for _, trip := range trips {
+		tripIDs = append(tripIDs, trip.TripId)
+	}
+
+	return models.RoutePatterns(trips, getTripStopSequences(db, city, tripIDs), func(stopIDs []string) map[string]models.Stop {
+		return getStopsByID(db, city, stopIDs)
+	})
+}
+
+func GetRouteDetail(db *gorm.DB, city string, id string) (models.RouteDetail, bool) {
+	route, ok := GetRoute(db, city, id)
+	if !ok {
+		return models.RouteDetail{}, false
+	}
+
+	return models.RouteDetail{
+		Route:    route,
+		Patterns: GetRoutePatterns(db, city, id),
+	}, true
+}
+
+// Lines of every distinct shape used by each route's trips, ordered by
+// shape ID and keyed by route ID. Routes without shapes are left out.
+func GetRouteShapes(db *gorm.DB, city string, routes []string) map[string][][][2]float64 {
+	var pairs []struct {
+		RouteId string
+		ShapeId string
+	}
+	for chunk := range slices.Chunk(routes, shapeQueryChunk) {
+		var rows []struct {
+			RouteId string
+			ShapeId string
+		}
+		db.Table("trips").Select("route_id, shape_id").Where("city_id = ?", city).Where("route_id IN ?", chunk).
+			Where("shape_id IS NOT NULL AND shape_id <> ''").Distinct().Order("route_id, shape_id").Scan(&rows)
+		pairs = append(pairs, rows...)
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	shapeIDs := make(map[string]bool)
+	for _, pair := range pairs {
+		shapeIDs[pair.ShapeId] = true
+	}
+
+	points := make(map[string][][2]float64)
+	for chunk := range slices.Chunk(slices.Sorted(maps.Keys(shapeIDs)), shapeQueryChunk) {
+		var dbShapes []Shape
+		db.Table("shapes").Where("city_id = ?", city).Where("shape_id IN ?", chunk).
+			Order("shape_id").Order("shape_pt_sequence").Limit(-1).Find(&dbShapes)
+
+		for _, s := range dbShapes {
+			shape := DbShapeToShape(s)
+			points[shape.ShapeId] = append(points[shape.ShapeId], [2]float64{shape.ShapePtLat, shape.ShapePtLon})
+		}
+	}
+
+	lines := make(map[string][][][2]float64)
+	for _, pair := range pairs {
+		if line, ok := points[pair.ShapeId]; ok {
+			lines[pair.RouteId] = append(lines[pair.RouteId], line)
+		}
+	}
+
+	return lines
+}
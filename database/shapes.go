@@ -0,0 +1,223 @@
+package database
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Keeps IN lists well below the bound parameter limits of the drivers
+const shapeQueryChunk = 1000
+
+func GetShapeInfo(db *gorm.DB, city string, id string) (models.ShapeInfo, bool) {
+	var dbInfo ShapeInfo
+
+	result := db.Table("shape_infos").Where("city_id = ?", city).Where("shape_id = ?", id).Limit(1).Find(&dbInfo)
+	if result.RowsAffected == 0 {
+		return models.ShapeInfo{}, false
+	}
+
+	return DbShapeInfoToShapeInfo(dbInfo), true
+}
+
+func GetShapeInfos(db *gorm.DB, city string) []models.ShapeInfo {
+	var dbInfos []ShapeInfo
+	var infos []models.ShapeInfo
+
+	db.Table("shape_infos").Where("city_id = ?", city).Order("shape_id").Find(&dbInfos)
+
+	for _, dbInfo := range dbInfos {
+		infos = append(infos, DbShapeInfoToShapeInfo(dbInfo))
+	}
+
+	return infos
+}
+
+// GetEncodedShape returns a shape as a single polyline string
+func GetEncodedShape(db *gorm.DB, city string, id string, precision int, tolerance float64) (models.EncodedShape, bool) {
+	info, found := GetShapeInfo(db, city, id)
+	if !found {
+		return models.EncodedShape{}, false
+	}
+
+	return models.EncodeShape(info, GetShapeById(db, city, id), precision, tolerance), true
+}
+
+// synthesizeShapes draws straight-line shapes through the stops of trips
+// the feed gave no shape, one per distinct stop pattern, and assigns them
+// to the trips.
+func synthesizeShapes(db *gorm.DB, city string, batchSize int) {
+	var tripIDs []string
+	db.Table("trips").Where("city_id = ?", city).Where("shape_id IS NULL OR shape_id = ''").Order("trip_id").Pluck("trip_id", &tripIDs)
+	if len(tripIDs) == 0 {
+		return
+	}
+
+	patternTrips := make(map[string][]string)
+	patternStops := make(map[string][]string)
+	stopIDs := make(map[string]bool)
+	for chunk := range slices.Chunk(tripIDs, shapeQueryChunk) {
+		for tripID, seq := range getTripStopSequences(db, city, chunk) {
+			if len(seq) < 2 {
+				continue
+			}
+
+			id := models.SyntheticShapeID(city, seq)
+			if _, ok := patternStops[id]; !ok {
+				patternStops[id] = seq
+				for _, stopID := range seq {
+					stopIDs[stopID] = true
+				}
+			}
+			patternTrips[id] = append(patternTrips[id], tripID)
+		}
+	}
+
+	stops := make(map[string]models.Stop)
+	for chunk := range slices.Chunk(slices.Sorted(maps.Keys(stopIDs)), shapeQueryChunk) {
+		maps.Copy(stops, getStopsByID(db, city, chunk))
+	}
+
+	var (
+		dbShapes []Shape
+		dbInfos  []ShapeInfo
+	)
+	for _, id := range slices.Sorted(maps.Keys(patternStops)) {
+		points, info, ok := models.SyntheticShape(id, patternStops[id], stops)
+		if !ok {
+			delete(patternTrips, id)
+			continue
+		}
+
+		for _, p := range points {
+			dbShapes = append(dbShapes, ShapeToDbShape(p, city))
+		}
+		dbInfos = append(dbInfos, ShapeInfoToDbShapeInfo(info, city))
+	}
+
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbShapes, batchSize)
+	db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dbInfos, batchSize)
+
+	for id, trips := range patternTrips {
+		for chunk := range slices.Chunk(trips, shapeQueryChunk) {
+			db.Model(&Trip{}).Where("city_id = ?", city).Where("trip_id IN ?", chunk).Update("shape_id", id)
+		}
+	}
+
+	println("Synthesized", len(dbInfos), "shapes for city:", city)
+}
+
+type snapPattern struct {
+	stops   []Departure
+	tripIDs []string
+}
+
+// snapStopsToShapes stores how far along its trip's shape every stop time
+// lies. Trips sharing a shape and the same stops at the same sequence
+// numbers are snapped once and updated together.
+func snapStopsToShapes(db *gorm.DB, city string) {
+	var trips []struct {
+		TripId  string
+		ShapeId string
+	}
+	db.Table("trips").Select("trip_id, shape_id").Where("city_id = ?", city).
+		Where("shape_id IS NOT NULL AND shape_id <> ''").Order("shape_id, trip_id").Scan(&trips)
+	if len(trips) == 0 {
+		return
+	}
+
+	shapeTrips := make(map[string][]string)
+	for _, trip := range trips {
+		shapeTrips[trip.ShapeId] = append(shapeTrips[trip.ShapeId], trip.TripId)
+	}
+
+	stops := make(map[string][2]float64)
+	GetStops(db, city, models.ListQuery{}, func(stop models.Stop) error {
+		if stop.StopLat != 0 || stop.StopLon != 0 {
+			stops[stop.StopId] = [2]float64{stop.StopLat, stop.StopLon}
+		}
+		return nil
+	})
+
+	snapped := 0
+	db.Transaction(func(tx *gorm.DB) error {
+		for _, shapeID := range slices.Sorted(maps.Keys(shapeTrips)) {
+			locator := geo.NewLineLocator(models.ShapePoints(GetShapeById(tx, city, shapeID)))
+			if locator.Length() == 0 {
+				continue
+			}
+
+			patterns := make(map[string]*snapPattern)
+			var order []string
+			for chunk := range slices.Chunk(shapeTrips[shapeID], shapeQueryChunk) {
+				var rows []Departure
+				tx.Model(&Departure{}).
+					Select("trip_id, stop_id, stop_sequence").
+					Where("city_id = ?", city).
+					Where("trip_id IN ?", chunk).
+					Order("trip_id, stop_sequence").
+					Find(&rows)
+
+				for start := 0; start < len(rows); {
+					end := start
+					var key strings.Builder
+					for end < len(rows) && rows[end].TripId == rows[start].TripId {
+						fmt.Fprintf(&key, "%s@%d\x00", rows[end].StopId, rows[end].StopSequence)
+						end++
+					}
+
+					p, ok := patterns[key.String()]
+					if !ok {
+						p = &snapPattern{stops: rows[start:end]}
+						patterns[key.String()] = p
+						order = append(order, key.String())
+					}
+					p.tripIDs = append(p.tripIDs, rows[start].TripId)
+
+					start = end
+				}
+			}
+
+			for _, key := range order {
+				p := patterns[key]
+
+				// One (stop_sequence, distance) row per stop, the casts type
+				// the VALUES columns on Postgres
+				var (
+					values []string
+					args   []any
+				)
+				stopIDs := make([]string, len(p.stops))
+				for i, stop := range p.stops {
+					stopIDs[i] = stop.StopId
+				}
+				for i, along := range models.SnapToShape(locator, stopIDs, stops) {
+					if along != nil {
+						values = append(values, "(CAST(? AS INTEGER), CAST(? AS DOUBLE PRECISION))")
+						args = append(args, p.stops[i].StopSequence, *along)
+					}
+				}
+				if len(values) == 0 {
+					continue
+				}
+
+				// The whole pattern is updated in one statement per chunk of trips
+				update := "UPDATE departures SET shape_distance = v.column2 FROM (VALUES " + strings.Join(values, ", ") + ") AS v " +
+					"WHERE departures.city_id = ? AND departures.trip_id IN ? AND departures.stop_sequence = v.column1"
+				for chunk := range slices.Chunk(p.tripIDs, shapeQueryChunk) {
+					tx.Exec(update, append(slices.Clone(args), city, chunk)...)
+				}
+				snapped += len(p.tripIDs)
+			}
+		}
+		return nil
+	})
+
+	println("Snapped stops of", snapped, "trips to shapes for city:", city)
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"iter"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/snapshot"
+	"gorm.io/gorm"
+)
+
+// BuildSnapshot snapshots a city's imported tables, stop times are streamed
+// straight into their columns
+func BuildSnapshot(db *gorm.DB, city string) *snapshot.Snapshot {
+	data := snapshot.Data{
+		StopTimes:    streamStopTimes(db, city),
+		Frequencies:  GetFrequencies(db, city),
+		Shapes:       GetShapes(db, city),
+		ShapeInfos:   GetShapeInfos(db, city),
+		FeedInfo:     GetFeedInfo(db, city),
+		ServiceDates: make(map[string][]time.Time),
+		Translations: GetTranslations(db, city),
+	}
+
+	GetStops(db, city, models.ListQuery{}, func(stop models.Stop) error {
+		data.Stops = append(data.Stops, stop)
+		return nil
+	})
+	GetRoutes(db, city, models.ListQuery{}, func(route models.Route) error {
+		data.Routes = append(data.Routes, route)
+		return nil
+	})
+	GetTrips(db, city, models.ListQuery{}, func(trip models.Trip) error {
+		data.Trips = append(data.Trips, trip)
+		return nil
+	})
+
+	var calendars []Calendar
+	db.Table("calendars").Where("city_id = ?", city).Find(&calendars)
+	for _, cal := range calendars {
+		data.Calendars = append(data.Calendars, DbCalendarToCalendar(cal))
+	}
+
+	var calendarDates []CalendarDate
+	db.Table("calendar_dates").Where("city_id = ?", city).Order("date").Find(&calendarDates)
+	for _, cd := range calendarDates {
+		data.CalendarDates = append(data.CalendarDates, DbCalendarDateToCalendarDate(cd))
+	}
+
+	var serviceDates []ServiceDate
+	db.Model(&ServiceDate{}).Select("service_id, date").Where("city_id = ?", city).Order("date").Find(&serviceDates)
+	for _, sd := range serviceDates {
+		if d, err := time.ParseInLocation(serviceDateFormat, sd.Date, time.Local); err == nil {
+			data.ServiceDates[sd.ServiceId] = append(data.ServiceDates[sd.ServiceId], d)
+		}
+	}
+
+	data.FareAttributes = GetFareAttributes(db, city)
+	data.FareRules = GetFareRules(db, city)
+
+	rules := getFareRulesV2(db, city)
+	data.FareProducts = rules.Products
+	data.FareLegRules = rules.LegRules
+	data.FareTransferRules = rules.TransferRules
+	data.Timeframes = rules.Timeframes
+
+	var stopAreas []StopArea
+	db.Model(&StopArea{}).Where("city_id = ?", city).Order("id").Find(&stopAreas)
+	for _, dat := range stopAreas {
+		data.StopAreas = append(data.StopAreas, DbStopAreaToStopArea(dat))
+	}
+
+	var routeNetworks []RouteNetwork
+	db.Model(&RouteNetwork{}).Where("city_id = ?", city).Order("id").Find(&routeNetworks)
+	for _, dat := range routeNetworks {
+		data.RouteNetworks = append(data.RouteNetworks, DbRouteNetworkToRouteNetwork(dat))
+	}
+
+	var pathways []Pathway
+	db.Model(&Pathway{}).Where("city_id = ?", city).Order("id").Find(&pathways)
+	for _, dat := range pathways {
+		data.Pathways = append(data.Pathways, DbPathwayToPathway(dat))
+	}
+
+	var levels []Level
+	db.Model(&Level{}).Where("city_id = ?", city).Order("level_index").Find(&levels)
+	for _, dat := range levels {
+		data.Levels = append(data.Levels, DbLevelToLevel(dat))
+	}
+
+	return snapshot.New(city, data)
+}
+
+// Stop times of a city in trip and stop_sequence order, read row by row so
+// the whole table never sits in memory
+func streamStopTimes(db *gorm.DB, city string) iter.Seq[models.Departure] {
+	return func(yield func(models.Departure) bool) {
+		rows, err := db.Model(&Departure{}).
+			Where("city_id = ?", city).
+			Order("trip_id, stop_sequence").
+			Rows()
+		if err != nil {
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var dbDep Departure
+			if err := db.ScanRows(rows, &dbDep); err != nil {
+				return
+			}
+			if !yield(DbDepartureToDeparture(dbDep)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+)
+
+// Set once PostGIS turns out to be available on a Postgres database. Stops
+// and shapes then get geography columns with GiST indexes that the spatial
+// queries below use, elsewhere they are answered in process.
+var postgis bool
+
+// Stops and stations with coordinates, the locations riders look for on a
+// map. Matches isSpatialStop, which sees missing coordinates as 0.
+const spatialStops = "COALESCE(stops.location_type, 0) IN (0, 1) AND (COALESCE(stops.stop_lat, 0) <> 0 OR COALESCE(stops.stop_lon, 0) <> 0)"
+
+// Distances passed use_spheroid = false below, measuring on a sphere like
+// geo.Distance so both ways of answering agree on what is within range
+const pointSQL = "ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography"
+
+func setupPostGIS(db *gorm.DB) {
+	if db.Dialector.Name() != "postgres" {
+		return
+	}
+	postgis = false
+
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS postgis").Error; err != nil {
+		println("PostGIS is not available, spatial queries run in process:", err.Error())
+		return
+	}
+
+	for _, stmt := range []string{
+		"ALTER TABLE stops ADD COLUMN IF NOT EXISTS geog geography(Point, 4326)",
+		"CREATE INDEX IF NOT EXISTS idx_stops_geog ON stops USING GIST (geog)",
+		"ALTER TABLE shape_infos ADD COLUMN IF NOT EXISTS geog geography(LineString, 4326)",
+		"CREATE INDEX IF NOT EXISTS idx_shape_infos_geog ON shape_infos USING GIST (geog)",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			println("Setting up PostGIS columns failed, spatial queries run in process:", err.Error())
+			return
+		}
+	}
+
+	postgis = true
+}
+
+// Whether a query on db can use the geography columns, a process may also
+// hold SQLite databases
+func usePostGIS(db *gorm.DB) bool {
+	return postgis && db.Dialector.Name() == "postgres"
+}
+
+// indexGeometries fills the geography columns of a city, shapes included
+// the synthesized ones
+func indexGeometries(db *gorm.DB, city string) {
+	if !usePostGIS(db) {
+		return
+	}
+
+	db.Exec(`UPDATE stops SET geog = ST_SetSRID(ST_MakePoint(stop_lon, stop_lat), 4326)::geography
+		WHERE city_id = ? AND stop_lat IS NOT NULL AND stop_lon IS NOT NULL`, city)
+
+	db.Exec(`UPDATE shape_infos SET geog = lines.geog FROM (
+		SELECT shape_id, ST_MakeLine(ST_SetSRID(ST_MakePoint(shape_pt_lon, shape_pt_lat), 4326) ORDER BY shape_pt_sequence)::geography AS geog
+		FROM shapes WHERE city_id = ? GROUP BY shape_id HAVING COUNT(*) > 1
+	) AS lines WHERE shape_infos.city_id = ? AND shape_infos.shape_id = lines.shape_id`, city, city)
+}
+
+type stopDistance struct {
+	Stop     `gorm:"embedded"`
+	Distance float64
+}
+
+func toNearbyStops(rows []stopDistance) []models.NearbyStop {
+	nearby := make([]models.NearbyStop, 0, len(rows))
+	for _, row := range rows {
+		nearby = append(nearby, models.NearbyStop{Stop: DbStopToStop(row.Stop), Distance: row.Distance})
+	}
+	return nearby
+}
+
+// Stops of a city whose coordinates fall in the box, cheap enough to narrow
+// down what the in-process queries look at
+func getStopsInBox(db *gorm.DB, city string, box geo.BBox) []models.Stop {
+	var dbStops []Stop
+	db.Table("stops").
+		Where("city_id = ?", city).
+		Where(spatialStops).
+		Where("stop_lat BETWEEN ? AND ?", box.MinLat, box.MaxLat).
+		Where("stop_lon BETWEEN ? AND ?", box.MinLon, box.MaxLon).
+		Order("id").
+		Find(&dbStops)
+
+	stops := make([]models.Stop, 0, len(dbStops))
+	for _, s := range dbStops {
+		stops = append(stops, DbStopToStop(s))
+	}
+	return stops
+}
+
+// GetStopsNearby returns the stops within radius meters of a point, closest
+// first
+func GetStopsNearby(db *gorm.DB, city string, lat, lon, radius float64, limit int) []models.NearbyStop {
+	if !usePostGIS(db) {
+		return models.NearbyStops(getStopsInBox(db, city, geo.BBoxAround(lat, lon, radius)), lat, lon, radius, limit)
+	}
+
+	var rows []stopDistance
+	q := db.Table("stops").
+		Select("stops.*, ST_Distance(geog, "+pointSQL+", false) AS distance", lon, lat).
+		Where("city_id = ?", city).
+		Where(spatialStops).
+		Where("ST_DWithin(geog, "+pointSQL+", ?, false)", lon, lat, radius).
+		Order(`distance, stop_id COLLATE "C"`)
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	q.Scan(&rows)
+
+	return toNearbyStops(rows)
+}
+
+// GetStopsInBBox returns the stops inside a box in feed order
+func GetStopsInBBox(db *gorm.DB, city string, box geo.BBox, limit int) []models.Stop {
+	if !usePostGIS(db) {
+		return models.StopsInBBox(getStopsInBox(db, city, box), box, limit)
+	}
+
+	// The geography box only lets the GiST index narrow things down, the
+	// coordinates decide. Its edges are great circles, which bow towards the
+	// pole and would cut off stops along the edge nearer the equator, so
+	// they get a vertex every 0.01 degrees to follow the parallels.
+	var dbStops []Stop
+	q := db.Table("stops").
+		Where("city_id = ?", city).
+		Where(spatialStops).
+		Where("geog && ST_Segmentize(ST_MakeEnvelope(?, ?, ?, ?, 4326), 0.01)::geography", box.MinLon, box.MinLat, box.MaxLon, box.MaxLat).
+		Where("stop_lat BETWEEN ? AND ?", box.MinLat, box.MaxLat).
+		Where("stop_lon BETWEEN ? AND ?", box.MinLon, box.MaxLon).
+		Order("id")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	q.Find(&dbStops)
+
+	stops := make([]models.Stop, 0, len(dbStops))
+	for _, s := range dbStops {
+		stops = append(stops, DbStopToStop(s))
+	}
+	return stops
+}
+
+// GetStopsAlongRoute returns the stops within distance meters of any shape
+// the route's trips follow, closest first. It returns false when the route
+// doesn't exist.
+func GetStopsAlongRoute(db *gorm.DB, city string, route string, distance float64, limit int) ([]models.NearbyStop, bool) {
+	if _, found := GetRoute(db, city, route); !found {
+		return nil, false
+	}
+
+	if !usePostGIS(db) {
+		lines := GetRouteShapes(db, city, []string{route})[route]
+		box, ok := geo.LinesBBox(lines)
+		if !ok {
+			return []models.NearbyStop{}, true
+		}
+		return models.StopsAlongLines(getStopsInBox(db, city, box.Expand(distance)), lines, distance, limit), true
+	}
+
+	shapeIDs := db.Table("trips").Select("shape_id").Where("city_id = ?", city).Where("route_id = ?", route)
+
+	var rows []stopDistance
+	q := db.Table("stops").
+		Select("stops.*, MIN(ST_Distance(stops.geog, shape_infos.geog, false)) AS distance").
+		Joins("JOIN shape_infos ON shape_infos.city_id = stops.city_id AND ST_DWithin(stops.geog, shape_infos.geog, ?, false)", distance).
+		Where("stops.city_id = ?", city).
+		Where(spatialStops).
+		Where("shape_infos.shape_id IN (?)", shapeIDs).
+		Group("stops.id").
+		Order(`distance, stops.stop_id COLLATE "C"`)
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	q.Scan(&rows)
+
+	return toNearbyStops(rows), true
+}
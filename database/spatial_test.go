@@ -0,0 +1,190 @@
+package database
+
+import (
+	"database/sql"
+	"math"
+	"os"
+	"testing"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const spatialTestCity = "spatial-test"
+
+// Opens the database named by POSTGRES_TEST_DSN and fills it with a few
+// stops and one shaped route. Skips when no DSN is set or PostGIS is missing.
+func openPostGIS(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   logger.Default.LogMode(logger.Error),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []any{&Stop{}, &Route{}, &Trip{}, &Shape{}, &ShapeInfo{}}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+
+	wasPostGIS := postgis
+	setupPostGIS(db)
+	if !postgis {
+		postgis = wasPostGIS
+		t.Skip("PostGIS is not available")
+	}
+
+	clear := func() {
+		for _, table := range tables {
+			db.Unscoped().Where("city_id = ?", spatialTestCity).Delete(table)
+		}
+	}
+	clear()
+	t.Cleanup(func() {
+		clear()
+		postgis = wasPostGIS
+	})
+
+	stops := []Stop{
+		StopToDbStop(models.Stop{StopId: "A", StopLat: 52.2300, StopLon: 21.0100}, spatialTestCity),
+		StopToDbStop(models.Stop{StopId: "B", StopLat: 52.2310, StopLon: 21.0110}, spatialTestCity),
+		StopToDbStop(models.Stop{StopId: "C", StopLat: 52.2330, StopLon: 21.0150, LocationType: models.STATION}, spatialTestCity),
+		StopToDbStop(models.Stop{StopId: "E", StopLat: 52.2301, StopLon: 21.0101, LocationType: models.ENTRANCE_EXIT}, spatialTestCity),
+		StopToDbStop(models.Stop{StopId: "F", StopLat: 52.3000, StopLon: 21.1000}, spatialTestCity),
+		// Same place, ordered by bytes rather than the database's collation
+		StopToDbStop(models.Stop{StopId: "x", StopLat: 52.2320, StopLon: 21.0130}, spatialTestCity),
+		StopToDbStop(models.Stop{StopId: "Y", StopLat: 52.2320, StopLon: 21.0130}, spatialTestCity),
+		// Just inside the southern edge of a box centred on the meridian
+		StopToDbStop(models.Stop{StopId: "G", StopLat: 51.0005, StopLon: 0}, spatialTestCity),
+		// Imported without coordinates
+		StopToDbStop(models.Stop{StopId: "Z"}, spatialTestCity),
+		{CityId: spatialTestCity, StopId: "N", StopLat: sql.NullFloat64{}, StopLon: sql.NullFloat64{}},
+	}
+	db.Create(&stops)
+
+	db.Create(&[]Route{RouteToDbRoute(models.Route{RouteId: "R"}, spatialTestCity)})
+	db.Create(&[]Trip{TripToDbTrip(models.Trip{TripId: "T", RouteId: "R", ShapeId: "SH"}, spatialTestCity)})
+
+	points := []models.Shape{
+		{ShapeId: "SH", ShapePtLat: 52.2295, ShapePtLon: 21.0090, ShapePtSequence: 1},
+		{ShapeId: "SH", ShapePtLat: 52.2315, ShapePtLon: 21.0120, ShapePtSequence: 2},
+		{ShapeId: "SH", ShapePtLat: 52.2335, ShapePtLon: 21.0160, ShapePtSequence: 3},
+	}
+	var dbShapes []Shape
+	for _, p := range points {
+		dbShapes = append(dbShapes, ShapeToDbShape(p, spatialTestCity))
+	}
+	db.Create(&dbShapes)
+	db.Create(&[]ShapeInfo{ShapeInfoToDbShapeInfo(models.ComputeShapeInfos(points)[0], spatialTestCity)})
+
+	indexGeometries(db, spatialTestCity)
+
+	return db
+}
+
+// Runs fn once through PostGIS and once in process
+func bothWays[T any](fn func() T) (withPostGIS T, inProcess T) {
+	postgis = true
+	withPostGIS = fn()
+	postgis = false
+	inProcess = fn()
+	postgis = true
+	return withPostGIS, inProcess
+}
+
+func compareNearby(t *testing.T, name string, got, want []models.NearbyStop) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("%s: PostGIS returned %d stops, in process %d", name, len(got), len(want))
+		return
+	}
+	for i := range got {
+		if got[i].Stop != want[i].Stop {
+			t.Errorf("%s[%d]: PostGIS returned %s, in process %s", name, i, got[i].Stop.StopId, want[i].Stop.StopId)
+		}
+		if math.Abs(got[i].Distance-want[i].Distance) > 1 {
+			t.Errorf("%s[%d]: PostGIS distance %.2f, in process %.2f", name, i, got[i].Distance, want[i].Distance)
+		}
+	}
+}
+
+func TestPostGISMatchesInProcess(t *testing.T) {
+	db := openPostGIS(t)
+
+	nearby := []struct {
+		name     string
+		lat, lon float64
+		radius   float64
+		limit    int
+	}{
+		{"around A", 52.2300, 21.0100, 500, 0},
+		{"around A limited", 52.2300, 21.0100, 500, 2},
+		{"far", 52.2300, 21.0100, 20000, 0},
+		{"null island", 0.0001, 0.0001, 1000, 0},
+	}
+	for _, tc := range nearby {
+		got, want := bothWays(func() []models.NearbyStop {
+			return GetStopsNearby(db, spatialTestCity, tc.lat, tc.lon, tc.radius, tc.limit)
+		})
+		compareNearby(t, "nearby "+tc.name, got, want)
+	}
+
+	boxes := []struct {
+		name  string
+		box   geo.BBox
+		limit int
+	}{
+		{"center", geo.BBox{MinLat: 52.22, MinLon: 21.00, MaxLat: 52.24, MaxLon: 21.02}, 0},
+		{"center limited", geo.BBox{MinLat: 52.22, MinLon: 21.00, MaxLat: 52.24, MaxLon: 21.02}, 1},
+		{"null island", geo.BBox{MinLat: -1, MinLon: -1, MaxLat: 1, MaxLon: 1}, 0},
+		{"across the meridian", geo.BBox{MinLat: 51, MinLon: -1, MaxLat: 52, MaxLon: 1}, 0},
+	}
+	for _, tc := range boxes {
+		got, want := bothWays(func() []models.Stop {
+			return GetStopsInBBox(db, spatialTestCity, tc.box, tc.limit)
+		})
+		if len(got) != len(want) {
+			t.Errorf("bbox %s: PostGIS returned %d stops, in process %d", tc.name, len(got), len(want))
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("bbox %s[%d]: PostGIS returned %s, in process %s", tc.name, i, got[i].StopId, want[i].StopId)
+			}
+		}
+	}
+
+	// Both ways missing the stop would agree too
+	if stops := GetStopsInBBox(db, spatialTestCity, boxes[3].box, 0); len(stops) != 1 || stops[0].StopId != "G" {
+		t.Errorf("expected G in the box across the meridian, got %v", stops)
+	}
+
+	for _, distance := range []float64{50, 200, 1000} {
+		type along struct {
+			stops []models.NearbyStop
+			found bool
+		}
+		got, want := bothWays(func() along {
+			stops, found := GetStopsAlongRoute(db, spatialTestCity, "R", distance, 0)
+			return along{stops, found}
+		})
+		if !got.found || !want.found {
+			t.Fatalf("route R not found: PostGIS %v, in process %v", got.found, want.found)
+		}
+		compareNearby(t, "along route", got.stops, want.stops)
+	}
+
+	if _, found := GetStopsAlongRoute(db, spatialTestCity, "missing", 100, 0); found {
+		t.Error("unknown route was found")
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+)
+
+func GetStop(db *gorm.DB, city string, id string) (models.Stop, bool) {
+	var dbStop Stop
+
+	res := db.Table("stops").Where("city_id = ?", city).Where("stop_id = ?", id).Limit(1).Find(&dbStop)
+	if res.RowsAffected == 0 {
+		return models.Stop{}, false
+	}
+
+	return DbStopToStop(dbStop), true
+}
+
+// Stops belonging to a station: its platforms, entrances and nodes, and the
+// boarding areas of those platforms.
+func getStationStops(db *gorm.DB, city string, station string) []models.Stop {
+	var dbStops []Stop
+	var stops []models.Stop
+
+	db.Table("stops").Where("city_id = ?", city).Where("parent_station = ?", station).Find(&dbStops)
+
+	var platformIDs []string
+	for _, dbStop := range dbStops {
+		stops = append(stops, DbStopToStop(dbStop))
+		platformIDs = append(platformIDs, dbStop.StopId)
+	}
+
+	if len(platformIDs) > 0 {
+		var dbBoardingAreas []Stop
+		db.Table("stops").
+			Where("city_id = ?", city).
+			Where("parent_station IN ?", platformIDs).
+			Where("location_type = ?", models.BOARDING).
+			Find(&dbBoardingAreas)
+
+		for _, dbStop := range dbBoardingAreas {
+			stops = append(stops, DbStopToStop(dbStop))
+		}
+	}
+
+	return stops
+}
+
+// resolveStopIDs returns the platforms of a station, or just the stop itself
+// when it isn't one
+func resolveStopIDs(db *gorm.DB, city string, stop string) []string {
+	stopIDs := []string{stop}
+
+	var locationType []int16
+	db.Table("stops").Where("city_id = ?", city).Where("stop_id = ?", stop).Limit(1).Pluck("location_type", &locationType)
+	if len(locationType) == 0 || models.Location(locationType[0]) != models.STATION {
+		return stopIDs
+	}
+
+	var children []string
+	db.Table("stops").
+		Where("city_id = ?", city).
+		Where("parent_station = ?", stop).
+		Where("location_type = ? OR location_type IS NULL", models.STOP).
+		Pluck("stop_id", &children)
+
+	return append(stopIDs, children...)
+}
+
+func GetStation(db *gorm.DB, city string, id string) (models.Station, bool) {
+	stop, ok := GetStop(db, city, id)
+	if !ok || stop.LocationType != models.STATION {
+		return models.Station{}, false
+	}
+
+	stops := getStationStops(db, city, id)
+	stopIDs := []string{id}
+	levelIDs := []string{}
+	if stop.LevelId != "" {
+		levelIDs = append(levelIDs, stop.LevelId)
+	}
+	for _, s := range stops {
+		stopIDs = append(stopIDs, s.StopId)
+		if s.LevelId != "" {
+			levelIDs = append(levelIDs, s.LevelId)
+		}
+	}
+
+	var levels []models.Level
+	if len(levelIDs) > 0 {
+		var dbLevels []Level
+		db.Model(&Level{}).Where("city_id = ?", city).Where("level_id IN ?", levelIDs).Order("level_index").Find(&dbLevels)
+		for _, dbLevel := range dbLevels {
+			levels = append(levels, DbLevelToLevel(dbLevel))
+		}
+	}
+
+	var pathways []models.Pathway
+	var dbPathways []Pathway
+	db.Model(&Pathway{}).
+		Where("city_id = ?", city).
+		Where("from_stop_id IN ? OR to_stop_id IN ?", stopIDs, stopIDs).
+		Order("id").
+		Find(&dbPathways)
+	for _, dbPathway := range dbPathways {
+		pathways = append(pathways, DbPathwayToPathway(dbPathway))
+	}
+
+	return models.NewStation(stop, stops, levels, pathways), true
+}
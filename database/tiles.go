@@ -0,0 +1,74 @@
+package database
+
+import (
+	"maps"
+	"slices"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/tiles"
+	"gorm.io/gorm"
+)
+
+// Tiles are cached until the city is imported again
+var tileCache = tiles.NewCache(10000)
+
+func clearTiles(city string) {
+	tileCache.Clear(city)
+}
+
+func loadTileSource(db *gorm.DB, city string) *tiles.Source {
+	var stops []models.Stop
+	GetStops(db, city, models.ListQuery{}, func(stop models.Stop) error {
+		stops = append(stops, stop)
+		return nil
+	})
+
+	routes := make(map[string]models.Route)
+	GetRoutes(db, city, models.ListQuery{}, func(route models.Route) error {
+		routes[route.RouteId] = route
+		return nil
+	})
+
+	var pairs []struct {
+		RouteId string
+		ShapeId string
+	}
+	db.Table("trips").Where("city_id = ?", city).Where("shape_id IS NOT NULL AND shape_id <> ''").
+		Distinct("route_id", "shape_id").Order("shape_id").Order("route_id").Scan(&pairs)
+
+	shapeRoutes := make(map[string][]models.Route)
+	for _, pair := range pairs {
+		if route, ok := routes[pair.RouteId]; ok {
+			shapeRoutes[pair.ShapeId] = append(shapeRoutes[pair.ShapeId], route)
+		}
+	}
+
+	infos := make(map[string]models.ShapeInfo)
+	for _, info := range GetShapeInfos(db, city) {
+		infos[info.ShapeId] = info
+	}
+
+	var shapes []tiles.Shape
+	for _, shapeID := range slices.Sorted(maps.Keys(shapeRoutes)) {
+		info, ok := infos[shapeID]
+		if !ok || info.PointCount < 2 {
+			continue
+		}
+
+		shapes = append(shapes, tiles.Shape{
+			Points: models.ShapePoints(GetShapeById(db, city, shapeID)),
+			SW:     [2]float64{info.MinLat, info.MinLon},
+			NE:     [2]float64{info.MaxLat, info.MaxLon},
+			Routes: shapeRoutes[shapeID],
+		})
+	}
+
+	return tiles.NewSource(stops, shapes)
+}
+
+// GetTile renders a Mapbox Vector Tile with a "stops" and a "routes" layer
+func GetTile(db *gorm.DB, city string, z, x, y int) []byte {
+	return tileCache.Tile(city, z, x, y, func() *tiles.Source {
+		return loadTileSource(db, city)
+	})
+}
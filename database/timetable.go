@@ -0,0 +1,55 @@
+package database
+
+import (
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+)
+
+func GetTimetable(db *gorm.DB, city string, route string, date time.Time, direction models.Direction) (models.Timetable, bool) {
+	r, ok := GetRoute(db, city, route)
+	if !ok {
+		return models.Timetable{}, false
+	}
+
+	timetable := models.Timetable{
+		Route:       r,
+		Date:        date.Format("2006-01-02"),
+		DirectionId: direction,
+	}
+
+	services := GetActiveServicesForDate(db, city, date)
+
+	var trips []models.Trip
+	for _, trip := range GetTripsForRoute(db, city, route) {
+		if trip.DirectionId == direction && services[trip.ServiceId] {
+			trips = append(trips, trip)
+		}
+	}
+	if len(trips) == 0 {
+		return timetable, true
+	}
+
+	tripIDs := make([]string, 0, len(trips))
+	for _, trip := range trips {
+		tripIDs = append(tripIDs, trip.TripId)
+	}
+
+	var dbDeps []Departure
+	db.Model(&Departure{}).
+		Where("city_id = ?", city).
+		Where("trip_id IN ?", tripIDs).
+		Order("trip_id, stop_sequence").
+		Find(&dbDeps)
+
+	stopTimes := make(map[string][]models.Departure)
+	for _, dbDep := range dbDeps {
+		dep := DbDepartureToDeparture(dbDep)
+		stopTimes[dep.TripId] = append(stopTimes[dep.TripId], dep)
+	}
+
+	return models.BuildTimetable(timetable, trips, stopTimes, GetFrequenciesForTrips(db, city, tripIDs), func(stopIDs []string) map[string]models.Stop {
+		return getStopsByID(db, city, stopIDs)
+	}), true
+}
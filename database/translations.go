@@ -0,0 +1,113 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+)
+
+// Languages of a city, the feed one and those it has translations for
+type cityLanguages struct {
+	feed      string
+	available []string
+}
+
+var (
+	translators      = make(map[string]*models.Translator)
+	languageSets     = make(map[string]cityLanguages)
+	translatorsMutex sync.RWMutex
+)
+
+func clearTranslators(city string) {
+	translatorsMutex.Lock()
+	defer translatorsMutex.Unlock()
+
+	delete(languageSets, city)
+	for key := range translators {
+		if strings.HasPrefix(key, city+"/") {
+			delete(translators, key)
+		}
+	}
+}
+
+func GetFeedInfo(db *gorm.DB, city string) models.FeedInfo {
+	var dbInfo FeedInfo
+	db.Model(&FeedInfo{}).Where("city_id = ?", city).Limit(1).Find(&dbInfo)
+
+	return DbFeedInfoToFeedInfo(dbInfo)
+}
+
+// GetTranslations returns every translation of a city, in all languages
+func GetTranslations(db *gorm.DB, city string) []models.Translation {
+	var dbTranslations []Translation
+	db.Model(&Translation{}).Where("city_id = ?", city).Find(&dbTranslations)
+
+	translations := make([]models.Translation, 0, len(dbTranslations))
+	for _, dbTranslation := range dbTranslations {
+		translations = append(translations, DbTranslationToTranslation(dbTranslation))
+	}
+	return translations
+}
+
+// GetTranslator returns a translator for the first of the requested
+// languages the city has translations for. It returns nil when the best
+// match is the feed language itself or nothing matches.
+func GetTranslator(db *gorm.DB, city string, languages []string) *models.Translator {
+	if len(languages) == 0 {
+		return nil
+	}
+
+	langs := getCityLanguages(db, city)
+	if lang := models.PickLanguage(languages, langs.feed, langs.available); lang != "" {
+		return loadTranslator(db, city, lang)
+	}
+	return nil
+}
+
+func getCityLanguages(db *gorm.DB, city string) cityLanguages {
+	translatorsMutex.RLock()
+	langs, ok := languageSets[city]
+	translatorsMutex.RUnlock()
+	if ok {
+		return langs
+	}
+
+	langs.feed = GetFeedInfo(db, city).Language()
+	db.Model(&Translation{}).Where("city_id = ?", city).Distinct().Pluck("LOWER(language)", &langs.available)
+	slices.Sort(langs.available)
+
+	translatorsMutex.Lock()
+	languageSets[city] = langs
+	translatorsMutex.Unlock()
+
+	return langs
+}
+
+func loadTranslator(db *gorm.DB, city string, lang string) *models.Translator {
+	key := city + "/" + lang
+
+	translatorsMutex.RLock()
+	t, ok := translators[key]
+	translatorsMutex.RUnlock()
+	if ok {
+		return t
+	}
+
+	var dbTranslations []Translation
+	db.Model(&Translation{}).Where("city_id = ?", city).Where("LOWER(language) = ?", lang).Find(&dbTranslations)
+
+	translations := make([]models.Translation, 0, len(dbTranslations))
+	for _, dbTranslation := range dbTranslations {
+		translations = append(translations, DbTranslationToTranslation(dbTranslation))
+	}
+	t = models.NewTranslator(lang, translations)
+
+	translatorsMutex.Lock()
+	translators[key] = t
+	translatorsMutex.Unlock()
+
+	return t
+}
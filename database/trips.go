@@ -0,0 +1,124 @@
+package database
+
+import (
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"gorm.io/gorm"
+)
+
+func GetTrip(db *gorm.DB, city string, id string) (models.Trip, models.Route, bool) {
+	var dbTrip Trip
+
+	res := db.Model(&Trip{}).
+		Preload("Route").
+		Where("city_id = ?", city).
+		Where("trip_id = ?", id).
+		Limit(1).
+		Find(&dbTrip)
+	if res.RowsAffected == 0 {
+		return models.Trip{}, models.Route{}, false
+	}
+
+	return DbTripToTrip(dbTrip), DbRouteToRoute(dbTrip.Route), true
+}
+
+func GetStopTimesForTrip(db *gorm.DB, city string, id string) []models.TripStopTime {
+	var dbDeps []Departure
+	var stopTimes []models.TripStopTime
+
+	db.Model(&Departure{}).
+		Preload("Stop").
+		Where("city_id = ?", city).
+		Where("trip_id = ?", id).
+		Order("stop_sequence").
+		Find(&dbDeps)
+
+	for _, dbDep := range dbDeps {
+		dep := DbDepartureToDeparture(dbDep)
+		stopTimes = append(stopTimes, models.TripStopTime{
+			Stop:              DbStopToStop(dbDep.Stop),
+			ArrivalTime:       dep.ArrivalTime,
+			DepartureTime:     dep.DepartureTime,
+			StopSequence:      dep.StopSequence,
+			StopHeadsign:      dep.StopHeadsign,
+			PickupType:        dep.PickupType,
+			DropoffType:       dep.DropoffType,
+			Timepoint:         dep.Timepoint,
+			ShapeDistTraveled: dep.ShapeDistTraveled,
+			ShapeDistance:     dep.ShapeDistance,
+			ContinuousPickup:  dep.ContinuousPickup,
+			ContinuousDropOff: dep.ContinuousDropOff,
+			Interpolated:      dep.Interpolated,
+		})
+	}
+
+	return stopTimes
+}
+
+// GetServiceDates lists the days a service runs on, in order
+func GetServiceDates(db *gorm.DB, city string, service string) []time.Time {
+	var days []string
+	db.Model(&ServiceDate{}).
+		Where("city_id = ?", city).
+		Where("service_id = ?", service).
+		Order("date").
+		Pluck("date", &days)
+
+	dates := make([]time.Time, 0, len(days))
+	for _, day := range days {
+		if d, err := time.ParseInLocation(serviceDateFormat, day, time.Local); err == nil {
+			dates = append(dates, d)
+		}
+	}
+
+	return dates
+}
+
+// GetTripDetail returns everything needed to show a single trip. With
+// polylinePrecision above zero the shape is returned encoded instead of as points.
+func GetTripDetail(db *gorm.DB, city string, id string, polylinePrecision int) (models.TripDetail, bool) {
+	trip, route, ok := GetTrip(db, city, id)
+	if !ok {
+		return models.TripDetail{}, false
+	}
+
+	detail := models.TripDetail{
+		Trip:      trip,
+		Route:     route,
+		StopTimes: GetStopTimesForTrip(db, city, id),
+	}
+
+	detail.Frequencies = GetFrequenciesForTrips(db, city, []string{id})[id]
+
+	for _, d := range GetServiceDates(db, city, trip.ServiceId) {
+		detail.ServiceDates = append(detail.ServiceDates, d.Format("2006-01-02"))
+	}
+
+	if trip.ShapeId != "" {
+		shape := GetShapeById(db, city, trip.ShapeId)
+		if polylinePrecision > 0 {
+			detail.Polyline = geo.EncodePolyline(models.ShapePoints(shape), polylinePrecision)
+		} else {
+			detail.Shape = shape
+		}
+	}
+
+	return detail, true
+}
+
+// GetTripShapeSegment cuts the trip's shape between two of its stops using
+// the distances snapped on import. An empty fromStop starts at the first
+// stop, an empty toStop ends at the last one.
+func GetTripShapeSegment(db *gorm.DB, city string, id string, fromStop string, toStop string, polylinePrecision int) (models.ShapeSegment, error) {
+	trip, _, ok := GetTrip(db, city, id)
+	if !ok {
+		return models.ShapeSegment{}, models.ErrTripNotFound
+	}
+	if trip.ShapeId == "" {
+		return models.ShapeSegment{}, models.ErrTripNoShape
+	}
+
+	return models.CutShapeSegment(trip, GetStopTimesForTrip(db, city, id), GetShapeById(db, city, trip.ShapeId), fromStop, toStop, polylinePrecision)
+}
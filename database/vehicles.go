@@ -0,0 +1,246 @@
+package database
+
+import (
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+	"gorm.io/gorm"
+)
+
+// Shape locators are built once per shape and kept until the city is
+// imported again
+var (
+	locators      = make(map[string]*geo.LineLocator)
+	locatorsMutex sync.RWMutex
+)
+
+func clearLocators(city string) {
+	locatorsMutex.Lock()
+	defer locatorsMutex.Unlock()
+
+	for key := range locators {
+		if strings.HasPrefix(key, city+"/") {
+			delete(locators, key)
+		}
+	}
+}
+
+func getLocator(db *gorm.DB, city string, shapeID string) *geo.LineLocator {
+	key := city + "/" + shapeID
+
+	locatorsMutex.RLock()
+	locator, ok := locators[key]
+	locatorsMutex.RUnlock()
+	if ok {
+		return locator
+	}
+
+	locator = geo.NewLineLocator(models.ShapePoints(GetShapeById(db, city, shapeID)))
+
+	locatorsMutex.Lock()
+	locators[key] = locator
+	locatorsMutex.Unlock()
+
+	return locator
+}
+
+// First departure and last arrival of a trip in seconds, and its last
+// stop_sequence
+type tripSpan struct {
+	start    int
+	end      int
+	timed    bool
+	lastStop int
+}
+
+// addTripSpan widens the span of a trip to cover one of its stop times
+func addTripSpan(spans map[string]tripSpan, dep models.Departure) {
+	span, seen := spans[dep.TripId]
+	if !seen || dep.StopSequence > span.lastStop {
+		span.lastStop = dep.StopSequence
+	}
+
+	if departure, ok := utils.ParseGTFSTime(dep.DepartureTime); ok {
+		arrival, ok := utils.ParseGTFSTime(dep.ArrivalTime)
+		if !ok {
+			arrival = departure
+		}
+
+		if span.timed {
+			span.start, span.end = min(span.start, departure), max(span.end, arrival, departure)
+		} else {
+			span.start, span.end, span.timed = departure, max(arrival, departure), true
+		}
+	}
+
+	spans[dep.TripId] = span
+}
+
+// storeTripSpans saves the spans on the trips, so finding the trips running
+// at a moment or a trip's last stop doesn't have to aggregate their stop times
+func storeTripSpans(db *gorm.DB, city string, spans map[string]tripSpan) {
+	ids := slices.Sorted(maps.Keys(spans))
+
+	db.Transaction(func(tx *gorm.DB) error {
+		for chunk := range slices.Chunk(ids, shapeQueryChunk) {
+			// The casts type the VALUES columns on Postgres
+			values := make([]string, 0, len(chunk))
+			args := make([]any, 0, 4*len(chunk)+1)
+			for _, id := range chunk {
+				span := spans[id]
+				start, end := sql.NullInt32{Int32: int32(span.start), Valid: span.timed}, sql.NullInt32{Int32: int32(span.end), Valid: span.timed}
+				values = append(values, "(CAST(? AS TEXT), CAST(? AS INTEGER), CAST(? AS INTEGER), CAST(? AS INTEGER))")
+				args = append(args, id, start, end, span.lastStop)
+			}
+
+			tx.Exec("UPDATE trips SET start_secs = v.column2, end_secs = v.column3, last_stop_sequence = v.column4 FROM (VALUES "+strings.Join(values, ", ")+") AS v "+
+				"WHERE trips.city_id = ? AND trips.trip_id = v.column1", append(args, city)...)
+		}
+		return nil
+	})
+}
+
+// Stop times of the given trips with their times parsed, in stop order
+func getScheduledStops(db *gorm.DB, city string, tripIDs []string) map[string][]models.ScheduledStop {
+	stops := make(map[string][]models.ScheduledStop)
+
+	for chunk := range slices.Chunk(tripIDs, shapeQueryChunk) {
+		var dbDeps []Departure
+		db.Model(&Departure{}).
+			Preload("Stop").
+			Where("city_id = ?", city).
+			Where("trip_id IN ?", chunk).
+			Order("trip_id, stop_sequence").
+			Find(&dbDeps)
+
+		for _, dbDep := range dbDeps {
+			dep := DbDepartureToDeparture(dbDep)
+			if stop, ok := models.NewScheduledStop(dep, DbStopToStop(dbDep.Stop)); ok {
+				stops[dep.TripId] = append(stops[dep.TripId], stop)
+			}
+		}
+	}
+
+	return stops
+}
+
+// Runs of trips active on one service day, secs counts from the start of
+// that day and goes past 24:00:00 for the previous day's trips
+func scheduledRuns(db *gorm.DB, city string, date time.Time, secs int) []models.ScheduledRun {
+	var runs []models.ScheduledRun
+
+	var tripIDs []string
+	joinServiceDate(db.Model(&Trip{}), date).
+		Where("trips.city_id = ?", city).
+		Where("trips.trip_id NOT IN (?)", frequencyTrips(db, city)).
+		Where("trips.start_secs <= ? AND trips.end_secs >= ?", secs, secs).
+		Pluck("trips.trip_id", &tripIDs)
+
+	for _, id := range tripIDs {
+		runs = append(runs, models.ScheduledRun{TripId: id})
+	}
+
+	// Headway-based trips: every instance whose run spans the moment
+	var freqTrips []struct {
+		TripId    string
+		StartSecs int
+		EndSecs   int
+	}
+	joinServiceDate(db.Model(&Trip{}), date).
+		Select("trips.trip_id, trips.start_secs, trips.end_secs").
+		Where("trips.city_id = ?", city).
+		Where("trips.trip_id IN (?)", frequencyTrips(db, city)).
+		Where("trips.start_secs IS NOT NULL").
+		Scan(&freqTrips)
+	if len(freqTrips) == 0 {
+		return runs
+	}
+
+	freqTripIDs := make([]string, len(freqTrips))
+	for i, trip := range freqTrips {
+		freqTripIDs[i] = trip.TripId
+	}
+	freqs := GetFrequenciesForTrips(db, city, freqTripIDs)
+
+	for _, trip := range freqTrips {
+		runs = append(runs, models.HeadwayRuns(trip.TripId, trip.StartSecs, trip.EndSecs, freqs[trip.TripId], secs)...)
+	}
+
+	return runs
+}
+
+// GetScheduledVehicles estimates where every trip running at the given
+// moment would be if it kept exactly to the timetable. secs is the time of
+// day on date in seconds.
+func GetScheduledVehicles(db *gorm.DB, city string, date time.Time, secs int) []models.VehiclePosition {
+	var vehicles []models.VehiclePosition
+
+	// Trips running past midnight belong to the previous day's services
+	days := []struct {
+		date time.Time
+		secs int
+	}{
+		{date, secs},
+		{date.AddDate(0, 0, -1), secs + 24*3600},
+	}
+
+	for _, day := range days {
+		runs := scheduledRuns(db, city, day.date, day.secs)
+		if len(runs) == 0 {
+			continue
+		}
+
+		tripIDs := make([]string, 0, len(runs))
+		for _, run := range runs {
+			if !slices.Contains(tripIDs, run.TripId) {
+				tripIDs = append(tripIDs, run.TripId)
+			}
+		}
+
+		stops := getScheduledStops(db, city, tripIDs)
+
+		trips := make(map[string]Trip)
+		for chunk := range slices.Chunk(tripIDs, shapeQueryChunk) {
+			var dbTrips []Trip
+			db.Model(&Trip{}).Preload("Route").Where("city_id = ?", city).Where("trip_id IN ?", chunk).Find(&dbTrips)
+			for _, dbTrip := range dbTrips {
+				trips[dbTrip.TripId] = dbTrip
+			}
+		}
+
+		for _, run := range runs {
+			dbTrip, ok := trips[run.TripId]
+			if !ok || len(stops[run.TripId]) == 0 {
+				continue
+			}
+			trip := DbTripToTrip(dbTrip)
+
+			var locator *geo.LineLocator
+			if trip.ShapeId != "" {
+				locator = getLocator(db, city, trip.ShapeId)
+			}
+
+			v, ok := models.EstimatePosition(stops[run.TripId], day.secs-run.Offset, locator)
+			if !ok {
+				continue
+			}
+
+			v.Trip = trip
+			v.Route = DbRouteToRoute(dbTrip.Route)
+			v.StartTime = utils.FormatGTFSTime(stops[run.TripId][0].Departure + run.Offset)
+			v.FrequencyBased = run.FrequencyBased
+			vehicles = append(vehicles, v)
+		}
+	}
+
+	models.SortVehicles(vehicles)
+
+	return vehicles
+}
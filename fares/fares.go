@@ -0,0 +1,365 @@
+package fares
+
+import (
+	"slices"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+)
+
+// Leg is a single ride of an itinerary. Times are seconds since the start
+// of the service day.
+type Leg struct {
+	RouteId    string
+	FromStopId string
+	ToStopId   string
+	Departure  int
+	Arrival    int
+}
+
+// Data holds the Fares v2 rules of a city. StopAreas and RouteNetworks only
+// need to cover the stops and routes of the legs being priced.
+type Data struct {
+	Products      []models.FareProduct
+	LegRules      []models.FareLegRule
+	TransferRules []models.FareTransferRule
+	Timeframes    []models.Timeframe
+	StopAreas     map[string][]string
+	RouteNetworks map[string][]string
+}
+
+type LegFare struct {
+	Leg             int
+	LegGroupId      string
+	Product         *models.FareProduct
+	Transfer        *models.FareTransferRule
+	TransferProduct *models.FareProduct
+	Amount          float64
+	Currency        string
+}
+
+// Total and Currency are only set when every leg is priced in the same
+// currency, Totals holds the sum per currency. None of them are set when a
+// transfer couldn't be priced, as the legs would add up to the wrong amount.
+type Result struct {
+	Total    float64
+	Currency string
+	Totals   map[string]float64
+	// False when at least one leg matched no fare leg rule or a transfer
+	// couldn't be priced
+	Complete bool
+	Legs     []LegFare
+}
+
+type Calculator struct {
+	data       Data
+	products   map[string][]models.FareProduct
+	timeframes map[string][]models.Timeframe
+	// Whether the feed has a rule_priority column, which changes how rules
+	// leaving a field empty match
+	prioritized bool
+}
+
+func NewCalculator(data Data) *Calculator {
+	c := &Calculator{
+		data:       data,
+		products:   make(map[string][]models.FareProduct),
+		timeframes: make(map[string][]models.Timeframe),
+	}
+
+	for _, product := range data.Products {
+		c.products[product.FareProductId] = append(c.products[product.FareProductId], product)
+	}
+	for _, tf := range data.Timeframes {
+		c.timeframes[tf.TimeframeGroupId] = append(c.timeframes[tf.TimeframeGroupId], tf)
+	}
+	c.prioritized = slices.ContainsFunc(data.LegRules, func(r models.FareLegRule) bool {
+		return r.RulePriority != nil
+	})
+
+	return c
+}
+
+// Calculate prices an itinerary. activeServices[d] are the services running
+// d days after the travel date, used for timeframes: a leg at 25:00 is
+// matched against the services of the next day. media restricts the
+// products to one fare medium, empty means the cheapest one available.
+func (c *Calculator) Calculate(legs []Leg, activeServices []map[string]bool, media string) Result {
+	result := Result{Complete: true}
+	priced := true
+
+	// Index of the first leg of the current transfer sequence and the
+	// number of transfers made within it
+	seqStart := -1
+	transfers := 0
+
+	for i, leg := range legs {
+		lf := LegFare{Leg: i}
+
+		rule, product := c.cheapestLegRule(leg, activeServices, media)
+		if rule == nil {
+			result.Complete = false
+			result.Legs = append(result.Legs, lf)
+			seqStart = -1
+			continue
+		}
+
+		lf.LegGroupId = rule.LegGroupId
+		lf.Product = product
+		lf.Amount = product.Amount
+		lf.Currency = product.Currency
+
+		if seqStart >= 0 && seqStart < i {
+			prev := &result.Legs[i-1]
+			transfer := c.findTransfer(prev.LegGroupId, lf.LegGroupId, transfers, legs[seqStart], legs[i-1], leg)
+			if transfer != nil {
+				lf.Transfer = transfer
+				lf.TransferProduct = c.cheapestProduct(transfer.FareProductId, media)
+
+				var transferAmount float64
+				transferCurrency := product.Currency
+				if lf.TransferProduct != nil {
+					transferAmount = lf.TransferProduct.Amount
+					transferCurrency = lf.TransferProduct.Currency
+				}
+
+				switch transfer.FareTransferType {
+				case models.A_PLUS_AB:
+					lf.Amount = transferAmount
+					lf.Currency = transferCurrency
+				case models.A_PLUS_AB_PLUS_B:
+					// Adding up only makes sense within one currency, a
+					// transfer priced in another one can't be applied
+					if transferCurrency == product.Currency {
+						lf.Amount = transferAmount + product.Amount
+					} else {
+						result.Complete = false
+						priced = false
+					}
+				case models.AB:
+					// The transfer product replaces the fare of the previous leg
+					prev.Amount = 0
+					lf.Amount = transferAmount
+					lf.Currency = transferCurrency
+				}
+
+				transfers++
+			} else {
+				seqStart = i
+				transfers = 0
+			}
+		} else {
+			seqStart = i
+			transfers = 0
+		}
+
+		result.Legs = append(result.Legs, lf)
+	}
+
+	if !priced {
+		return result
+	}
+
+	result.Totals = make(map[string]float64)
+	for _, lf := range result.Legs {
+		if lf.Currency != "" {
+			result.Totals[lf.Currency] += lf.Amount
+		}
+	}
+
+	// Amounts in different currencies don't add up
+	if len(result.Totals) == 1 {
+		for currency, total := range result.Totals {
+			result.Currency = currency
+			result.Total = total
+		}
+	}
+
+	return result
+}
+
+func (c *Calculator) cheapestLegRule(leg Leg, activeServices []map[string]bool, media string) (*models.FareLegRule, *models.FareProduct) {
+	var (
+		bestRule    *models.FareLegRule
+		bestProduct *models.FareProduct
+	)
+
+	for _, rule := range c.matchLegRules(leg, activeServices) {
+		product := c.cheapestProduct(rule.FareProductId, media)
+		if product == nil {
+			continue
+		}
+		if bestProduct == nil || product.Amount < bestProduct.Amount {
+			bestRule = &rule
+			bestProduct = product
+		}
+	}
+
+	return bestRule, bestProduct
+}
+
+// Follows the spec. Without a rule_priority column a rule naming the leg's
+// network or area wins over a rule leaving it empty. With one, an empty
+// field matches any value and only the highest rule_priority among matches
+// counts.
+func (c *Calculator) matchLegRules(leg Leg, activeServices []map[string]bool) []models.FareLegRule {
+	rules := c.data.LegRules
+
+	fields := []struct {
+		field  func(models.FareLegRule) string
+		values []string
+	}{
+		{func(r models.FareLegRule) string { return r.NetworkId }, c.data.RouteNetworks[leg.RouteId]},
+		{func(r models.FareLegRule) string { return r.FromAreaId }, c.data.StopAreas[leg.FromStopId]},
+		{func(r models.FareLegRule) string { return r.ToAreaId }, c.data.StopAreas[leg.ToStopId]},
+	}
+	for _, f := range fields {
+		if c.prioritized {
+			rules = slices.DeleteFunc(slices.Clone(rules), func(r models.FareLegRule) bool {
+				v := f.field(r)
+				return v != "" && !slices.Contains(f.values, v)
+			})
+		} else {
+			rules = narrow(rules, f.field, f.values)
+		}
+	}
+
+	var matched []models.FareLegRule
+	for _, rule := range rules {
+		if rule.FromTimeframeGroupId != "" && !c.inTimeframe(rule.FromTimeframeGroupId, leg.Departure, activeServices) {
+			continue
+		}
+		if rule.ToTimeframeGroupId != "" && !c.inTimeframe(rule.ToTimeframeGroupId, leg.Arrival, activeServices) {
+			continue
+		}
+		matched = append(matched, rule)
+	}
+
+	if !c.prioritized || len(matched) == 0 {
+		return matched
+	}
+
+	priority := func(r models.FareLegRule) int {
+		if r.RulePriority == nil {
+			return 0
+		}
+		return *r.RulePriority
+	}
+
+	maxPriority := priority(matched[0])
+	for _, rule := range matched {
+		maxPriority = max(maxPriority, priority(rule))
+	}
+
+	return slices.DeleteFunc(matched, func(r models.FareLegRule) bool {
+		return priority(r) != maxPriority
+	})
+}
+
+func narrow(rules []models.FareLegRule, field func(models.FareLegRule) string, values []string) []models.FareLegRule {
+	var specific, generic []models.FareLegRule
+
+	for _, rule := range rules {
+		v := field(rule)
+		if v == "" {
+			generic = append(generic, rule)
+		} else if slices.Contains(values, v) {
+			specific = append(specific, rule)
+		}
+	}
+
+	if len(specific) > 0 {
+		return specific
+	}
+	return generic
+}
+
+// Times past midnight are checked against the next day's timeframes
+func (c *Calculator) inTimeframe(group string, t int, activeServices []map[string]bool) bool {
+	day, secs := t/86400, t%86400
+	if day >= len(activeServices) {
+		return false
+	}
+
+	for _, tf := range c.timeframes[group] {
+		if !activeServices[day][tf.ServiceId] {
+			continue
+		}
+
+		start, end := 0, 86400
+		if s, ok := utils.ParseGTFSTime(tf.StartTime); ok {
+			start = s
+		}
+		if e, ok := utils.ParseGTFSTime(tf.EndTime); ok {
+			end = e
+		}
+
+		if secs >= start && secs < end {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Calculator) cheapestProduct(id string, media string) *models.FareProduct {
+	var best *models.FareProduct
+
+	for _, product := range c.products[id] {
+		if media != "" && product.FareMediaId != "" && product.FareMediaId != media {
+			continue
+		}
+		if best == nil || product.Amount < best.Amount {
+			best = &product
+		}
+	}
+
+	return best
+}
+
+// Duration limits starting at a departure are measured from the first leg
+// of the transfer sequence, so time-limited tickets cover the whole chain.
+// Limits starting at an arrival are measured from the previous leg.
+func (c *Calculator) findTransfer(fromGroup string, toGroup string, transfers int, first Leg, prev Leg, cur Leg) *models.FareTransferRule {
+	var generic *models.FareTransferRule
+
+	for _, rule := range c.data.TransferRules {
+		if rule.FromLegGroupId != "" && rule.FromLegGroupId != fromGroup {
+			continue
+		}
+		if rule.ToLegGroupId != "" && rule.ToLegGroupId != toGroup {
+			continue
+		}
+		// transfer_count only applies to transfers within one leg group
+		if rule.FromLegGroupId == rule.ToLegGroupId &&
+			rule.TransferCount != models.UNLIMITED_TRANSFERS && rule.TransferCount > 0 && transfers >= rule.TransferCount {
+			continue
+		}
+
+		if rule.DurationLimit > 0 {
+			var from, to int
+			switch rule.DurationLimitType {
+			case models.DEPARTURE_TO_ARRIVAL:
+				from, to = first.Departure, cur.Arrival
+			case models.DEPARTURE_TO_DEPARTURE:
+				from, to = first.Departure, cur.Departure
+			case models.ARRIVAL_TO_DEPARTURE:
+				from, to = prev.Arrival, cur.Departure
+			case models.ARRIVAL_TO_ARRIVAL:
+				from, to = prev.Arrival, cur.Arrival
+			}
+			if to-from > rule.DurationLimit {
+				continue
+			}
+		}
+
+		if rule.FromLegGroupId != "" && rule.ToLegGroupId != "" {
+			return &rule
+		}
+		if generic == nil {
+			generic = &rule
+		}
+	}
+
+	return generic
+}
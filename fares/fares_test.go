@@ -0,0 +1,474 @@
+package fares
+
+import (
+	"maps"
+	"testing"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+func at(h, m int) int {
+	return h*3600 + m*60
+}
+
+func priority(p int) *int {
+	return &p
+}
+
+func product(id string, amount float64, currency string) models.FareProduct {
+	return models.FareProduct{FareProductId: id, Amount: amount, Currency: currency}
+}
+
+// B1 is a bus and T1 a tram, AIR is a stop both in the city and at the
+// airport
+func fixture() Data {
+	return Data{
+		Products: []models.FareProduct{
+			product("single", 3, "PLN"),
+			product("bus", 4, "PLN"),
+			product("tram", 3.5, "PLN"),
+			product("premium", 5, "PLN"),
+			product("cheap", 1, "PLN"),
+			product("airport", 10, "PLN"),
+			product("peak", 4, "PLN"),
+			product("offpeak", 2, "PLN"),
+			product("night", 6, "PLN"),
+			product("free", 0, "PLN"),
+			product("fee", 1, "PLN"),
+			product("ticket90", 5, "PLN"),
+			product("intl", 2, "EUR"),
+			product("fee_eur", 0.5, "EUR"),
+		},
+		Timeframes: []models.Timeframe{
+			{TimeframeGroupId: "peak", StartTime: "07:00:00", EndTime: "09:00:00", ServiceId: "WD"},
+			{TimeframeGroupId: "offpeak", StartTime: "00:00:00", EndTime: "07:00:00", ServiceId: "WD"},
+			{TimeframeGroupId: "offpeak", StartTime: "09:00:00", EndTime: "24:00:00", ServiceId: "WD"},
+			{TimeframeGroupId: "night", StartTime: "00:00:00", EndTime: "05:00:00", ServiceId: "SAT"},
+		},
+		StopAreas: map[string][]string{
+			"A":   {"city"},
+			"AIR": {"city", "airport"},
+		},
+		RouteNetworks: map[string][]string{
+			"B1": {"bus"},
+			"T1": {"tram"},
+			"X1": {"intl"},
+		},
+	}
+}
+
+func TestLegRules(t *testing.T) {
+	weekday := []map[string]bool{{"WD": true}, {"SAT": true}}
+
+	tests := []struct {
+		name  string
+		rules []models.FareLegRule
+		leg   Leg
+		want  string
+	}{
+		{
+			name: "named network wins over an empty one",
+			rules: []models.FareLegRule{
+				{FareProductId: "single"},
+				{NetworkId: "bus", FareProductId: "bus"},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A"},
+			want: "bus",
+		},
+		{
+			name: "empty network matches when no named one does",
+			rules: []models.FareLegRule{
+				{FareProductId: "single"},
+				{NetworkId: "bus", FareProductId: "bus"},
+			},
+			leg:  Leg{RouteId: "T1", FromStopId: "A", ToStopId: "A"},
+			want: "single",
+		},
+		{
+			name: "named to area wins over an empty one",
+			rules: []models.FareLegRule{
+				{FareProductId: "single"},
+				{ToAreaId: "airport", FareProductId: "airport"},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "AIR"},
+			want: "airport",
+		},
+		{
+			name: "to area is matched on the arrival stop only",
+			rules: []models.FareLegRule{
+				{FareProductId: "single"},
+				{ToAreaId: "airport", FareProductId: "airport"},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "AIR", ToStopId: "A"},
+			want: "single",
+		},
+		{
+			name: "with rule_priority an empty field matches any value",
+			rules: []models.FareLegRule{
+				{FareProductId: "single", RulePriority: priority(0)},
+				{NetworkId: "bus", FareProductId: "bus", RulePriority: priority(0)},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A"},
+			want: "single",
+		},
+		{
+			name: "highest rule_priority wins over a cheaper, named rule",
+			rules: []models.FareLegRule{
+				{FareProductId: "premium", RulePriority: priority(1)},
+				{NetworkId: "bus", FareProductId: "bus", RulePriority: priority(0)},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A"},
+			want: "premium",
+		},
+		{
+			name: "rule_priority ignores rules naming another network",
+			rules: []models.FareLegRule{
+				{NetworkId: "tram", FareProductId: "cheap", RulePriority: priority(5)},
+				{FareProductId: "single", RulePriority: priority(0)},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A"},
+			want: "single",
+		},
+		{
+			name: "peak timeframe",
+			rules: []models.FareLegRule{
+				{FromTimeframeGroupId: "peak", FareProductId: "peak"},
+				{FromTimeframeGroupId: "offpeak", FareProductId: "offpeak"},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A", Departure: at(8, 0), Arrival: at(8, 20)},
+			want: "peak",
+		},
+		{
+			name: "offpeak timeframe",
+			rules: []models.FareLegRule{
+				{FromTimeframeGroupId: "peak", FareProductId: "peak"},
+				{FromTimeframeGroupId: "offpeak", FareProductId: "offpeak"},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A", Departure: at(10, 0), Arrival: at(10, 20)},
+			want: "offpeak",
+		},
+		{
+			name: "early morning is checked against the travel date",
+			rules: []models.FareLegRule{
+				{FromTimeframeGroupId: "offpeak", FareProductId: "offpeak"},
+				{FromTimeframeGroupId: "night", FareProductId: "night"},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A", Departure: at(1, 0), Arrival: at(1, 20)},
+			want: "offpeak",
+		},
+		{
+			name: "past midnight is checked against the next day",
+			rules: []models.FareLegRule{
+				{FromTimeframeGroupId: "offpeak", FareProductId: "offpeak"},
+				{FromTimeframeGroupId: "night", FareProductId: "night"},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A", Departure: at(25, 0), Arrival: at(25, 20)},
+			want: "night",
+		},
+		{
+			name: "to timeframe uses the arrival",
+			rules: []models.FareLegRule{
+				{ToTimeframeGroupId: "peak", FareProductId: "peak"},
+				{ToTimeframeGroupId: "offpeak", FareProductId: "offpeak"},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A", Departure: at(6, 50), Arrival: at(7, 10)},
+			want: "peak",
+		},
+		{
+			name: "no matching rule",
+			rules: []models.FareLegRule{
+				{NetworkId: "tram", FareProductId: "tram"},
+			},
+			leg:  Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A"},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := fixture()
+			data.LegRules = tt.rules
+
+			result := NewCalculator(data).Calculate([]Leg{tt.leg}, weekday, "")
+
+			got := ""
+			if p := result.Legs[0].Product; p != nil {
+				got = p.FareProductId
+			}
+			if got != tt.want {
+				t.Errorf("product = %q, want %q", got, tt.want)
+			}
+			if result.Complete != (tt.want != "") {
+				t.Errorf("complete = %v", result.Complete)
+			}
+		})
+	}
+}
+
+func TestTransfers(t *testing.T) {
+	bus := func(dep, arr int) Leg {
+		return Leg{RouteId: "B1", FromStopId: "A", ToStopId: "A", Departure: dep, Arrival: arr}
+	}
+	tram := func(dep, arr int) Leg {
+		return Leg{RouteId: "T1", FromStopId: "A", ToStopId: "A", Departure: dep, Arrival: arr}
+	}
+	// A ride at 08:00-08:30 followed by one starting at dep
+	twoBuses := func(dep, arr int) []Leg {
+		return []Leg{bus(at(8, 0), at(8, 30)), bus(dep, arr)}
+	}
+	busToBus := func(limit int, limitType models.DurationLimitType) []models.FareTransferRule {
+		return []models.FareTransferRule{{
+			FromLegGroupId:    "bus",
+			ToLegGroupId:      "bus",
+			TransferCount:     models.UNLIMITED_TRANSFERS,
+			DurationLimit:     limit,
+			DurationLimitType: limitType,
+			FareProductId:     "free",
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		transfers []models.FareTransferRule
+		legs      []Leg
+		amounts   []float64
+		total     float64
+	}{
+		{
+			name: "no transfer rule",
+			legs: []Leg{bus(at(8, 0), at(8, 20)), tram(at(8, 25), at(8, 40))},
+			// Every leg pays its own fare
+			amounts: []float64{3, 3.5},
+			total:   6.5,
+		},
+		{
+			name: "A + AB",
+			transfers: []models.FareTransferRule{
+				{FromLegGroupId: "bus", ToLegGroupId: "tram", TransferCount: models.UNLIMITED_TRANSFERS, FareTransferType: models.A_PLUS_AB, FareProductId: "fee"},
+			},
+			legs:    []Leg{bus(at(8, 0), at(8, 20)), tram(at(8, 25), at(8, 40))},
+			amounts: []float64{3, 1},
+			total:   4,
+		},
+		{
+			name: "A + AB + B",
+			transfers: []models.FareTransferRule{
+				{FromLegGroupId: "bus", ToLegGroupId: "tram", TransferCount: models.UNLIMITED_TRANSFERS, FareTransferType: models.A_PLUS_AB_PLUS_B, FareProductId: "fee"},
+			},
+			legs:    []Leg{bus(at(8, 0), at(8, 20)), tram(at(8, 25), at(8, 40))},
+			amounts: []float64{3, 4.5},
+			total:   7.5,
+		},
+		{
+			name: "AB",
+			transfers: []models.FareTransferRule{
+				{FromLegGroupId: "bus", ToLegGroupId: "tram", TransferCount: models.UNLIMITED_TRANSFERS, FareTransferType: models.AB, FareProductId: "ticket90"},
+			},
+			legs:    []Leg{bus(at(8, 0), at(8, 20)), tram(at(8, 25), at(8, 40))},
+			amounts: []float64{0, 5},
+			total:   5,
+		},
+		{
+			name: "transfer rule in the other direction only",
+			transfers: []models.FareTransferRule{
+				{FromLegGroupId: "bus", ToLegGroupId: "tram", TransferCount: models.UNLIMITED_TRANSFERS, FareProductId: "free"},
+			},
+			legs:    []Leg{tram(at(8, 0), at(8, 20)), bus(at(8, 25), at(8, 40))},
+			amounts: []float64{3.5, 3},
+			total:   6.5,
+		},
+		{
+			name: "named leg groups win over an empty one",
+			transfers: []models.FareTransferRule{
+				{TransferCount: models.UNLIMITED_TRANSFERS, FareProductId: "fee"},
+				{FromLegGroupId: "bus", ToLegGroupId: "tram", TransferCount: models.UNLIMITED_TRANSFERS, FareProductId: "free"},
+			},
+			legs:    []Leg{bus(at(8, 0), at(8, 20)), tram(at(8, 25), at(8, 40)), bus(at(8, 45), at(9, 0))},
+			amounts: []float64{3, 0, 1},
+			total:   4,
+		},
+		{
+			name: "chained transfers",
+			transfers: []models.FareTransferRule{
+				{FromLegGroupId: "bus", ToLegGroupId: "tram", TransferCount: models.UNLIMITED_TRANSFERS, FareProductId: "free"},
+				{FromLegGroupId: "tram", ToLegGroupId: "bus", TransferCount: models.UNLIMITED_TRANSFERS, FareProductId: "fee"},
+			},
+			legs:    []Leg{bus(at(8, 0), at(8, 20)), tram(at(8, 25), at(8, 40)), bus(at(8, 45), at(9, 0))},
+			amounts: []float64{3, 0, 1},
+			total:   4,
+		},
+		{
+			name: "transfer_count limits transfers within a group",
+			transfers: []models.FareTransferRule{
+				{FromLegGroupId: "bus", ToLegGroupId: "bus", TransferCount: 1, FareProductId: "free"},
+			},
+			legs: []Leg{bus(at(8, 0), at(8, 20)), bus(at(8, 25), at(8, 40)), bus(at(8, 45), at(9, 0))},
+			// The third ride starts a new sequence
+			amounts: []float64{3, 0, 3},
+			total:   6,
+		},
+		{
+			name: "unlimited transfer_count",
+			transfers: []models.FareTransferRule{
+				{FromLegGroupId: "bus", ToLegGroupId: "bus", TransferCount: models.UNLIMITED_TRANSFERS, FareProductId: "free"},
+			},
+			legs:    []Leg{bus(at(8, 0), at(8, 20)), bus(at(8, 25), at(8, 40)), bus(at(8, 45), at(9, 0))},
+			amounts: []float64{3, 0, 0},
+			total:   3,
+		},
+		{
+			name:      "departure to arrival within the limit",
+			transfers: busToBus(3600, models.DEPARTURE_TO_ARRIVAL),
+			legs:      twoBuses(at(8, 40), at(8, 55)),
+			amounts:   []float64{3, 0},
+			total:     3,
+		},
+		{
+			name:      "departure to arrival over the limit",
+			transfers: busToBus(3600, models.DEPARTURE_TO_ARRIVAL),
+			legs:      twoBuses(at(8, 50), at(9, 10)),
+			amounts:   []float64{3, 3},
+			total:     6,
+		},
+		{
+			name:      "departure to departure within the limit",
+			transfers: busToBus(3600, models.DEPARTURE_TO_DEPARTURE),
+			legs:      twoBuses(at(8, 50), at(9, 20)),
+			amounts:   []float64{3, 0},
+			total:     3,
+		},
+		{
+			name:      "departure to departure over the limit",
+			transfers: busToBus(3600, models.DEPARTURE_TO_DEPARTURE),
+			legs:      twoBuses(at(9, 5), at(9, 20)),
+			amounts:   []float64{3, 3},
+			total:     6,
+		},
+		{
+			name:      "arrival to departure within the limit",
+			transfers: busToBus(3600, models.ARRIVAL_TO_DEPARTURE),
+			legs:      twoBuses(at(9, 20), at(9, 50)),
+			amounts:   []float64{3, 0},
+			total:     3,
+		},
+		{
+			name:      "arrival to departure over the limit",
+			transfers: busToBus(3600, models.ARRIVAL_TO_DEPARTURE),
+			legs:      twoBuses(at(9, 40), at(9, 50)),
+			amounts:   []float64{3, 3},
+			total:     6,
+		},
+		{
+			name:      "arrival to arrival within the limit",
+			transfers: busToBus(3600, models.ARRIVAL_TO_ARRIVAL),
+			legs:      twoBuses(at(9, 0), at(9, 25)),
+			amounts:   []float64{3, 0},
+			total:     3,
+		},
+		{
+			name:      "arrival to arrival over the limit",
+			transfers: busToBus(3600, models.ARRIVAL_TO_ARRIVAL),
+			legs:      twoBuses(at(9, 0), at(9, 40)),
+			amounts:   []float64{3, 3},
+			total:     6,
+		},
+		{
+			name:      "departure limits are measured from the first leg of a chain",
+			transfers: busToBus(3600, models.DEPARTURE_TO_DEPARTURE),
+			legs:      []Leg{bus(at(8, 0), at(8, 20)), bus(at(8, 25), at(8, 45)), bus(at(9, 5), at(9, 20))},
+			amounts:   []float64{3, 0, 3},
+			total:     6,
+		},
+		{
+			name:      "arrival limits are measured from the previous leg",
+			transfers: busToBus(1800, models.ARRIVAL_TO_DEPARTURE),
+			legs:      []Leg{bus(at(8, 0), at(8, 20)), bus(at(8, 40), at(9, 0)), bus(at(9, 20), at(9, 40))},
+			amounts:   []float64{3, 0, 0},
+			total:     3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := fixture()
+			data.LegRules = []models.FareLegRule{
+				{LegGroupId: "bus", NetworkId: "bus", FareProductId: "single"},
+				{LegGroupId: "tram", NetworkId: "tram", FareProductId: "tram"},
+			}
+			data.TransferRules = tt.transfers
+
+			result := NewCalculator(data).Calculate(tt.legs, []map[string]bool{{"WD": true}}, "")
+
+			if !result.Complete {
+				t.Fatal("journey not complete")
+			}
+			for i, lf := range result.Legs {
+				if lf.Amount != tt.amounts[i] {
+					t.Errorf("leg %d amount = %v, want %v", i, lf.Amount, tt.amounts[i])
+				}
+			}
+			if result.Total != tt.total || result.Currency != "PLN" {
+				t.Errorf("total = %v %s, want %v PLN", result.Total, result.Currency, tt.total)
+			}
+		})
+	}
+}
+
+func TestCurrencies(t *testing.T) {
+	data := fixture()
+	data.LegRules = []models.FareLegRule{
+		{LegGroupId: "bus", NetworkId: "bus", FareProductId: "single"},
+		{LegGroupId: "intl", NetworkId: "intl", FareProductId: "intl"},
+	}
+	legs := []Leg{
+		{RouteId: "B1", FromStopId: "A", ToStopId: "A", Departure: at(8, 0), Arrival: at(8, 20)},
+		{RouteId: "X1", FromStopId: "A", ToStopId: "A", Departure: at(8, 25), Arrival: at(9, 40)},
+	}
+	services := []map[string]bool{{"WD": true}}
+
+	t.Run("journey across currencies", func(t *testing.T) {
+		result := NewCalculator(data).Calculate(legs, services, "")
+
+		if !result.Complete {
+			t.Error("journey not complete")
+		}
+		if want := map[string]float64{"PLN": 3, "EUR": 2}; !maps.Equal(result.Totals, want) {
+			t.Errorf("totals = %v, want %v", result.Totals, want)
+		}
+		if result.Currency != "" || result.Total != 0 {
+			t.Errorf("total = %v %s, want none", result.Total, result.Currency)
+		}
+	})
+
+	t.Run("A + AB + B transfer in another currency", func(t *testing.T) {
+		data := data
+		data.TransferRules = []models.FareTransferRule{
+			{FromLegGroupId: "bus", ToLegGroupId: "intl", TransferCount: models.UNLIMITED_TRANSFERS, FareTransferType: models.A_PLUS_AB_PLUS_B, FareProductId: "fee"},
+		}
+
+		result := NewCalculator(data).Calculate(legs, services, "")
+
+		if result.Complete {
+			t.Error("journey complete")
+		}
+		if result.Totals != nil || result.Currency != "" || result.Total != 0 {
+			t.Errorf("total = %v %s %v, want none", result.Total, result.Currency, result.Totals)
+		}
+		if result.Legs[1].Transfer == nil {
+			t.Error("transfer not reported")
+		}
+	})
+
+	t.Run("A + AB transfer in another currency", func(t *testing.T) {
+		data := data
+		data.TransferRules = []models.FareTransferRule{
+			{FromLegGroupId: "bus", ToLegGroupId: "intl", TransferCount: models.UNLIMITED_TRANSFERS, FareTransferType: models.A_PLUS_AB, FareProductId: "fee_eur"},
+		}
+
+		result := NewCalculator(data).Calculate(legs, services, "")
+
+		if want := map[string]float64{"PLN": 3, "EUR": 0.5}; !maps.Equal(result.Totals, want) {
+			t.Errorf("totals = %v, want %v", result.Totals, want)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package fares
+
+import (
+	"sort"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+// Ride is what Fares v1 rules are matched against. An empty stop or route
+// doesn't narrow the rules down, the zones are those of the stops.
+type Ride struct {
+	FromStop string
+	FromZone string
+	ToStop   string
+	ToZone   string
+	RouteId  string
+}
+
+// MatchAttributes returns the fares applicable to a ride, cheapest first
+func MatchAttributes(attributes []models.FareAttribute, rules []models.FareRule, ride Ride) []models.FareAttribute {
+	rulesByFare := make(map[string][]models.FareRule)
+	for _, rule := range rules {
+		rulesByFare[rule.FareId] = append(rulesByFare[rule.FareId], rule)
+	}
+
+	var matched []models.FareAttribute
+	for _, fare := range attributes {
+		rules, ok := rulesByFare[fare.FareId]
+		// A fare without any rules applies to the whole network
+		if !ok {
+			matched = append(matched, fare)
+			continue
+		}
+
+		for _, rule := range rules {
+			if fareRuleMatches(rule, ride) {
+				matched = append(matched, fare)
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Price < matched[j].Price
+	})
+
+	return matched
+}
+
+func fareRuleMatches(rule models.FareRule, ride Ride) bool {
+	hasFrom, hasTo := ride.FromStop != "", ride.ToStop != ""
+
+	if rule.RouteId != "" && ride.RouteId != "" && rule.RouteId != ride.RouteId {
+		return false
+	}
+	if rule.OriginId != "" && hasFrom && rule.OriginId != ride.FromZone {
+		return false
+	}
+	if rule.DestinationId != "" && hasTo && rule.DestinationId != ride.ToZone {
+		return false
+	}
+	// Only the endpoints of the ride are known here, so a contains rule
+	// is satisfied by either of their zones
+	if rule.ContainsId != "" && (hasFrom || hasTo) && rule.ContainsId != ride.FromZone && rule.ContainsId != ride.ToZone {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,53 @@
+package geo
+
+import "math"
+
+// BBox is a box in latitude and longitude, it doesn't cross the antimeridian
+type BBox struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+}
+
+func (b BBox) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// Expand grows the box by at least the given number of meters on every side
+func (b BBox) Expand(meters float64) BBox {
+	dLat := meters / earthRadius * 180 / math.Pi
+
+	// Degrees of longitude shrink towards the poles, size them at the edge
+	// furthest from the equator
+	lat := math.Min(math.Max(math.Abs(b.MinLat), math.Abs(b.MaxLat))+dLat, 89)
+	dLon := dLat / math.Cos(toRad(lat))
+
+	return BBox{
+		MinLat: math.Max(b.MinLat-dLat, -90),
+		MinLon: math.Max(b.MinLon-dLon, -180),
+		MaxLat: math.Min(b.MaxLat+dLat, 90),
+		MaxLon: math.Min(b.MaxLon+dLon, 180),
+	}
+}
+
+// BBoxAround returns the box reaching at least radius meters out from a point
+func BBoxAround(lat, lon, radius float64) BBox {
+	return BBox{lat, lon, lat, lon}.Expand(radius)
+}
+
+// LinesBBox returns the box around [lat, lon] lines, ok is false when they
+// have no points
+func LinesBBox(lines [][][2]float64) (box BBox, ok bool) {
+	box = BBox{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, line := range lines {
+		for _, p := range line {
+			box.MinLat = math.Min(box.MinLat, p[0])
+			box.MinLon = math.Min(box.MinLon, p[1])
+			box.MaxLat = math.Max(box.MaxLat, p[0])
+			box.MaxLon = math.Max(box.MaxLon, p[1])
+			ok = true
+		}
+	}
+	return box, ok
+}
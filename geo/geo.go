@@ -0,0 +1,54 @@
+package geo
+
+import "math"
+
+const earthRadius = 6371008.8
+
+func toRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Distance returns the great-circle distance between two points in meters
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// EncodePolyline encodes lat/lon points in Google's encoded polyline format
+// with the given precision, 5 for the classic format or 6 for OSRM/Valhalla.
+func EncodePolyline(points [][2]float64, precision int) string {
+	factor := math.Pow10(precision)
+	buf := make([]byte, 0, len(points)*6)
+
+	var prevLat, prevLon int64
+	for _, p := range points {
+		lat := int64(math.Round(p[0] * factor))
+		lon := int64(math.Round(p[1] * factor))
+
+		buf = appendPolylineValue(buf, lat-prevLat)
+		buf = appendPolylineValue(buf, lon-prevLon)
+
+		prevLat, prevLon = lat, lon
+	}
+
+	return string(buf)
+}
+
+func appendPolylineValue(buf []byte, v int64) []byte {
+	u := uint64(v << 1)
+	if v < 0 {
+		u = ^u
+	}
+
+	for u >= 0x20 {
+		buf = append(buf, byte(0x20|(u&0x1f))+63)
+		u >>= 5
+	}
+
+	return append(buf, byte(u)+63)
+}
@@ -0,0 +1,141 @@
+package geo
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestEncodePolyline(t *testing.T) {
+	tests := []struct {
+		name      string
+		points    [][2]float64
+		precision int
+		want      string
+	}{
+		// The example of Google's format documentation
+		{"documentation", [][2]float64{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}, 5, "_p~iF~ps|U_ulLnnqC_mqNvxq`@"},
+		{"rounded", [][2]float64{{0, -179.9832104}}, 5, "?`~oia@"},
+		{"precision 6", [][2]float64{{38.5, -120.2}, {40.7, -120.95}}, 6, "_izlhA~rlgdF_{geC~ywl@"},
+		{"no points", nil, 5, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := EncodePolyline(tc.points, tc.precision); got != tc.want {
+				t.Errorf("got %q, expected %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSimplifyIndexes(t *testing.T) {
+	// A small wobble, then a peak
+	points := [][2]float64{{0, 0}, {1, 0.5}, {2, -0.5}, {3, 0}, {4, 3}, {5, 0}}
+
+	tests := []struct {
+		tolerance float64
+		want      []int
+	}{
+		{0, []int{0, 1, 2, 3, 4, 5}},
+		{0.4, []int{0, 1, 2, 3, 4, 5}},
+		{1, []int{0, 3, 4, 5}},
+		{2, []int{0, 4, 5}},
+		{3, []int{0, 5}},
+	}
+
+	for _, tc := range tests {
+		if got := SimplifyIndexes(points, tc.tolerance); !slices.Equal(got, tc.want) {
+			t.Errorf("tolerance %v: got %v, expected %v", tc.tolerance, got, tc.want)
+		}
+	}
+
+	if got := Simplify(points, 2); !slices.Equal(got, [][2]float64{{0, 0}, {4, 3}, {5, 0}}) {
+		t.Errorf("got %v", got)
+	}
+	if got := SimplifyIndexes(points[:2], 10); !slices.Equal(got, []int{0, 1}) {
+		t.Errorf("expected both points of a segment kept, got %v", got)
+	}
+}
+
+// Within a meter, the local plane against great circles
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1
+}
+
+func TestLocate(t *testing.T) {
+	// East along a parallel, then north
+	line := NewLineLocator([][2]float64{{52, 21}, {52, 21.01}, {52.01, 21.01}})
+	east := Distance(52, 21, 52, 21.01)
+	north := Distance(52, 21.01, 52.01, 21.01)
+	if !near(line.Length(), east+north) {
+		t.Fatalf("length %v, expected %v", line.Length(), east+north)
+	}
+
+	tests := []struct {
+		name          string
+		point         [2]float64
+		along, offset float64
+	}{
+		{"on the line", [2]float64{52, 21.005}, east / 2, 0},
+		{"beside the line", [2]float64{52.0005, 21.005}, east / 2, Distance(52, 21.005, 52.0005, 21.005)},
+		{"nearest the second segment", [2]float64{52.005, 21.0101}, east + north/2, Distance(52.005, 21.01, 52.005, 21.0101)},
+		{"before the start", [2]float64{52, 20.99}, 0, east},
+		{"past the end", [2]float64{52.02, 21.01}, east + north, Distance(52.01, 21.01, 52.02, 21.01)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			along, offset := line.Locate(tc.point, 0)
+			if !near(along, tc.along) || !near(offset, tc.offset) {
+				t.Errorf("got %v along and %v off, expected %v and %v", along, offset, tc.along, tc.offset)
+			}
+		})
+	}
+}
+
+func TestLocateFrom(t *testing.T) {
+	// Out and back, the same point is passed twice
+	line := NewLineLocator([][2]float64{{52, 21}, {52, 21.01}, {52, 21}})
+	leg := line.Length() / 2
+	first := Distance(52, 21, 52, 21.002)
+
+	if along, _ := line.Locate([2]float64{52, 21.002}, 0); !near(along, first) {
+		t.Errorf("way out at %v, expected %v", along, first)
+	}
+	if along, _ := line.Locate([2]float64{52, 21.002}, leg); !near(along, 2*leg-first) {
+		t.Errorf("way back at %v, expected %v", along, 2*leg-first)
+	}
+	// Never before from, even on the segment from falls in
+	if along, _ := line.Locate([2]float64{52, 21.002}, first+100); !near(along, 2*leg-first) {
+		t.Errorf("past from at %v, expected %v", along, 2*leg-first)
+	}
+}
+
+func TestPointAt(t *testing.T) {
+	line := NewLineLocator([][2]float64{{52, 21}, {52, 21.01}, {52, 21.01}, {52.01, 21.01}})
+	east := Distance(52, 21, 52, 21.01)
+
+	tests := []struct {
+		name    string
+		d       float64
+		point   [2]float64
+		bearing float64
+	}{
+		{"start", 0, [2]float64{52, 21}, 90},
+		{"halfway along a segment", east / 2, [2]float64{52, 21.005}, 90},
+		// The zero-length segment takes the bearing of the one before
+		{"corner", east, [2]float64{52, 21.01}, 90},
+		{"second segment", line.Length() - 1, [2]float64{52.01, 21.01}, 0},
+		{"clamped", line.Length() + 100, [2]float64{52.01, 21.01}, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			point, bearing := line.PointAt(tc.d)
+			if !near(Distance(point[0], point[1], tc.point[0], tc.point[1]), 0) || math.Abs(bearing-tc.bearing) > 0.01 {
+				t.Errorf("got %v heading %v, expected %v heading %v", point, bearing, tc.point, tc.bearing)
+			}
+		})
+	}
+}
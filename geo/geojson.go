@@ -0,0 +1,64 @@
+package geo
+
+// GeoJSON (RFC 7946) types. Positions are [lon, lat], the opposite of the
+// [lat, lon] pairs used elsewhere in this package.
+
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+type Feature struct {
+	Type       string         `json:"type"`
+	Id         string         `json:"id,omitempty"`
+	Geometry   *Geometry      `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+func NewFeature(id string, geometry *Geometry, properties map[string]any) Feature {
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	return Feature{Type: "Feature", Id: id, Geometry: geometry, Properties: properties}
+}
+
+func NewFeatureCollection(features []Feature) FeatureCollection {
+	if features == nil {
+		features = []Feature{}
+	}
+	return FeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+func position(p [2]float64) [2]float64 {
+	return [2]float64{p[1], p[0]}
+}
+
+func positions(points [][2]float64) [][2]float64 {
+	coords := make([][2]float64, len(points))
+	for i, p := range points {
+		coords[i] = position(p)
+	}
+	return coords
+}
+
+func NewPoint(lat, lon float64) *Geometry {
+	return &Geometry{Type: "Point", Coordinates: [2]float64{lon, lat}}
+}
+
+// NewLineString takes [lat, lon] points like EncodePolyline
+func NewLineString(points [][2]float64) *Geometry {
+	return &Geometry{Type: "LineString", Coordinates: positions(points)}
+}
+
+func NewMultiLineString(lines [][][2]float64) *Geometry {
+	coords := make([][][2]float64, len(lines))
+	for i, line := range lines {
+		coords[i] = positions(line)
+	}
+	return &Geometry{Type: "MultiLineString", Coordinates: coords}
+}
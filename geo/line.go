@@ -0,0 +1,160 @@
+package geo
+
+import "math"
+
+// LineLocator measures positions along a [lat, lon] line in meters. It
+// works on a local plane around the first point, which is accurate enough
+// at city scale.
+type LineLocator struct {
+	points     [][2]float64
+	projected  [][2]float64
+	cumulative []float64
+}
+
+func NewLineLocator(points [][2]float64) *LineLocator {
+	l := &LineLocator{
+		points:     points,
+		projected:  ProjectLocal(points),
+		cumulative: make([]float64, len(points)),
+	}
+
+	for i := 1; i < len(points); i++ {
+		a, b := l.projected[i-1], l.projected[i]
+		l.cumulative[i] = l.cumulative[i-1] + math.Hypot(b[0]-a[0], b[1]-a[1])
+	}
+
+	return l
+}
+
+func (l *LineLocator) Length() float64 {
+	if len(l.cumulative) == 0 {
+		return 0
+	}
+	return l.cumulative[len(l.cumulative)-1]
+}
+
+func (l *LineLocator) project(p [2]float64) [2]float64 {
+	return ProjectLocal([][2]float64{l.points[0], p})[1]
+}
+
+// Locate snaps p onto the line and returns its distance along the line and
+// its distance from it. Only the part from the given distance onward is
+// searched, so stops of a looping trip land on the right pass.
+func (l *LineLocator) Locate(p [2]float64, from float64) (along, offset float64) {
+	if len(l.points) == 0 {
+		return 0, math.Inf(1)
+	}
+	if len(l.points) == 1 {
+		return 0, Distance(p[0], p[1], l.points[0][0], l.points[0][1])
+	}
+
+	q := l.project(p)
+	offset = math.Inf(1)
+
+	for i := 1; i < len(l.projected); i++ {
+		if l.cumulative[i] < from {
+			continue
+		}
+
+		a, b := l.projected[i-1], l.projected[i]
+		segment := l.cumulative[i] - l.cumulative[i-1]
+
+		t := 0.0
+		if segment > 0 {
+			t = ((q[0]-a[0])*(b[0]-a[0]) + (q[1]-a[1])*(b[1]-a[1])) / (segment * segment)
+		}
+		// Don't go back before from on the segment it falls in
+		if minT := (from - l.cumulative[i-1]) / math.Max(segment, 1e-9); t < minT {
+			t = minT
+		}
+		t = math.Max(0, math.Min(1, t))
+
+		x, y := a[0]+t*(b[0]-a[0]), a[1]+t*(b[1]-a[1])
+		if d := math.Hypot(q[0]-x, q[1]-y); d < offset {
+			offset = d
+			along = l.cumulative[i-1] + t*segment
+		}
+	}
+
+	return along, offset
+}
+
+// segmentAt returns the index of the segment end point and the fraction of
+// the segment at distance d
+func (l *LineLocator) segmentAt(d float64) (int, float64) {
+	for i := 1; i < len(l.cumulative); i++ {
+		if l.cumulative[i] >= d {
+			segment := l.cumulative[i] - l.cumulative[i-1]
+			if segment == 0 {
+				return i, 1
+			}
+			return i, (d - l.cumulative[i-1]) / segment
+		}
+	}
+	return len(l.cumulative) - 1, 1
+}
+
+func lerp(a, b [2]float64, t float64) [2]float64 {
+	return [2]float64{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1])}
+}
+
+// PointAt returns the [lat, lon] point at distance d along the line and the
+// bearing of the line there, in degrees clockwise from north
+func (l *LineLocator) PointAt(d float64) ([2]float64, float64) {
+	if len(l.points) < 2 {
+		if len(l.points) == 1 {
+			return l.points[0], 0
+		}
+		return [2]float64{}, 0
+	}
+
+	d = math.Max(0, math.Min(l.Length(), d))
+	i, t := l.segmentAt(d)
+
+	// Zero-length segments have no direction, look at the previous one
+	j := i
+	for j > 1 && l.points[j] == l.points[j-1] {
+		j--
+	}
+
+	return lerp(l.points[i-1], l.points[i], t), Bearing(l.points[j-1], l.points[j])
+}
+
+// Slice returns the part of the line between two distances along it
+func (l *LineLocator) Slice(from, to float64) [][2]float64 {
+	if len(l.points) < 2 {
+		return l.points
+	}
+	if from > to {
+		from, to = to, from
+	}
+	from = math.Max(0, from)
+	to = math.Min(l.Length(), to)
+
+	i, t := l.segmentAt(from)
+	j, u := l.segmentAt(to)
+
+	points := [][2]float64{lerp(l.points[i-1], l.points[i], t)}
+	add := func(p [2]float64) {
+		if points[len(points)-1] != p {
+			points = append(points, p)
+		}
+	}
+	for k := i; k < j; k++ {
+		add(l.points[k])
+	}
+	add(lerp(l.points[j-1], l.points[j], u))
+
+	return points
+}
+
+// Bearing from a to b in degrees clockwise from north
+func Bearing(a, b [2]float64) float64 {
+	lat1, lat2 := toRad(a[0]), toRad(b[0])
+	dLon := toRad(b[1] - a[1])
+
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
@@ -0,0 +1,88 @@
+package geo
+
+import "math"
+
+// Simplify reduces a line with the Douglas-Peucker algorithm, dropping
+// points closer than tolerance to the simplified line. Points are treated
+// as planar, so project them first when the tolerance is not in degrees.
+func Simplify(points [][2]float64, tolerance float64) [][2]float64 {
+	indexes := SimplifyIndexes(points, tolerance)
+	if len(indexes) == len(points) {
+		return points
+	}
+
+	simplified := make([][2]float64, len(indexes))
+	for i, index := range indexes {
+		simplified[i] = points[index]
+	}
+	return simplified
+}
+
+// SimplifyIndexes is Simplify returning the indexes of the kept points
+func SimplifyIndexes(points [][2]float64, tolerance float64) []int {
+	keep := make([]bool, len(points))
+	for i := range keep {
+		keep[i] = len(points) < 3 || tolerance <= 0
+	}
+
+	if len(points) >= 3 && tolerance > 0 {
+		keep[0], keep[len(points)-1] = true, true
+
+		// Iterative to stay safe on shapes with tens of thousands of points
+		stack := [][2]int{{0, len(points) - 1}}
+		for len(stack) > 0 {
+			span := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			maxDist, index := 0.0, -1
+			for i := span[0] + 1; i < span[1]; i++ {
+				if d := segmentDistance(points[i], points[span[0]], points[span[1]]); d > maxDist {
+					maxDist, index = d, i
+				}
+			}
+
+			if index != -1 && maxDist > tolerance {
+				keep[index] = true
+				stack = append(stack, [2]int{span[0], index}, [2]int{index, span[1]})
+			}
+		}
+	}
+
+	indexes := make([]int, 0, len(points))
+	for i, k := range keep {
+		if k {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// ProjectLocal maps [lat, lon] points onto a plane in meters around the
+// first point. Good enough for simplifying a city-sized line.
+func ProjectLocal(points [][2]float64) [][2]float64 {
+	if len(points) == 0 {
+		return nil
+	}
+
+	scale := toRad(1) * earthRadius
+	cosLat := math.Cos(toRad(points[0][0]))
+
+	projected := make([][2]float64, len(points))
+	for i, p := range points {
+		projected[i] = [2]float64{(p[1] - points[0][1]) * scale * cosLat, (p[0] - points[0][0]) * scale}
+	}
+	return projected
+}
+
+// Distance from p to the segment a-b
+func segmentDistance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
@@ -0,0 +1,113 @@
+package geo
+
+import "math"
+
+// Web Mercator tile helpers, tiles are addressed by the usual z/x/y scheme
+// with y growing southwards.
+
+// TileBounds returns the south-west and north-east corners of a tile as
+// [lat, lon] points.
+func TileBounds(z, x, y int) (sw, ne [2]float64) {
+	n := math.Exp2(float64(z))
+
+	lon := func(x float64) float64 { return x/n*360 - 180 }
+	lat := func(y float64) float64 {
+		return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+	}
+
+	sw = [2]float64{lat(float64(y + 1)), lon(float64(x))}
+	ne = [2]float64{lat(float64(y)), lon(float64(x + 1))}
+	return sw, ne
+}
+
+// TilePoint projects a [lat, lon] point into the coordinate space of a tile,
+// where (0, 0) is the top-left corner and (extent, extent) the bottom-right.
+func TilePoint(p [2]float64, z, x, y int, extent float64) [2]float64 {
+	n := math.Exp2(float64(z))
+	lat := math.Max(-85.05112878, math.Min(85.05112878, p[0])) * math.Pi / 180
+
+	wx := (p[1] + 180) / 360 * n
+	wy := (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * n
+
+	return [2]float64{(wx - float64(x)) * extent, (wy - float64(y)) * extent}
+}
+
+// ClipLine cuts a planar line to the box [min, max], returning the parts
+// that fall inside it.
+func ClipLine(points [][2]float64, min, max float64) [][][2]float64 {
+	var (
+		parts   [][][2]float64
+		current [][2]float64
+	)
+
+	for i := 1; i < len(points); i++ {
+		a, b, ok := clipSegment(points[i-1], points[i], min, max)
+		if !ok {
+			if len(current) > 1 {
+				parts = append(parts, current)
+			}
+			current = nil
+			continue
+		}
+
+		if len(current) == 0 {
+			current = append(current, a)
+		} else if current[len(current)-1] != a {
+			// Re-entered the box, start a new part
+			if len(current) > 1 {
+				parts = append(parts, current)
+			}
+			current = [][2]float64{a}
+		}
+		current = append(current, b)
+	}
+
+	if len(current) > 1 {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// Liang-Barsky segment clipping
+func clipSegment(a, b [2]float64, min, max float64) ([2]float64, [2]float64, bool) {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t0, t1 := 0.0, 1.0
+
+	edges := [4][2]float64{
+		{-dx, a[0] - min},
+		{dx, max - a[0]},
+		{-dy, a[1] - min},
+		{dy, max - a[1]},
+	}
+	for _, e := range edges {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return a, b, false
+			}
+			continue
+		}
+
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return a, b, false
+			}
+			t0 = math.Max(t0, r)
+		} else {
+			if r < t0 {
+				return a, b, false
+			}
+			t1 = math.Min(t1, r)
+		}
+	}
+
+	clippedA, clippedB := a, b
+	if t0 > 0 {
+		clippedA = [2]float64{a[0] + t0*dx, a[1] + t0*dy}
+	}
+	if t1 < 1 {
+		clippedB = [2]float64{a[0] + t1*dx, a[1] + t1*dy}
+	}
+	return clippedA, clippedB, true
+}
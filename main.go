@@ -5,6 +5,9 @@ import (
 
 	"git.marceeli.ovh/vectura/vectura-api/api"
 	"git.marceeli.ovh/vectura/vectura-api/database"
+	"git.marceeli.ovh/vectura/vectura-api/snapshot"
+	"git.marceeli.ovh/vectura/vectura-api/store"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
 	"github.com/joho/godotenv"
 
 	"gorm.io/driver/postgres"
@@ -54,8 +57,23 @@ func loadDB(dsn string) *gorm.DB {
 }
 func main() {
 	dsn := loadDSN()
-	db := loadDB(dsn)
 
+	// STORE=memory parses the feeds straight into snapshots and serves
+	// every endpoint from them, without a database
+	if os.Getenv("STORE") == "memory" {
+		mem := store.NewMemoryStore()
+		for _, city := range utils.LoadCitiesFromYAML() {
+			mem.Load(snapshot.Import(city))
+		}
+		api.StartServer(mem)
+		return
+	}
+
+	db := loadDB(dsn)
+	database.OnCityLoaded(func(db *gorm.DB, city string) {
+		snapshot.Store(database.BuildSnapshot(db, city))
+		println("Built timetable snapshot for city:", city)
+	})
 	database.PreloadCities(db)
-	api.StartServer(db)
+	api.StartServer(store.NewGormStore(db, snapshot.Get))
 }
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// ServiceDates expands calendars with their calendar_dates exceptions into
+// the days each service runs on, sorted
+func ServiceDates(calendars []Calendar, calendarDates []CalendarDate) map[string][]time.Time {
+	dates := make(map[string]map[string]time.Time)
+	add := func(service string, d time.Time) {
+		if dates[service] == nil {
+			dates[service] = make(map[string]time.Time)
+		}
+		dates[service][formatDate(d)] = d
+	}
+
+	for _, cal := range calendars {
+		weekdays := map[time.Weekday]bool{
+			time.Monday:    cal.Monday,
+			time.Tuesday:   cal.Tuesday,
+			time.Wednesday: cal.Wednesday,
+			time.Thursday:  cal.Thursday,
+			time.Friday:    cal.Friday,
+			time.Saturday:  cal.Saturday,
+			time.Sunday:    cal.Sunday,
+		}
+
+		start := LocalDate(cal.StartDate)
+		end := LocalDate(cal.EndDate)
+		for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+			if weekdays[d.Weekday()] {
+				add(cal.ServiceId, d)
+			}
+		}
+	}
+
+	for _, cd := range calendarDates {
+		switch cd.ExceptionType {
+		case SERVICE_ADDED:
+			add(cd.ServiceId, LocalDate(cd.Date))
+		case SERVICE_REMOVED:
+			delete(dates[cd.ServiceId], formatDate(LocalDate(cd.Date)))
+		}
+	}
+
+	sorted := make(map[string][]time.Time, len(dates))
+	for service, days := range dates {
+		keys := slices.Sorted(maps.Keys(days))
+		for _, key := range keys {
+			sorted[service] = append(sorted[service], days[key])
+		}
+	}
+	return sorted
+}
+
+// LocalDate normalizes dates, which come back from the database in whatever
+// zone the driver picked, to local midnight so they can be compared and used
+// as keys
+func LocalDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func formatDate(date time.Time) string {
+	return date.Format("2006-01-02")
+}
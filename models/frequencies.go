@@ -0,0 +1,42 @@
+package models
+
+import "git.marceeli.ovh/vectura/vectura-api/utils"
+
+// ExpandFrequencyDeparture generates every instance of a templated stop time.
+// tripStart is the template departure time at the first stop of the trip, in seconds.
+func ExpandFrequencyDeparture(dep Departure, freqs []Frequency, tripStart int) []Departure {
+	var instances []Departure
+
+	arrival, arrOk := utils.ParseGTFSTime(dep.ArrivalTime)
+	departure, depOk := utils.ParseGTFSTime(dep.DepartureTime)
+	if !depOk {
+		return instances
+	}
+	if !arrOk {
+		arrival = departure
+	}
+
+	arrOffset := arrival - tripStart
+	depOffset := departure - tripStart
+
+	for _, freq := range freqs {
+		start, ok := utils.ParseGTFSTime(freq.StartTime)
+		if !ok || freq.HeadwaySecs <= 0 {
+			continue
+		}
+		end, ok := utils.ParseGTFSTime(freq.EndTime)
+		if !ok {
+			continue
+		}
+
+		for t := start; t < end; t += freq.HeadwaySecs {
+			instance := dep
+			instance.ArrivalTime = utils.FormatGTFSTime(t + arrOffset)
+			instance.DepartureTime = utils.FormatGTFSTime(t + depOffset)
+			instance.FrequencyBased = !freq.ExactTimes
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances
+}
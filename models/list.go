@@ -0,0 +1,170 @@
+package models
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ListCursor is what a NextCursor carries: the sort of the list and the
+// sort key and row ID of the last item on the page
+type ListCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value any    `json:"v,omitempty"`
+	ID    uint   `json:"id"`
+}
+
+func EncodeCursor(c ListCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor fails with ErrInvalidCursor on anything EncodeCursor didn't
+// produce
+func DecodeCursor(s string) (ListCursor, error) {
+	var c ListCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// SortField is a sort= field, shared by every store so they all accept the
+// same names and order the same way
+type SortField[M any] struct {
+	// Column of the table, nullable ones are compared as their zero value
+	Column   string
+	Nullable bool
+	// Text is compared byte by byte, whatever the collation of the database
+	Text bool
+	// Value of a listed item, a string or a float64 like cursor values
+	Value func(M) any
+}
+
+var StopSortFields = map[string]SortField[Stop]{
+	"stop_id":   {"stop_id", false, true, func(s Stop) any { return s.StopId }},
+	"stop_code": {"stop_code", true, true, func(s Stop) any { return s.StopCode }},
+	"stop_name": {"stop_name", true, true, func(s Stop) any { return s.StopName }},
+	"stop_lat":  {"stop_lat", true, false, func(s Stop) any { return s.StopLat }},
+	"stop_lon":  {"stop_lon", true, false, func(s Stop) any { return s.StopLon }},
+}
+
+var RouteSortFields = map[string]SortField[Route]{
+	"route_id":         {"route_id", false, true, func(r Route) any { return r.RouteId }},
+	"route_short_name": {"route_short_name", true, true, func(r Route) any { return r.RouteShortName }},
+	"route_long_name":  {"route_long_name", true, true, func(r Route) any { return r.RouteLongName }},
+	"route_type":       {"route_type", true, false, func(r Route) any { return float64(r.RouteType) }},
+}
+
+var TripSortFields = map[string]SortField[Trip]{
+	"trip_id":       {"trip_id", false, true, func(t Trip) any { return t.TripId }},
+	"route_id":      {"route_id", false, true, func(t Trip) any { return t.RouteId }},
+	"service_id":    {"service_id", false, true, func(t Trip) any { return t.ServiceId }},
+	"trip_headsign": {"trip_headsign", true, true, func(t Trip) any { return t.TripHeadsign }},
+	"direction_id":  {"direction_id", true, false, func(t Trip) any { return float64(t.DirectionId) }},
+}
+
+// ListStops, ListRoutes and ListTrips page through items kept in memory
+// the way the database pages through its tables, the position of an item
+// standing in for its row ID
+func ListStops(stops []Stop, q ListQuery, fn func(Stop) error) (string, error) {
+	return listSlice(stops, q, StopSortFields, fn)
+}
+
+func ListRoutes(routes []Route, q ListQuery, fn func(Route) error) (string, error) {
+	return listSlice(routes, q, RouteSortFields, fn)
+}
+
+func ListTrips(trips []Trip, q ListQuery, fn func(Trip) error) (string, error) {
+	return listSlice(trips, q, TripSortFields, fn)
+}
+
+// Orders sort key values, numbers come back from a cursor as float64
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			return cmp.Compare(a, b)
+		}
+	}
+	return 0
+}
+
+func listSlice[M any](items []M, q ListQuery, fields map[string]SortField[M], fn func(M) error) (string, error) {
+	var key func(M) any
+	if q.Sort != "" {
+		field, ok := fields[q.Sort]
+		if !ok {
+			return "", ErrInvalidSort
+		}
+		key = field.Value
+	}
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	if key != nil {
+		sort.SliceStable(order, func(i, j int) bool {
+			return compareSortValues(key(items[order[i]]), key(items[order[j]])) < 0
+		})
+	}
+
+	if q.Desc {
+		slices.Reverse(order)
+	}
+
+	start := 0
+	if q.Cursor != "" {
+		cursor, err := DecodeCursor(q.Cursor)
+		if err != nil || cursor.Sort != q.Sort || cursor.Desc != q.Desc {
+			return "", ErrInvalidCursor
+		}
+
+		// Skip up to and including the last item of the previous page
+		for ; start < len(order); start++ {
+			i := order[start]
+			c := 0
+			if key != nil {
+				c = compareSortValues(key(items[i]), cursor.Value)
+			}
+			if c == 0 {
+				c = cmp.Compare(uint(i+1), cursor.ID)
+			}
+			if (!q.Desc && c > 0) || (q.Desc && c < 0) {
+				break
+			}
+		}
+	}
+
+	for n, i := range order[start:] {
+		if q.Limit > 0 && n == q.Limit {
+			last := order[start+n-1]
+			next := ListCursor{Sort: q.Sort, Desc: q.Desc, ID: uint(last + 1)}
+			if key != nil {
+				next.Value = key(items[last])
+			}
+			return EncodeCursor(next), nil
+		}
+
+		if err := fn(items[i]); err != nil {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
@@ -10,6 +10,12 @@ type Accessibility uint8
 type PickupOrDropoff uint8
 type Direction uint8
 type ExceptionType uint8
+type PaymentMethod uint8
+type FareMediaType uint8
+type DurationLimitType uint8
+type FareTransferType uint8
+type PathwayMode uint8
+type Timepoint uint8
 
 const (
 	TRAM       Type = 0
@@ -45,6 +51,29 @@ const (
 	ON_DEMAND            PickupOrDropoff = 3
 )
 
+// drop_off_type and continuous_pickup/continuous_drop_off share the values
+// above, these name the ones that read differently there
+const (
+	DROPOFF_NOT_AVAILABLE PickupOrDropoff = 1
+	// No continuous stopping between stops, the default
+	NO_CONTINUOUS PickupOrDropoff = 1
+)
+
+const (
+	WALKWAY         PathwayMode = 1
+	STAIRS          PathwayMode = 2
+	MOVING_SIDEWALK PathwayMode = 3
+	ESCALATOR       PathwayMode = 4
+	ELEVATOR        PathwayMode = 5
+	FARE_GATE       PathwayMode = 6
+	EXIT_GATE       PathwayMode = 7
+)
+
+const (
+	APPROXIMATE Timepoint = 0
+	EXACT       Timepoint = 1
+)
+
 const (
 	INBOUND  Direction = 0
 	OUTBOUND Direction = 1
@@ -55,15 +84,34 @@ const (
 	SERVICE_REMOVED ExceptionType = 2
 )
 
-type GTFSData struct {
-	Stops         []Stop
-	Routes        []Route
-	Trips         []Trip
-	Departures    []Departure
-	Calendars     []Calendar
-	CalendarDates []CalendarDate
-	Shapes        []Shape
-}
+const (
+	PAID_ON_BOARD PaymentMethod = 0
+	PAID_BEFORE   PaymentMethod = 1
+)
+
+// Empty transfers field in fare_attributes.txt, -1 transfer_count in fare_transfer_rules.txt
+const UNLIMITED_TRANSFERS = -1
+
+const (
+	NO_FARE_MEDIA FareMediaType = 0
+	PAPER_TICKET  FareMediaType = 1
+	TRANSIT_CARD  FareMediaType = 2
+	CEMV          FareMediaType = 3
+	MOBILE_APP    FareMediaType = 4
+)
+
+const (
+	DEPARTURE_TO_ARRIVAL   DurationLimitType = 0
+	DEPARTURE_TO_DEPARTURE DurationLimitType = 1
+	ARRIVAL_TO_DEPARTURE   DurationLimitType = 2
+	ARRIVAL_TO_ARRIVAL     DurationLimitType = 3
+)
+
+const (
+	A_PLUS_AB        FareTransferType = 0
+	A_PLUS_AB_PLUS_B FareTransferType = 1
+	AB               FareTransferType = 2
+)
 
 type Route struct {
 	RouteId          string
@@ -75,6 +123,7 @@ type Route struct {
 	RouteUrl         string
 	RouteColor       string
 	RouteTextColor   string
+	NetworkId        string
 }
 
 type Stop struct {
@@ -89,6 +138,13 @@ type Stop struct {
 	PlatformCode       string
 	WheelchairBoarding Accessibility
 	LocationType       Location
+	LevelId            string
+}
+
+// NearbyStop is a stop with its distance in meters from a point or a line
+type NearbyStop struct {
+	Stop     Stop
+	Distance float64
 }
 
 type Trip struct {
@@ -114,6 +170,22 @@ type Departure struct {
 	StopSequence  int
 	PickupType    PickupOrDropoff
 	DropoffType   PickupOrDropoff
+	// Set on headway-based instances whose times are only approximate (exact_times=0)
+	FrequencyBased bool
+	StopHeadsign   string
+	// StopHeadsign if the stop time has one, the trip headsign otherwise
+	Headsign          string
+	Timepoint         Timepoint
+	ShapeDistTraveled *float64
+	// Meters along the trip's shape to where the stop snaps, computed on import
+	ShapeDistance     *float64
+	ContinuousPickup  PickupOrDropoff
+	ContinuousDropOff PickupOrDropoff
+	// Set when the feed left the times blank and they were interpolated on import
+	Interpolated bool
+	PlatformCode string
+	// Nobody can board here, the trip either ends at this stop or doesn't pick up
+	ArrivalOnly bool
 }
 
 type Calendar struct {
@@ -135,9 +207,303 @@ type CalendarDate struct {
 	ExceptionType ExceptionType
 }
 
+// ServiceSummary is a service running on some date
+type ServiceSummary struct {
+	ServiceId string
+	TripCount int
+}
+
+// ServiceDay counts what runs on one date, formatted as YYYY-MM-DD
+type ServiceDay struct {
+	Date         string
+	ServiceCount int
+	TripCount    int
+}
+
+type ServiceDetail struct {
+	ServiceId string
+	// Nil for services defined by calendar_dates alone
+	Calendar *Calendar
+	// Exceptions from calendar_dates, formatted as YYYY-MM-DD
+	AddedDates   []string
+	RemovedDates []string
+	// Every date the service runs on, calendar and exceptions applied
+	Dates     []string
+	TripCount int
+}
+
 type Shape struct {
 	ShapeId         string
 	ShapePtLat      float64
 	ShapePtLon      float64
 	ShapePtSequence int
 }
+
+// Computed at import, Length is in meters. Synthetic shapes were drawn
+// through the stops of trips the feed gave no shape.
+type ShapeInfo struct {
+	ShapeId    string
+	MinLat     float64
+	MinLon     float64
+	MaxLat     float64
+	MaxLon     float64
+	Length     float64
+	PointCount int
+	Synthetic  bool
+}
+
+// VehiclePosition is where a trip should be according to its timetable
+type VehiclePosition struct {
+	Trip  Trip
+	Route Route
+	// When this run left its first stop, tells headway-based instances apart
+	StartTime string
+	Lat       float64
+	Lon       float64
+	// Degrees clockwise from north
+	Bearing float64
+	// Meters along the trip's shape, nil when the position was interpolated
+	// between stop coordinates instead
+	ShapeDistance *float64
+	// The stop last served, or the one the vehicle is standing at
+	PreviousStop string
+	NextStop     string
+	AtStop       bool
+	// Set on headway-based runs whose times are only approximate
+	FrequencyBased bool
+}
+
+// ShapeSegment is the part of a trip's shape between two of its stops,
+// distances are in meters along the shape
+type ShapeSegment struct {
+	TripId       string
+	ShapeId      string
+	FromStop     string
+	ToStop       string
+	FromDistance float64
+	ToDistance   float64
+	// [lat, lon] pairs, left empty when Polyline is requested
+	Points   [][2]float64
+	Polyline string
+}
+
+type EncodedShape struct {
+	ShapeId   string
+	Polyline  string
+	Precision int
+	Info      ShapeInfo
+}
+
+type Frequency struct {
+	TripId      string
+	StartTime   string
+	EndTime     string
+	HeadwaySecs int
+	ExactTimes  bool
+}
+
+type FareAttribute struct {
+	FareId           string
+	Price            float64
+	CurrencyType     string
+	PaymentMethod    PaymentMethod
+	Transfers        int
+	AgencyId         string
+	TransferDuration int
+}
+
+type FareRule struct {
+	FareId        string
+	RouteId       string
+	OriginId      string
+	DestinationId string
+	ContainsId    string
+}
+
+type FareProduct struct {
+	FareProductId   string
+	FareProductName string
+	FareMediaId     string
+	Amount          float64
+	Currency        string
+}
+
+type FareMedia struct {
+	FareMediaId   string
+	FareMediaName string
+	FareMediaType FareMediaType
+}
+
+type FareLegRule struct {
+	LegGroupId           string
+	NetworkId            string
+	FromAreaId           string
+	ToAreaId             string
+	FromTimeframeGroupId string
+	ToTimeframeGroupId   string
+	FareProductId        string
+	// Nil when the feed has no rule_priority column
+	RulePriority *int
+}
+
+type FareTransferRule struct {
+	FromLegGroupId    string
+	ToLegGroupId      string
+	TransferCount     int
+	DurationLimit     int
+	DurationLimitType DurationLimitType
+	FareTransferType  FareTransferType
+	FareProductId     string
+}
+
+type Area struct {
+	AreaId   string
+	AreaName string
+}
+
+type StopArea struct {
+	AreaId string
+	StopId string
+}
+
+type Network struct {
+	NetworkId   string
+	NetworkName string
+}
+
+type RouteNetwork struct {
+	NetworkId string
+	RouteId   string
+}
+
+type Timeframe struct {
+	TimeframeGroupId string
+	StartTime        string
+	EndTime          string
+	ServiceId        string
+}
+
+type Pathway struct {
+	PathwayId            string
+	FromStopId           string
+	ToStopId             string
+	PathwayMode          PathwayMode
+	IsBidirectional      bool
+	Length               float64
+	TraversalTime        int
+	StairCount           int
+	MaxSlope             float64
+	MinWidth             float64
+	SignpostedAs         string
+	ReversedSignpostedAs string
+}
+
+type Level struct {
+	LevelId    string
+	LevelIndex float64
+	LevelName  string
+}
+
+type Station struct {
+	Station       Stop
+	Entrances     []Stop
+	Platforms     []Stop
+	Nodes         []Stop
+	BoardingAreas []Stop
+	Levels        []Level
+	Pathways      []Pathway
+}
+
+// StationRoute is a walk between two nodes of a station. Pathways are given
+// in walking order, bidirectional ones walked backwards have From and To swapped.
+type StationRoute struct {
+	Pathways      []Pathway
+	TraversalTime int
+	Length        float64
+	StepFree      bool
+}
+
+type Translation struct {
+	TableName   string
+	FieldName   string
+	Language    string
+	Translation string
+	RecordId    string
+	RecordSubId string
+	FieldValue  string
+}
+
+type FeedInfo struct {
+	FeedPublisherName string
+	FeedPublisherUrl  string
+	FeedLang          string
+	DefaultLang       string
+	FeedStartDate     time.Time
+	FeedEndDate       time.Time
+	FeedVersion       string
+	FeedContactEmail  string
+	FeedContactUrl    string
+}
+
+type TripStopTime struct {
+	Stop              Stop
+	ArrivalTime       string
+	DepartureTime     string
+	StopSequence      int
+	StopHeadsign      string
+	PickupType        PickupOrDropoff
+	DropoffType       PickupOrDropoff
+	Timepoint         Timepoint
+	ShapeDistTraveled *float64
+	ShapeDistance     *float64
+	ContinuousPickup  PickupOrDropoff
+	ContinuousDropOff PickupOrDropoff
+	Interpolated      bool
+}
+
+type TripDetail struct {
+	Trip      Trip
+	Route     Route
+	StopTimes []TripStopTime
+	// Headway-based trips run every instance of their stop times within these windows
+	Frequencies []Frequency
+	// Dates formatted as YYYY-MM-DD
+	ServiceDates []string
+	Shape        []Shape
+	Polyline     string
+}
+
+// RoutePattern is a distinct ordered sequence of stops served by trips of a route
+type RoutePattern struct {
+	PatternId   string
+	DirectionId Direction
+	Stops       []Stop
+	TripCount   int
+	// Shape used by most trips of the pattern
+	ShapeId   string
+	Headsigns []string
+}
+
+type RouteDetail struct {
+	Route    Route
+	Patterns []RoutePattern
+}
+
+type TimetableTrip struct {
+	TripId               string
+	Headsign             string
+	WheelchairAccessible Accessibility
+	BikeAccessible       Accessibility
+	FrequencyBased       bool
+}
+
+// Timetable is a stops by trips matrix of a route in one direction on one day
+type Timetable struct {
+	Route       Route
+	Date        string
+	DirectionId Direction
+	Stops       []Stop
+	Trips       []TimetableTrip
+	// Times[stop][trip] is the departure time, empty where the trip doesn't call at the stop
+	Times [][]string
+}
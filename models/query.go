@@ -0,0 +1,50 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort field")
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	ErrTripNotFound  = errors.New("trip not found")
+	ErrTripNoShape   = errors.New("trip has no shape")
+	ErrStopNotOnTrip = errors.New("stop not served by trip")
+)
+
+// ListQuery pages through a list endpoint. Sort is a field name from the
+// feed ("stop_name"), empty sorts by insertion order. Cursor is the
+// NextCursor of the previous page, a Limit of zero returns everything.
+type ListQuery struct {
+	Sort   string
+	Desc   bool
+	Cursor string
+	Limit  int
+}
+
+// DepartureFilter narrows down a departure board. Zero values don't filter.
+// From and To are zero-padded GTFS times bounding the departure time, or the
+// arrival time on arrival boards. Boardable drops stop times where nobody
+// can get on, or off on arrival boards.
+type DepartureFilter struct {
+	Routes     []string
+	RouteTypes []Type
+	Direction  *Direction
+	Headsign   string
+	Wheelchair bool
+	Bikes      bool
+	From       string
+	To         string
+	Boardable  bool
+}
+
+// FromNow moves the start of the window up to the current time
+func (f DepartureFilter) FromNow() DepartureFilter {
+	now := time.Now().Format("15:04:05")
+	if f.From == "" || f.From < now {
+		f.From = now
+	}
+	return f
+}
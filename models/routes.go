@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type patternBuilder struct {
+	pattern  RoutePattern
+	stopIDs  []string
+	tripIDs  []string
+	shapeUse map[string]int
+}
+
+// groupPatterns groups trips by direction and ordered stop sequence. Patterns
+// are returned by direction, then by trip count, most common first.
+func groupPatterns(trips []Trip, sequences map[string][]string) []*patternBuilder {
+	builders := make(map[string]*patternBuilder)
+	var order []*patternBuilder
+
+	for _, trip := range trips {
+		seq := sequences[trip.TripId]
+		if len(seq) == 0 {
+			continue
+		}
+
+		key := fmt.Sprintf("%d|%s", trip.DirectionId, strings.Join(seq, "\x00"))
+		b, ok := builders[key]
+		if !ok {
+			b = &patternBuilder{
+				pattern:  RoutePattern{DirectionId: trip.DirectionId},
+				stopIDs:  seq,
+				shapeUse: make(map[string]int),
+			}
+			builders[key] = b
+			order = append(order, b)
+		}
+
+		b.pattern.TripCount++
+		b.tripIDs = append(b.tripIDs, trip.TripId)
+		if trip.ShapeId != "" {
+			b.shapeUse[trip.ShapeId]++
+		}
+		if trip.TripHeadsign != "" && !slices.Contains(b.pattern.Headsigns, trip.TripHeadsign) {
+			b.pattern.Headsigns = append(b.pattern.Headsigns, trip.TripHeadsign)
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].pattern.DirectionId != order[j].pattern.DirectionId {
+			return order[i].pattern.DirectionId < order[j].pattern.DirectionId
+		}
+		return order[i].pattern.TripCount > order[j].pattern.TripCount
+	})
+
+	counts := make(map[Direction]int)
+	for _, b := range order {
+		counts[b.pattern.DirectionId]++
+		b.pattern.PatternId = fmt.Sprintf("%d-%d", b.pattern.DirectionId, counts[b.pattern.DirectionId])
+
+		best := 0
+		for shape, n := range b.shapeUse {
+			if n > best || (n == best && shape < b.pattern.ShapeId) {
+				best = n
+				b.pattern.ShapeId = shape
+			}
+		}
+	}
+
+	return order
+}
+
+// RoutePatterns groups a route's trips by their ordered stop IDs, stops
+// looks up the stops the patterns end up visiting
+func RoutePatterns(trips []Trip, sequences map[string][]string, stops func(stopIDs []string) map[string]Stop) []RoutePattern {
+	builders := groupPatterns(trips, sequences)
+
+	var stopIDs []string
+	for _, b := range builders {
+		stopIDs = append(stopIDs, b.stopIDs...)
+	}
+	byID := stops(stopIDs)
+
+	var patterns []RoutePattern
+	for _, b := range builders {
+		for _, id := range b.stopIDs {
+			stop, ok := byID[id]
+			if !ok {
+				stop = Stop{StopId: id}
+			}
+			b.pattern.Stops = append(b.pattern.Stops, stop)
+		}
+		patterns = append(patterns, b.pattern)
+	}
+
+	return patterns
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+)
+
+const syntheticShapePrefix = "synthetic:"
+
+func ShapePoints(shapes []Shape) [][2]float64 {
+	points := make([][2]float64, 0, len(shapes))
+	for _, s := range shapes {
+		points = append(points, [2]float64{s.ShapePtLat, s.ShapePtLon})
+	}
+	return points
+}
+
+// ComputeShapeInfos returns the bounding box and length of every shape,
+// points may come in any order
+func ComputeShapeInfos(shapes []Shape) []ShapeInfo {
+	byID := make(map[string][]Shape)
+	var ids []string
+	for _, s := range shapes {
+		if _, ok := byID[s.ShapeId]; !ok {
+			ids = append(ids, s.ShapeId)
+		}
+		byID[s.ShapeId] = append(byID[s.ShapeId], s)
+	}
+
+	infos := make([]ShapeInfo, 0, len(ids))
+	for _, id := range ids {
+		points := byID[id]
+		sort.Slice(points, func(i, j int) bool { return points[i].ShapePtSequence < points[j].ShapePtSequence })
+
+		info := ShapeInfo{
+			ShapeId:    id,
+			MinLat:     math.Inf(1),
+			MinLon:     math.Inf(1),
+			MaxLat:     math.Inf(-1),
+			MaxLon:     math.Inf(-1),
+			PointCount: len(points),
+		}
+		for i, p := range points {
+			info.MinLat = math.Min(info.MinLat, p.ShapePtLat)
+			info.MinLon = math.Min(info.MinLon, p.ShapePtLon)
+			info.MaxLat = math.Max(info.MaxLat, p.ShapePtLat)
+			info.MaxLon = math.Max(info.MaxLon, p.ShapePtLon)
+			if i > 0 {
+				prev := points[i-1]
+				info.Length += geo.Distance(prev.ShapePtLat, prev.ShapePtLon, p.ShapePtLat, p.ShapePtLon)
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// SimplifyShape drops points closer than tolerance meters to the simplified
+// line, the kept points retain their original sequence numbers.
+func SimplifyShape(shapes []Shape, tolerance float64) []Shape {
+	if tolerance <= 0 || len(shapes) < 3 {
+		return shapes
+	}
+
+	indexes := geo.SimplifyIndexes(geo.ProjectLocal(ShapePoints(shapes)), tolerance)
+
+	simplified := make([]Shape, len(indexes))
+	for i, index := range indexes {
+		simplified[i] = shapes[index]
+	}
+	return simplified
+}
+
+// EncodeShape simplifies the points of a shape and encodes them as a polyline
+func EncodeShape(info ShapeInfo, shapes []Shape, precision int, tolerance float64) EncodedShape {
+	return EncodedShape{
+		ShapeId:   info.ShapeId,
+		Polyline:  geo.EncodePolyline(ShapePoints(SimplifyShape(shapes, tolerance)), precision),
+		Precision: precision,
+		Info:      info,
+	}
+}
+
+// Same stops in the same order always give the same ID, the city is mixed
+// in as shape IDs are not scoped per city in the shapes table
+func SyntheticShapeID(city string, stopIDs []string) string {
+	sum := sha1.Sum([]byte(city + "\x00" + strings.Join(stopIDs, "\x00")))
+	return syntheticShapePrefix + hex.EncodeToString(sum[:8])
+}
+
+// SyntheticShape draws a straight line through the stops of a pattern,
+// skipping those without coordinates. It returns false when fewer than two
+// points are left.
+func SyntheticShape(id string, stopIDs []string, stops map[string]Stop) ([]Shape, ShapeInfo, bool) {
+	var points []Shape
+	for _, stopID := range stopIDs {
+		stop, ok := stops[stopID]
+		if !ok || (stop.StopLat == 0 && stop.StopLon == 0) {
+			continue
+		}
+		if n := len(points); n > 0 && points[n-1].ShapePtLat == stop.StopLat && points[n-1].ShapePtLon == stop.StopLon {
+			continue
+		}
+
+		points = append(points, Shape{
+			ShapeId:         id,
+			ShapePtLat:      stop.StopLat,
+			ShapePtLon:      stop.StopLon,
+			ShapePtSequence: len(points) + 1,
+		})
+	}
+
+	if len(points) < 2 {
+		return nil, ShapeInfo{}, false
+	}
+
+	info := ComputeShapeInfos(points)[0]
+	info.Synthetic = true
+	return points, info, true
+}
+
+// SnapToShape returns how far along the line each stop lies, searching on
+// from the previous stop so loops passing a stop twice get both visits.
+// Stops without coordinates are left nil.
+func SnapToShape(locator *geo.LineLocator, stopIDs []string, stops map[string][2]float64) []*float64 {
+	distances := make([]*float64, len(stopIDs))
+	along := 0.0
+	for i, stopID := range stopIDs {
+		pos, ok := stops[stopID]
+		if !ok {
+			continue
+		}
+		along, _ = locator.Locate(pos, along)
+		d := along
+		distances[i] = &d
+	}
+	return distances
+}
+
+// CutShapeSegment cuts a trip's shape between two of its stops using the
+// distances they were snapped to. An empty fromStop starts at the first
+// stop, an empty toStop ends at the last one. With polylinePrecision above
+// zero the segment is returned encoded instead of as points.
+func CutShapeSegment(trip Trip, stopTimes []TripStopTime, shape []Shape, fromStop string, toStop string, polylinePrecision int) (ShapeSegment, error) {
+	if len(stopTimes) == 0 {
+		return ShapeSegment{}, ErrStopNotOnTrip
+	}
+
+	from := 0
+	if fromStop != "" {
+		from = slices.IndexFunc(stopTimes, func(st TripStopTime) bool { return st.Stop.StopId == fromStop })
+	}
+	to := len(stopTimes) - 1
+	if toStop != "" && from >= 0 {
+		// The first visit after from, for trips that loop back through it
+		to = slices.IndexFunc(stopTimes[from:], func(st TripStopTime) bool { return st.Stop.StopId == toStop })
+		if to >= 0 {
+			to += from
+		}
+	}
+	if from < 0 || to < 0 || stopTimes[from].ShapeDistance == nil || stopTimes[to].ShapeDistance == nil {
+		return ShapeSegment{}, ErrStopNotOnTrip
+	}
+
+	segment := ShapeSegment{
+		TripId:       trip.TripId,
+		ShapeId:      trip.ShapeId,
+		FromStop:     stopTimes[from].Stop.StopId,
+		ToStop:       stopTimes[to].Stop.StopId,
+		FromDistance: *stopTimes[from].ShapeDistance,
+		ToDistance:   *stopTimes[to].ShapeDistance,
+	}
+
+	locator := geo.NewLineLocator(ShapePoints(shape))
+	points := locator.Slice(segment.FromDistance, segment.ToDistance)
+	if polylinePrecision > 0 {
+		segment.Polyline = geo.EncodePolyline(points, polylinePrecision)
+	} else {
+		segment.Points = points
+	}
+
+	return segment, nil
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+)
+
+// Within a meter
+func near(a, b [2]float64) bool {
+	return geo.Distance(a[0], a[1], b[0], b[1]) < 1
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSnapToShape(t *testing.T) {
+	// Out and back along a parallel, B is passed twice
+	locator := geo.NewLineLocator([][2]float64{{52, 21}, {52, 21.01}, {52, 21}})
+	stops := map[string][2]float64{
+		"A": {52, 21},
+		"B": {52.0001, 21.002},
+		"C": {52, 21.01},
+	}
+	toB := geo.Distance(52, 21, 52, 21.002)
+	leg := locator.Length() / 2
+
+	got := SnapToShape(locator, []string{"A", "B", "C", "X", "B", "A"}, stops)
+	want := []*float64{ptr(0.0), ptr(toB), ptr(leg), nil, ptr(2*leg - toB), ptr(2 * leg)}
+
+	for i := range want {
+		switch {
+		case want[i] == nil && got[i] != nil:
+			t.Errorf("stop %d snapped to %v, expected nil", i, *got[i])
+		case want[i] != nil && (got[i] == nil || math.Abs(*got[i]-*want[i]) > 1):
+			t.Errorf("stop %d snapped to %v, expected %v", i, got[i], *want[i])
+		}
+	}
+}
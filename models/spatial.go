@@ -0,0 +1,86 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+)
+
+func isSpatialStop(stop Stop) bool {
+	return (stop.LocationType == STOP || stop.LocationType == STATION) &&
+		(stop.StopLat != 0 || stop.StopLon != 0)
+}
+
+func sortNearby(stops []NearbyStop, limit int) []NearbyStop {
+	slices.SortFunc(stops, func(a, b NearbyStop) int {
+		if c := cmp.Compare(a.Distance, b.Distance); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Stop.StopId, b.Stop.StopId)
+	})
+	if limit > 0 && len(stops) > limit {
+		stops = stops[:limit]
+	}
+	return stops
+}
+
+// NearbyStops returns the stops within radius meters of a point, closest
+// first. A limit of zero returns all of them.
+func NearbyStops(stops []Stop, lat, lon, radius float64, limit int) []NearbyStop {
+	nearby := []NearbyStop{}
+	for _, stop := range stops {
+		if !isSpatialStop(stop) {
+			continue
+		}
+		if d := geo.Distance(lat, lon, stop.StopLat, stop.StopLon); d <= radius {
+			nearby = append(nearby, NearbyStop{Stop: stop, Distance: d})
+		}
+	}
+	return sortNearby(nearby, limit)
+}
+
+// StopsInBBox returns the stops inside a box in the order given
+func StopsInBBox(stops []Stop, box geo.BBox, limit int) []Stop {
+	inside := []Stop{}
+	for _, stop := range stops {
+		if limit > 0 && len(inside) == limit {
+			break
+		}
+		if isSpatialStop(stop) && box.Contains(stop.StopLat, stop.StopLon) {
+			inside = append(inside, stop)
+		}
+	}
+	return inside
+}
+
+// StopsAlongLines returns the stops within distance meters of any of the
+// [lat, lon] lines, closest first
+func StopsAlongLines(stops []Stop, lines [][][2]float64, distance float64, limit int) []NearbyStop {
+	var locators []*geo.LineLocator
+	for _, line := range lines {
+		if len(line) > 1 {
+			locators = append(locators, geo.NewLineLocator(line))
+		}
+	}
+
+	nearby := []NearbyStop{}
+	for _, stop := range stops {
+		if !isSpatialStop(stop) {
+			continue
+		}
+
+		best := -1.0
+		for _, l := range locators {
+			_, offset := l.Locate([2]float64{stop.StopLat, stop.StopLon}, 0)
+			if best < 0 || offset < best {
+				best = offset
+			}
+		}
+		if best >= 0 && best <= distance {
+			nearby = append(nearby, NearbyStop{Stop: stop, Distance: best})
+		}
+	}
+	return sortNearby(nearby, limit)
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"container/heap"
+	"slices"
+	"sort"
+)
+
+// StationStops picks the stops belonging to a station out of a city's stops:
+// its platforms, entrances and nodes, and the boarding areas of those
+// platforms.
+func StationStops(station string, stops []Stop) []Stop {
+	var children []Stop
+	platforms := make(map[string]bool)
+	for _, stop := range stops {
+		if stop.ParentStation == station {
+			children = append(children, stop)
+			platforms[stop.StopId] = true
+		}
+	}
+	for _, stop := range stops {
+		if stop.LocationType == BOARDING && platforms[stop.ParentStation] {
+			children = append(children, stop)
+		}
+	}
+	return children
+}
+
+// NewStation sorts the stops of a station by kind. Only the levels they are
+// on and the pathways touching them are kept, levels ordered by level_index.
+func NewStation(stop Stop, stops []Stop, levels []Level, pathways []Pathway) Station {
+	station := Station{Station: stop}
+
+	stopIDs := []string{stop.StopId}
+	levelIDs := []string{}
+	if stop.LevelId != "" {
+		levelIDs = append(levelIDs, stop.LevelId)
+	}
+
+	for _, s := range stops {
+		stopIDs = append(stopIDs, s.StopId)
+		if s.LevelId != "" && !slices.Contains(levelIDs, s.LevelId) {
+			levelIDs = append(levelIDs, s.LevelId)
+		}
+
+		switch s.LocationType {
+		case STOP:
+			station.Platforms = append(station.Platforms, s)
+		case ENTRANCE_EXIT:
+			station.Entrances = append(station.Entrances, s)
+		case NODE:
+			station.Nodes = append(station.Nodes, s)
+		case BOARDING:
+			station.BoardingAreas = append(station.BoardingAreas, s)
+		}
+	}
+
+	for _, level := range levels {
+		if slices.Contains(levelIDs, level.LevelId) {
+			station.Levels = append(station.Levels, level)
+		}
+	}
+	sort.SliceStable(station.Levels, func(i, j int) bool {
+		return station.Levels[i].LevelIndex < station.Levels[j].LevelIndex
+	})
+
+	for _, p := range pathways {
+		if slices.Contains(stopIDs, p.FromStopId) || slices.Contains(stopIDs, p.ToStopId) {
+			station.Pathways = append(station.Pathways, p)
+		}
+	}
+
+	return station
+}
+
+// Used to estimate traversal time of pathways that only have a length
+const walkingSpeed = 1.2
+
+// Fallback cost of a pathway with neither traversal time nor length
+const defaultTraversalTime = 30
+
+func isStepFree(p Pathway) bool {
+	return p.PathwayMode != STAIRS && p.PathwayMode != ESCALATOR && p.StairCount == 0
+}
+
+func pathwayCost(p Pathway) int {
+	if p.TraversalTime > 0 {
+		return p.TraversalTime
+	}
+	if p.Length > 0 {
+		return int(p.Length/walkingSpeed) + 1
+	}
+	return defaultTraversalTime
+}
+
+func reversePathway(p Pathway) Pathway {
+	p.FromStopId, p.ToStopId = p.ToStopId, p.FromStopId
+	p.SignpostedAs, p.ReversedSignpostedAs = p.ReversedSignpostedAs, p.SignpostedAs
+	return p
+}
+
+type pathNode struct {
+	stop string
+	cost int
+}
+
+type pathQueue []pathNode
+
+func (q pathQueue) Len() int { return len(q) }
+
+func (q pathQueue) Less(i, j int) bool { return q[i].cost < q[j].cost }
+
+func (q pathQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *pathQueue) Push(x any) { *q = append(*q, x.(pathNode)) }
+
+func (q *pathQueue) Pop() any {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// FindStationRoute finds the quickest walk between two nodes of a station
+// over its pathways. With stepFree set, stairs and escalators are avoided.
+func FindStationRoute(pathways []Pathway, from string, to string, stepFree bool) (StationRoute, bool) {
+	graph := make(map[string][]Pathway)
+	for _, p := range pathways {
+		if stepFree && !isStepFree(p) {
+			continue
+		}
+		graph[p.FromStopId] = append(graph[p.FromStopId], p)
+		if p.IsBidirectional {
+			graph[p.ToStopId] = append(graph[p.ToStopId], reversePathway(p))
+		}
+	}
+
+	dist := map[string]int{from: 0}
+	prev := make(map[string]Pathway)
+	queue := &pathQueue{{stop: from}}
+
+	for queue.Len() > 0 {
+		node := heap.Pop(queue).(pathNode)
+		if node.stop == to {
+			break
+		}
+		if node.cost > dist[node.stop] {
+			continue
+		}
+
+		for _, p := range graph[node.stop] {
+			cost := node.cost + pathwayCost(p)
+			if d, ok := dist[p.ToStopId]; !ok || cost < d {
+				dist[p.ToStopId] = cost
+				prev[p.ToStopId] = p
+				heap.Push(queue, pathNode{stop: p.ToStopId, cost: cost})
+			}
+		}
+	}
+
+	if _, ok := dist[to]; !ok {
+		return StationRoute{}, false
+	}
+
+	route := StationRoute{StepFree: true}
+	for stop := to; stop != from; {
+		p := prev[stop]
+		route.Pathways = append(route.Pathways, p)
+		stop = p.FromStopId
+	}
+	slices.Reverse(route.Pathways)
+
+	for _, p := range route.Pathways {
+		route.TraversalTime += pathwayCost(p)
+		route.Length += p.Length
+		route.StepFree = route.StepFree && isStepFree(p)
+	}
+
+	return route, true
+}
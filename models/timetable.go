@@ -0,0 +1,157 @@
+package models
+
+import (
+	"sort"
+
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+)
+
+// mergeStopLists folds the stops of other into merged, keeping the order of
+// both. Stops missing from merged are inserted right after the last stop
+// both lists share.
+func mergeStopLists(merged []string, other []string) []string {
+	pos := -1
+	for _, stop := range other {
+		found := -1
+		for i := pos + 1; i < len(merged); i++ {
+			if merged[i] == stop {
+				found = i
+				break
+			}
+		}
+
+		if found >= 0 {
+			pos = found
+			continue
+		}
+
+		pos++
+		merged = append(merged, "")
+		copy(merged[pos+1:], merged[pos:])
+		merged[pos] = stop
+	}
+
+	return merged
+}
+
+// Row of every stop of a trip, matching stops in order so loops that call at
+// the same stop twice land on the right rows
+func matchRows(rows []string, stops []string) []int {
+	result := make([]int, len(stops))
+
+	pos := -1
+	for k, stop := range stops {
+		result[k] = -1
+		for i := pos + 1; i < len(rows); i++ {
+			if rows[i] == stop {
+				result[k] = i
+				pos = i
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+type timetableColumn struct {
+	trip  TimetableTrip
+	start int
+	times []string
+}
+
+// BuildTimetable lays out trips as the columns of timetable, stopTimes and
+// freqs are keyed by trip ID and stops looks up the stops of the rows.
+// Trips must already be those of one route, direction and date.
+func BuildTimetable(timetable Timetable, trips []Trip, stopTimes map[string][]Departure, freqs map[string][]Frequency, stops func(stopIDs []string) map[string]Stop) Timetable {
+	sequences := make(map[string][]string, len(stopTimes))
+	for tripID, deps := range stopTimes {
+		for _, dep := range deps {
+			sequences[tripID] = append(sequences[tripID], dep.StopId)
+		}
+	}
+
+	// Rows start off as the main pattern, variations are merged in by how
+	// many trips use them
+	var rows []string
+	for _, b := range groupPatterns(trips, sequences) {
+		if rows == nil {
+			rows = append(rows, b.stopIDs...)
+		} else {
+			rows = mergeStopLists(rows, b.stopIDs)
+		}
+	}
+
+	var columns []timetableColumn
+	for _, trip := range trips {
+		deps := stopTimes[trip.TripId]
+		if len(deps) == 0 {
+			continue
+		}
+
+		rowOf := matchRows(rows, sequences[trip.TripId])
+		info := TimetableTrip{
+			TripId:               trip.TripId,
+			Headsign:             trip.TripHeadsign,
+			WheelchairAccessible: trip.WheelchairAccessible,
+			BikeAccessible:       trip.BikeAccessible,
+		}
+
+		// Every headway instance of a frequency-based trip gets its own column
+		instances := [][]Departure{deps}
+		if tripFreqs, ok := freqs[trip.TripId]; ok {
+			tripStart, _ := utils.ParseGTFSTime(deps[0].DepartureTime)
+
+			instances = nil
+			for k, dep := range deps {
+				for n, inst := range ExpandFrequencyDeparture(dep, tripFreqs, tripStart) {
+					if k == 0 {
+						instances = append(instances, make([]Departure, len(deps)))
+					}
+					if n < len(instances) {
+						instances[n][k] = inst
+					}
+				}
+			}
+		}
+
+		for _, inst := range instances {
+			col := timetableColumn{trip: info, times: make([]string, len(rows))}
+			col.trip.FrequencyBased = inst[0].FrequencyBased
+			col.start, _ = utils.ParseGTFSTime(inst[0].DepartureTime)
+
+			for k, dep := range inst {
+				if rowOf[k] >= 0 {
+					col.times[rowOf[k]] = dep.DepartureTime
+				}
+			}
+			columns = append(columns, col)
+		}
+	}
+
+	sort.SliceStable(columns, func(i, j int) bool {
+		return columns[i].start < columns[j].start
+	})
+
+	byID := stops(rows)
+	for _, id := range rows {
+		stop, ok := byID[id]
+		if !ok {
+			stop = Stop{StopId: id}
+		}
+		timetable.Stops = append(timetable.Stops, stop)
+	}
+
+	timetable.Times = make([][]string, len(rows))
+	for i := range rows {
+		timetable.Times[i] = make([]string, len(columns))
+		for j, col := range columns {
+			timetable.Times[i][j] = col.times[i]
+		}
+	}
+	for _, col := range columns {
+		timetable.Trips = append(timetable.Trips, col.trip)
+	}
+
+	return timetable
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Translator localizes feed values into a single language. A nil
+// Translator leaves everything in the feed language.
+type Translator struct {
+	Language string
+	// table/field/record_id/record_sub_id -> translation
+	records map[string]string
+	// table/field/field_value -> translation
+	values map[string]string
+}
+
+// NewTranslator indexes the translations of one language
+func NewTranslator(language string, translations []Translation) *Translator {
+	t := &Translator{
+		Language: language,
+		records:  make(map[string]string),
+		values:   make(map[string]string),
+	}
+
+	for _, tr := range translations {
+		if tr.RecordId != "" {
+			t.records[tr.TableName+"/"+tr.FieldName+"/"+tr.RecordId+"/"+tr.RecordSubId] = tr.Translation
+		} else if tr.FieldValue != "" {
+			t.values[tr.TableName+"/"+tr.FieldName+"/"+tr.FieldValue] = tr.Translation
+		}
+	}
+
+	return t
+}
+
+// Language is the lowercase language the feed is written in, default_lang
+// for feeds in several languages
+func (f FeedInfo) Language() string {
+	if lang := strings.ToLower(f.FeedLang); lang != "mul" {
+		return lang
+	}
+	return strings.ToLower(f.DefaultLang)
+}
+
+// PickLanguage returns the first of the requested languages a feed has
+// translations for, matching "en" to "en-GB" too. It returns "" when the
+// best match is the feed language itself or nothing matches. feed and
+// available are lowercase.
+func PickLanguage(requested []string, feed string, available []string) string {
+	for _, lang := range requested {
+		lang = strings.ToLower(lang)
+		if lang == feed || strings.HasPrefix(feed, lang+"-") {
+			return ""
+		}
+		for _, a := range available {
+			if a == lang || strings.HasPrefix(a, lang+"-") {
+				return a
+			}
+		}
+	}
+	return ""
+}
+
+// Record translations take precedence over field_value ones, as in the spec
+func (t *Translator) translate(table string, field string, recordId string, recordSubId string, value string) string {
+	if t == nil || value == "" {
+		return value
+	}
+	if tr, ok := t.records[table+"/"+field+"/"+recordId+"/"+recordSubId]; ok {
+		return tr
+	}
+	if tr, ok := t.values[table+"/"+field+"/"+value]; ok {
+		return tr
+	}
+	return value
+}
+
+func (t *Translator) Stop(stop *Stop) {
+	stop.StopName = t.translate("stops", "stop_name", stop.StopId, "", stop.StopName)
+	stop.StopUrl = t.translate("stops", "stop_url", stop.StopId, "", stop.StopUrl)
+	stop.PlatformCode = t.translate("stops", "platform_code", stop.StopId, "", stop.PlatformCode)
+}
+
+func (t *Translator) Stops(stops []Stop) {
+	for i := range stops {
+		t.Stop(&stops[i])
+	}
+}
+
+func (t *Translator) Route(route *Route) {
+	route.RouteShortName = t.translate("routes", "route_short_name", route.RouteId, "", route.RouteShortName)
+	route.RouteLongName = t.translate("routes", "route_long_name", route.RouteId, "", route.RouteLongName)
+	route.RouteDescription = t.translate("routes", "route_desc", route.RouteId, "", route.RouteDescription)
+	route.RouteUrl = t.translate("routes", "route_url", route.RouteId, "", route.RouteUrl)
+}
+
+func (t *Translator) Routes(routes []Route) {
+	for i := range routes {
+		t.Route(&routes[i])
+	}
+}
+
+func (t *Translator) Trip(trip *Trip) {
+	trip.TripHeadsign = t.translate("trips", "trip_headsign", trip.TripId, "", trip.TripHeadsign)
+	trip.TripShortName = t.translate("trips", "trip_short_name", trip.TripId, "", trip.TripShortName)
+}
+
+func (t *Translator) Trips(trips []Trip) {
+	for i := range trips {
+		t.Trip(&trips[i])
+	}
+}
+
+func (t *Translator) Departure(dep *Departure) {
+	t.Trip(&dep.Trip)
+	t.Route(&dep.Route)
+	dep.StopHeadsign = t.translate("stop_times", "stop_headsign", dep.TripId, strconv.Itoa(dep.StopSequence), dep.StopHeadsign)
+	dep.Headsign = dep.StopHeadsign
+	if dep.Headsign == "" {
+		dep.Headsign = dep.Trip.TripHeadsign
+	}
+}
+
+func (t *Translator) Departures(deps []Departure) {
+	for i := range deps {
+		t.Departure(&deps[i])
+	}
+}
+
+func (t *Translator) TripDetail(detail *TripDetail) {
+	t.Trip(&detail.Trip)
+	t.Route(&detail.Route)
+	for i := range detail.StopTimes {
+		st := &detail.StopTimes[i]
+		t.Stop(&st.Stop)
+		st.StopHeadsign = t.translate("stop_times", "stop_headsign", detail.Trip.TripId, strconv.Itoa(st.StopSequence), st.StopHeadsign)
+	}
+}
+
+func (t *Translator) RouteDetail(detail *RouteDetail) {
+	t.Route(&detail.Route)
+	for i := range detail.Patterns {
+		p := &detail.Patterns[i]
+		t.Stops(p.Stops)
+		for j := range p.Headsigns {
+			p.Headsigns[j] = t.translate("trips", "trip_headsign", "", "", p.Headsigns[j])
+		}
+	}
+}
+
+func (t *Translator) Timetable(timetable *Timetable) {
+	t.Route(&timetable.Route)
+	t.Stops(timetable.Stops)
+	for i := range timetable.Trips {
+		trip := &timetable.Trips[i]
+		trip.Headsign = t.translate("trips", "trip_headsign", trip.TripId, "", trip.Headsign)
+	}
+}
+
+func (t *Translator) Level(level *Level) {
+	level.LevelName = t.translate("levels", "level_name", level.LevelId, "", level.LevelName)
+}
+
+func (t *Translator) Pathway(pathway *Pathway) {
+	pathway.SignpostedAs = t.translate("pathways", "signposted_as", pathway.PathwayId, "", pathway.SignpostedAs)
+	pathway.ReversedSignpostedAs = t.translate("pathways", "reversed_signposted_as", pathway.PathwayId, "", pathway.ReversedSignpostedAs)
+}
+
+func (t *Translator) Station(station *Station) {
+	t.Stop(&station.Station)
+	t.Stops(station.Entrances)
+	t.Stops(station.Platforms)
+	t.Stops(station.Nodes)
+	t.Stops(station.BoardingAreas)
+	for i := range station.Levels {
+		t.Level(&station.Levels[i])
+	}
+	for i := range station.Pathways {
+		t.Pathway(&station.Pathways[i])
+	}
+}
+
+func (t *Translator) FareProduct(product *FareProduct) {
+	if product == nil {
+		return
+	}
+	product.FareProductName = t.translate("fare_products", "fare_product_name", product.FareProductId, "", product.FareProductName)
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"sort"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+)
+
+// ScheduledStop is a stop time with its times parsed, what a vehicle's
+// position is estimated from
+type ScheduledStop struct {
+	StopId    string
+	Arrival   int
+	Departure int
+	Point     [2]float64
+	HasPoint  bool
+	Distance  *float64
+}
+
+// EstimatePosition places a vehicle at t seconds on its trip's stop times.
+// The shape is followed when both surrounding stops were snapped to it,
+// otherwise the vehicle moves in a straight line between the stops.
+func EstimatePosition(stops []ScheduledStop, t int, locator *geo.LineLocator) (VehiclePosition, bool) {
+	var v VehiclePosition
+
+	for i, stop := range stops {
+		var next *ScheduledStop
+		if i+1 < len(stops) {
+			next = &stops[i+1]
+		}
+
+		switch {
+		case stop.Arrival <= t && t <= stop.Departure:
+			v.AtStop = true
+			v.PreviousStop = stop.StopId
+			if next != nil {
+				v.NextStop = next.StopId
+			}
+
+			if stop.Distance != nil && locator != nil {
+				d := *stop.Distance
+				point, bearing := locator.PointAt(d)
+				v.Lat, v.Lon, v.Bearing, v.ShapeDistance = point[0], point[1], bearing, &d
+				return v, true
+			}
+			if !stop.HasPoint {
+				return v, false
+			}
+			v.Lat, v.Lon = stop.Point[0], stop.Point[1]
+			if next != nil && next.HasPoint {
+				v.Bearing = geo.Bearing(stop.Point, next.Point)
+			}
+			return v, true
+
+		case next != nil && stop.Departure < t && t < next.Arrival:
+			v.PreviousStop = stop.StopId
+			v.NextStop = next.StopId
+			frac := float64(t-stop.Departure) / float64(next.Arrival-stop.Departure)
+
+			if stop.Distance != nil && next.Distance != nil && locator != nil {
+				d := *stop.Distance + frac*(*next.Distance-*stop.Distance)
+				point, bearing := locator.PointAt(d)
+				v.Lat, v.Lon, v.Bearing, v.ShapeDistance = point[0], point[1], bearing, &d
+				return v, true
+			}
+			if !stop.HasPoint || !next.HasPoint {
+				return v, false
+			}
+			v.Lat = stop.Point[0] + frac*(next.Point[0]-stop.Point[0])
+			v.Lon = stop.Point[1] + frac*(next.Point[1]-stop.Point[1])
+			v.Bearing = geo.Bearing(stop.Point, next.Point)
+			return v, true
+		}
+	}
+
+	return v, false
+}
+
+// ScheduledRun is a run of a trip, shifted by Offset seconds for
+// headway-based instances
+type ScheduledRun struct {
+	TripId         string
+	Offset         int
+	FrequencyBased bool
+}
+
+// NewScheduledStop parses the times of a stop time, false when it has no
+// departure time
+func NewScheduledStop(dep Departure, stop Stop) (ScheduledStop, bool) {
+	departure, ok := utils.ParseGTFSTime(dep.DepartureTime)
+	if !ok {
+		return ScheduledStop{}, false
+	}
+	arrival, ok := utils.ParseGTFSTime(dep.ArrivalTime)
+	if !ok {
+		arrival = departure
+	}
+
+	return ScheduledStop{
+		StopId:    dep.StopId,
+		Arrival:   arrival,
+		Departure: departure,
+		Point:     [2]float64{stop.StopLat, stop.StopLon},
+		HasPoint:  stop.StopLat != 0 || stop.StopLon != 0,
+		Distance:  dep.ShapeDistance,
+	}, true
+}
+
+// HeadwayRuns returns every instance of a headway-based trip whose run spans
+// secs. start and end are the first departure and last arrival of the
+// template trip.
+func HeadwayRuns(tripID string, start int, end int, freqs []Frequency, secs int) []ScheduledRun {
+	var runs []ScheduledRun
+	duration := end - start
+
+	for _, freq := range freqs {
+		windowStart, ok := utils.ParseGTFSTime(freq.StartTime)
+		if !ok || freq.HeadwaySecs <= 0 {
+			continue
+		}
+		windowEnd, ok := utils.ParseGTFSTime(freq.EndTime)
+		if !ok {
+			continue
+		}
+
+		for t := windowStart; t < windowEnd && t <= secs; t += freq.HeadwaySecs {
+			if t+duration >= secs {
+				runs = append(runs, ScheduledRun{
+					TripId:         tripID,
+					Offset:         t - start,
+					FrequencyBased: !freq.ExactTimes,
+				})
+			}
+		}
+	}
+
+	return runs
+}
+
+// SortVehicles orders vehicles by trip, then by start time
+func SortVehicles(vehicles []VehiclePosition) {
+	sort.SliceStable(vehicles, func(i, j int) bool {
+		if vehicles[i].Trip.TripId != vehicles[j].Trip.TripId {
+			return vehicles[i].Trip.TripId < vehicles[j].Trip.TripId
+		}
+		return vehicles[i].StartTime < vehicles[j].StartTime
+	})
+}
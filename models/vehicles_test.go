@@ -0,0 +1,70 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+)
+
+func TestEstimatePosition(t *testing.T) {
+	// East from A to B, then north to C, which wasn't snapped
+	locator := geo.NewLineLocator([][2]float64{{52, 21}, {52, 21.01}, {52.01, 21.01}})
+	east := geo.Distance(52, 21, 52, 21.01)
+	stops := []ScheduledStop{
+		{StopId: "A", Arrival: 100, Departure: 160, Point: [2]float64{52, 21}, HasPoint: true, Distance: ptr(0.0)},
+		{StopId: "B", Arrival: 220, Departure: 220, Point: [2]float64{52, 21.01}, HasPoint: true, Distance: ptr(east)},
+		{StopId: "C", Arrival: 300, Departure: 300, Point: [2]float64{52.01, 21.01}, HasPoint: true},
+	}
+
+	tests := []struct {
+		name     string
+		t        int
+		locator  *geo.LineLocator
+		point    [2]float64
+		bearing  float64
+		previous string
+		next     string
+		atStop   bool
+		distance *float64
+	}{
+		{"dwelling", 130, locator, [2]float64{52, 21}, 90, "A", "B", true, ptr(0.0)},
+		{"halfway along the shape", 190, locator, [2]float64{52, 21.005}, 90, "A", "B", false, ptr(east / 2)},
+		{"halfway without a shape", 190, nil, [2]float64{52, 21.005}, 90, "A", "B", false, nil},
+		{"dwelling without a shape", 130, nil, [2]float64{52, 21}, 90, "A", "B", true, nil},
+		// C has no distance, so the straight line between the stops it is
+		{"halfway to an unsnapped stop", 260, locator, [2]float64{52.005, 21.01}, 0, "B", "C", false, nil},
+		{"last stop", 300, locator, [2]float64{52.01, 21.01}, 0, "C", "", true, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v, ok := EstimatePosition(stops, tc.t, tc.locator)
+			if !ok {
+				t.Fatal("expected a position")
+			}
+			if !near([2]float64{v.Lat, v.Lon}, tc.point) || math.Abs(v.Bearing-tc.bearing) > 0.01 {
+				t.Errorf("at %v, %v heading %v, expected %v heading %v", v.Lat, v.Lon, v.Bearing, tc.point, tc.bearing)
+			}
+			if v.PreviousStop != tc.previous || v.NextStop != tc.next || v.AtStop != tc.atStop {
+				t.Errorf("between %q and %q, at stop %v", v.PreviousStop, v.NextStop, v.AtStop)
+			}
+			if (v.ShapeDistance == nil) != (tc.distance == nil) ||
+				tc.distance != nil && math.Abs(*v.ShapeDistance-*tc.distance) > 1 {
+				t.Errorf("shape distance %v, expected %v", v.ShapeDistance, tc.distance)
+			}
+		})
+	}
+
+	for _, secs := range []int{99, 301} {
+		if v, ok := EstimatePosition(stops, secs, locator); ok {
+			t.Errorf("expected no position at %d, got %+v", secs, v)
+		}
+	}
+
+	// Neither coordinates nor a shape to go by
+	unplaced := []ScheduledStop{{StopId: "A", Arrival: 100, Departure: 160}, {StopId: "B", Arrival: 220, Departure: 220}}
+	if _, ok := EstimatePosition(unplaced, 190, nil); ok {
+		t.Error("expected no position between stops without coordinates")
+	}
+}
@@ -0,0 +1,257 @@
+// Package mvt encodes Mapbox Vector Tiles (spec version 2). The protobuf
+// wire format is written by hand, the tile schema is small enough that a
+// generated codec is not worth the dependency.
+package mvt
+
+import (
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+)
+
+const (
+	geomPoint      = 1
+	geomLineString = 2
+
+	cmdMoveTo = 1
+	cmdLineTo = 2
+
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+type feature struct {
+	id       uint64
+	geomType uint64
+	tags     []uint32
+	geometry []uint32
+}
+
+type Layer struct {
+	Name   string
+	Extent uint32
+
+	features []feature
+	keys     []string
+	keyIndex map[string]uint32
+	values   []any
+	valIndex map[any]uint32
+}
+
+func NewLayer(name string, extent uint32) *Layer {
+	return &Layer{
+		Name:     name,
+		Extent:   extent,
+		keyIndex: make(map[string]uint32),
+		valIndex: make(map[any]uint32),
+	}
+}
+
+func (l *Layer) Len() int {
+	return len(l.features)
+}
+
+// AddPoint adds a point given in tile coordinates
+func (l *Layer) AddPoint(id uint64, p [2]int32, properties map[string]any) {
+	geometry := []uint32{command(cmdMoveTo, 1), zigzag(p[0]), zigzag(p[1])}
+	l.add(id, geomPoint, geometry, properties)
+}
+
+// AddLineString adds one (multi)line feature given in tile coordinates.
+// Lines with fewer than two points are skipped.
+func (l *Layer) AddLineString(id uint64, lines [][][2]int32, properties map[string]any) {
+	var (
+		geometry []uint32
+		cursor   [2]int32
+	)
+
+	for _, line := range lines {
+		if len(line) < 2 {
+			continue
+		}
+
+		geometry = append(geometry, command(cmdMoveTo, 1),
+			zigzag(line[0][0]-cursor[0]), zigzag(line[0][1]-cursor[1]))
+		cursor = line[0]
+
+		geometry = append(geometry, command(cmdLineTo, len(line)-1))
+		for _, p := range line[1:] {
+			geometry = append(geometry, zigzag(p[0]-cursor[0]), zigzag(p[1]-cursor[1]))
+			cursor = p
+		}
+	}
+
+	if len(geometry) == 0 {
+		return
+	}
+	l.add(id, geomLineString, geometry, properties)
+}
+
+func (l *Layer) add(id uint64, geomType uint64, geometry []uint32, properties map[string]any) {
+	f := feature{id: id, geomType: geomType, geometry: geometry}
+
+	// Sorted so the same input always encodes to the same bytes
+	for _, key := range slices.Sorted(maps.Keys(properties)) {
+		value, ok := normalize(properties[key])
+		if !ok {
+			continue
+		}
+		f.tags = append(f.tags, l.key(key), l.value(value))
+	}
+
+	l.features = append(l.features, f)
+}
+
+func (l *Layer) key(k string) uint32 {
+	if i, ok := l.keyIndex[k]; ok {
+		return i
+	}
+	i := uint32(len(l.keys))
+	l.keys = append(l.keys, k)
+	l.keyIndex[k] = i
+	return i
+}
+
+func (l *Layer) value(v any) uint32 {
+	if i, ok := l.valIndex[v]; ok {
+		return i
+	}
+	i := uint32(len(l.values))
+	l.values = append(l.values, v)
+	l.valIndex[v] = i
+	return i
+}
+
+// Maps property values onto the types a tile can hold, named types such as
+// models.Type are reduced to their underlying kind. Empty strings are dropped.
+func normalize(v any) (any, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), rv.String() != ""
+	case reflect.Bool:
+		return rv.Bool(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return nil, false
+}
+
+// Encode serializes the non-empty layers into a tile
+func Encode(layers ...*Layer) []byte {
+	var tile []byte
+	for _, l := range layers {
+		if len(l.features) == 0 {
+			continue
+		}
+		tile = appendBytes(tile, 3, l.encode())
+	}
+	return tile
+}
+
+func (l *Layer) encode() []byte {
+	var buf []byte
+
+	buf = appendString(buf, 1, l.Name)
+	for _, f := range l.features {
+		buf = appendBytes(buf, 2, f.encode())
+	}
+	for _, k := range l.keys {
+		buf = appendString(buf, 3, k)
+	}
+	for _, v := range l.values {
+		buf = appendBytes(buf, 4, encodeValue(v))
+	}
+	buf = appendUint(buf, 5, uint64(l.Extent))
+	buf = appendUint(buf, 15, 2)
+
+	return buf
+}
+
+func (f feature) encode() []byte {
+	var buf []byte
+
+	buf = appendUint(buf, 1, f.id)
+	if len(f.tags) > 0 {
+		buf = appendBytes(buf, 2, packed(f.tags))
+	}
+	buf = appendUint(buf, 3, f.geomType)
+	buf = appendBytes(buf, 4, packed(f.geometry))
+
+	return buf
+}
+
+func encodeValue(v any) []byte {
+	var buf []byte
+
+	switch v := v.(type) {
+	case string:
+		buf = appendString(buf, 1, v)
+	case float64:
+		buf = appendTag(buf, 3, 1)
+		bits := math.Float64bits(v)
+		for i := 0; i < 8; i++ {
+			buf = append(buf, byte(bits>>(8*i)))
+		}
+	case int64:
+		buf = appendUint(buf, 6, uint64((v<<1)^(v>>63)))
+	case uint64:
+		buf = appendUint(buf, 5, v)
+	case bool:
+		b := uint64(0)
+		if v {
+			b = 1
+		}
+		buf = appendUint(buf, 7, b)
+	}
+
+	return buf
+}
+
+func command(id, count int) uint32 {
+	return uint32(id&7) | uint32(count)<<3
+}
+
+func zigzag(v int32) uint32 {
+	return uint32((v << 1) ^ (v >> 31))
+}
+
+func packed(values []uint32) []byte {
+	buf := make([]byte, 0, len(values)*2)
+	for _, v := range values {
+		buf = appendVarint(buf, uint64(v))
+	}
+	return buf
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendTag(buf []byte, field int, wireType int) []byte {
+	return appendVarint(buf, uint64(field<<3|wireType))
+}
+
+func appendUint(buf []byte, field int, v uint64) []byte {
+	buf = appendTag(buf, field, wireVarint)
+	return appendVarint(buf, v)
+}
+
+func appendBytes(buf []byte, field int, data []byte) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = appendVarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func appendString(buf []byte, field int, s string) []byte {
+	return appendBytes(buf, field, []byte(s))
+}
@@ -0,0 +1,175 @@
+package mvt
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/paulmach/orb"
+	orbmvt "github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/encoding/mvt/vectortile"
+)
+
+// Reads a tile back with an independent protobuf codec
+func decodeRaw(t *testing.T, data []byte) *vectortile.Tile {
+	t.Helper()
+
+	var tile vectortile.Tile
+	if err := tile.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	return &tile
+}
+
+func TestGeometryCommands(t *testing.T) {
+	// The examples of section 4.3.5 of the spec
+	tests := []struct {
+		name string
+		add  func(*Layer)
+		want []uint32
+	}{
+		{
+			"point",
+			func(l *Layer) { l.AddPoint(1, [2]int32{25, 17}, nil) },
+			[]uint32{9, 50, 34},
+		},
+		{
+			"line",
+			func(l *Layer) { l.AddLineString(1, [][][2]int32{{{2, 2}, {2, 10}, {10, 10}}}, nil) },
+			[]uint32{9, 4, 4, 18, 0, 16, 16, 0},
+		},
+		{
+			// The second part starts relative to where the first ended
+			"multi line",
+			func(l *Layer) {
+				l.AddLineString(1, [][][2]int32{{{2, 2}, {2, 10}, {10, 10}}, {{1, 1}, {3, 5}}}, nil)
+			},
+			[]uint32{9, 4, 4, 18, 0, 16, 16, 0, 9, 17, 17, 10, 4, 8},
+		},
+		{
+			"degenerate part skipped",
+			func(l *Layer) { l.AddLineString(1, [][][2]int32{{{7, 7}}, {{2, 2}, {2, 10}}}, nil) },
+			[]uint32{9, 4, 4, 10, 0, 16},
+		},
+		{
+			// Inside the buffer left of and below the tile
+			"negative point",
+			func(l *Layer) { l.AddPoint(1, [2]int32{-64, 4160}, nil) },
+			[]uint32{9, 127, 8320},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			layer := NewLayer("test", 4096)
+			tc.add(layer)
+
+			tile := decodeRaw(t, Encode(layer))
+			if len(tile.Layers) != 1 || len(tile.Layers[0].Features) != 1 {
+				t.Fatalf("expected one layer with one feature, got %+v", tile.Layers)
+			}
+			if got := tile.Layers[0].Features[0].Geometry; !slices.Equal(got, tc.want) {
+				t.Errorf("geometry %v, expected %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEmptyGeometrySkipped(t *testing.T) {
+	layer := NewLayer("test", 4096)
+	layer.AddLineString(1, nil, nil)
+	layer.AddLineString(2, [][][2]int32{{{1, 1}}}, nil)
+	if layer.Len() != 0 {
+		t.Errorf("expected no features, got %d", layer.Len())
+	}
+	if tile := Encode(layer); len(tile) != 0 {
+		t.Errorf("expected an empty tile, got %d bytes", len(tile))
+	}
+}
+
+type routeType int
+
+func TestRoundTrip(t *testing.T) {
+	stops := NewLayer("stops", 4096)
+	stops.AddPoint(1, [2]int32{100, 200}, map[string]any{
+		"name":     "Centrum",
+		"type":     routeType(3),
+		"count":    uint(7),
+		"offset":   -2,
+		"distance": 12.5,
+		"lit":      true,
+		"empty":    "",
+		"skipped":  []string{"not a tile value"},
+	})
+	stops.AddPoint(2, [2]int32{-10, 4100}, map[string]any{"name": "Centrum", "type": routeType(3)})
+	routes := NewLayer("routes", 4096)
+	routes.AddLineString(3, [][][2]int32{{{0, 0}, {4096, 4096}}, {{-64, 2048}, {4160, 2048}}}, nil)
+	empty := NewLayer("empty", 4096)
+
+	data := Encode(routes, stops, empty)
+
+	raw := decodeRaw(t, data)
+	if len(raw.Layers) != 2 {
+		t.Fatalf("expected the empty layer left out, got %d layers", len(raw.Layers))
+	}
+	for _, l := range raw.Layers {
+		if l.GetVersion() != 2 || l.GetExtent() != 4096 {
+			t.Errorf("layer %s: version %d, extent %d", l.GetName(), l.GetVersion(), l.GetExtent())
+		}
+	}
+	// Keys and values shared by both stops are stored once
+	if keys, values := len(raw.Layers[1].Keys), len(raw.Layers[1].Values); keys != 6 || values != 6 {
+		t.Errorf("expected 6 keys and 6 values, got %d and %d", keys, values)
+	} else {
+		// Each kind in its own field, in the order of the sorted keys
+		v := raw.Layers[1].Values
+		if v[0].GetUintValue() != 7 || v[1].GetDoubleValue() != 12.5 || !v[2].GetBoolValue() ||
+			v[3].GetStringValue() != "Centrum" || v[4].GetSintValue() != -2 || v[5].GetSintValue() != 3 {
+			t.Errorf("values %v", v)
+		}
+	}
+
+	layers, err := orbmvt.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := layers.ToFeatureCollections()
+
+	got := byName["routes"].Features
+	// The decoder hands IDs out as float64
+	if len(got) != 1 || got[0].ID != float64(3) {
+		t.Fatalf("expected route 3, got %+v", got)
+	}
+	want := orb.MultiLineString{
+		{{0, 0}, {4096, 4096}},
+		{{-64, 2048}, {4160, 2048}},
+	}
+	if !orb.Equal(got[0].Geometry, want) {
+		t.Errorf("route geometry %v, expected %v", got[0].Geometry, want)
+	}
+
+	got = byName["stops"].Features
+	if len(got) != 2 {
+		t.Fatalf("expected two stops, got %d", len(got))
+	}
+	if !orb.Equal(got[0].Geometry, orb.Point{100, 200}) || !orb.Equal(got[1].Geometry, orb.Point{-10, 4100}) {
+		t.Errorf("stop geometries %v and %v", got[0].Geometry, got[1].Geometry)
+	}
+
+	properties := got[0].Properties
+	wantProperties := map[string]any{
+		"name":     "Centrum",
+		"type":     float64(3),
+		"count":    float64(7),
+		"offset":   float64(-2),
+		"distance": 12.5,
+		"lit":      true,
+	}
+	if len(properties) != len(wantProperties) {
+		t.Errorf("properties %v, expected %v", properties, wantProperties)
+	}
+	for k, v := range wantProperties {
+		if properties[k] != v {
+			t.Errorf("property %s is %v (%T), expected %v", k, properties[k], properties[k], v)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package parser
+
+import (
+	"archive/zip"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+func parseTransfers(s string) int {
+	if s == "" {
+		return models.UNLIMITED_TRANSFERS
+	}
+	return parseInt(s)
+}
+
+func GetFareAttributes(zipReader *zip.ReadCloser) []models.FareAttribute {
+	file := openOptional(zipReader, "fare_attributes.txt")
+	if file == nil {
+		return []models.FareAttribute{}
+	}
+	defer file.Close()
+
+	var fares []models.FareAttribute
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		fare := models.FareAttribute{
+			FareId:           intern(getVal(row, idx, "fare_id")),
+			Price:            parseFloat(getVal(row, idx, "price")),
+			CurrencyType:     intern(getVal(row, idx, "currency_type")),
+			PaymentMethod:    models.PaymentMethod(parseUint(getVal(row, idx, "payment_method"))),
+			Transfers:        parseTransfers(getVal(row, idx, "transfers")),
+			AgencyId:         intern(getVal(row, idx, "agency_id")),
+			TransferDuration: parseInt(getVal(row, idx, "transfer_duration")),
+		}
+
+		fares = append(fares, fare)
+	})
+
+	return fares
+}
+
+func GetFareRules(zipReader *zip.ReadCloser) []models.FareRule {
+	file := openOptional(zipReader, "fare_rules.txt")
+	if file == nil {
+		return []models.FareRule{}
+	}
+	defer file.Close()
+
+	var rules []models.FareRule
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		rule := models.FareRule{
+			FareId:        intern(getVal(row, idx, "fare_id")),
+			RouteId:       intern(getVal(row, idx, "route_id")),
+			OriginId:      intern(getVal(row, idx, "origin_id")),
+			DestinationId: intern(getVal(row, idx, "destination_id")),
+			ContainsId:    intern(getVal(row, idx, "contains_id")),
+		}
+
+		rules = append(rules, rule)
+	})
+
+	return rules
+}
+
+func parseTransferCount(s string) int {
+	if s == "" {
+		return models.UNLIMITED_TRANSFERS
+	}
+	return parseInt(s)
+}
+
+func GetFareProducts(zipReader *zip.ReadCloser) []models.FareProduct {
+	var products []models.FareProduct
+
+	file := openOptional(zipReader, "fare_products.txt")
+	if file == nil {
+		return products
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		product := models.FareProduct{
+			FareProductId:   intern(getVal(row, idx, "fare_product_id")),
+			FareProductName: intern(getVal(row, idx, "fare_product_name")),
+			FareMediaId:     intern(getVal(row, idx, "fare_media_id")),
+			Amount:          parseFloat(getVal(row, idx, "amount")),
+			Currency:        intern(getVal(row, idx, "currency")),
+		}
+
+		products = append(products, product)
+	})
+
+	return products
+}
+
+func GetFareMedia(zipReader *zip.ReadCloser) []models.FareMedia {
+	var media []models.FareMedia
+
+	file := openOptional(zipReader, "fare_media.txt")
+	if file == nil {
+		return media
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		medium := models.FareMedia{
+			FareMediaId:   intern(getVal(row, idx, "fare_media_id")),
+			FareMediaName: intern(getVal(row, idx, "fare_media_name")),
+			FareMediaType: models.FareMediaType(parseUint(getVal(row, idx, "fare_media_type"))),
+		}
+
+		media = append(media, medium)
+	})
+
+	return media
+}
+
+func GetFareLegRules(zipReader *zip.ReadCloser) []models.FareLegRule {
+	var rules []models.FareLegRule
+
+	file := openOptional(zipReader, "fare_leg_rules.txt")
+	if file == nil {
+		return rules
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		rule := models.FareLegRule{
+			LegGroupId:           intern(getVal(row, idx, "leg_group_id")),
+			NetworkId:            intern(getVal(row, idx, "network_id")),
+			FromAreaId:           intern(getVal(row, idx, "from_area_id")),
+			ToAreaId:             intern(getVal(row, idx, "to_area_id")),
+			FromTimeframeGroupId: intern(getVal(row, idx, "from_timeframe_group_id")),
+			ToTimeframeGroupId:   intern(getVal(row, idx, "to_timeframe_group_id")),
+			FareProductId:        intern(getVal(row, idx, "fare_product_id")),
+		}
+		if _, ok := idx["rule_priority"]; ok {
+			priority := parseInt(getVal(row, idx, "rule_priority"))
+			rule.RulePriority = &priority
+		}
+
+		rules = append(rules, rule)
+	})
+
+	return rules
+}
+
+func GetFareTransferRules(zipReader *zip.ReadCloser) []models.FareTransferRule {
+	var rules []models.FareTransferRule
+
+	file := openOptional(zipReader, "fare_transfer_rules.txt")
+	if file == nil {
+		return rules
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		rule := models.FareTransferRule{
+			FromLegGroupId:    intern(getVal(row, idx, "from_leg_group_id")),
+			ToLegGroupId:      intern(getVal(row, idx, "to_leg_group_id")),
+			TransferCount:     parseTransferCount(getVal(row, idx, "transfer_count")),
+			DurationLimit:     parseInt(getVal(row, idx, "duration_limit")),
+			DurationLimitType: models.DurationLimitType(parseUint(getVal(row, idx, "duration_limit_type"))),
+			FareTransferType:  models.FareTransferType(parseUint(getVal(row, idx, "fare_transfer_type"))),
+			FareProductId:     intern(getVal(row, idx, "fare_product_id")),
+		}
+
+		rules = append(rules, rule)
+	})
+
+	return rules
+}
+
+func GetAreas(zipReader *zip.ReadCloser) []models.Area {
+	var areas []models.Area
+
+	file := openOptional(zipReader, "areas.txt")
+	if file == nil {
+		return areas
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		area := models.Area{
+			AreaId:   intern(getVal(row, idx, "area_id")),
+			AreaName: intern(getVal(row, idx, "area_name")),
+		}
+
+		areas = append(areas, area)
+	})
+
+	return areas
+}
+
+func GetStopAreas(zipReader *zip.ReadCloser) []models.StopArea {
+	var stopAreas []models.StopArea
+
+	file := openOptional(zipReader, "stop_areas.txt")
+	if file == nil {
+		return stopAreas
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		stopArea := models.StopArea{
+			AreaId: intern(getVal(row, idx, "area_id")),
+			StopId: intern(getVal(row, idx, "stop_id")),
+		}
+
+		stopAreas = append(stopAreas, stopArea)
+	})
+
+	return stopAreas
+}
+
+func GetNetworks(zipReader *zip.ReadCloser) []models.Network {
+	var networks []models.Network
+
+	file := openOptional(zipReader, "networks.txt")
+	if file == nil {
+		return networks
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		network := models.Network{
+			NetworkId:   intern(getVal(row, idx, "network_id")),
+			NetworkName: intern(getVal(row, idx, "network_name")),
+		}
+
+		networks = append(networks, network)
+	})
+
+	return networks
+}
+
+func GetRouteNetworks(zipReader *zip.ReadCloser) []models.RouteNetwork {
+	var routeNetworks []models.RouteNetwork
+
+	file := openOptional(zipReader, "route_networks.txt")
+	if file == nil {
+		return routeNetworks
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		routeNetwork := models.RouteNetwork{
+			NetworkId: intern(getVal(row, idx, "network_id")),
+			RouteId:   intern(getVal(row, idx, "route_id")),
+		}
+
+		routeNetworks = append(routeNetworks, routeNetwork)
+	})
+
+	return routeNetworks
+}
+
+func GetTimeframes(zipReader *zip.ReadCloser) []models.Timeframe {
+	var timeframes []models.Timeframe
+
+	file := openOptional(zipReader, "timeframes.txt")
+	if file == nil {
+		return timeframes
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		timeframe := models.Timeframe{
+			TimeframeGroupId: intern(getVal(row, idx, "timeframe_group_id")),
+			StartTime:        intern(getVal(row, idx, "start_time")),
+			EndTime:          intern(getVal(row, idx, "end_time")),
+			ServiceId:        intern(getVal(row, idx, "service_id")),
+		}
+
+		timeframes = append(timeframes, timeframe)
+	})
+
+	return timeframes
+}
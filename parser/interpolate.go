@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+)
+
+// InterpolateStopTimes fills in blank arrival and departure times of a single
+// trip, ordered by stop_sequence. Times are spread between the surrounding
+// timed stops proportionally to shape_dist_traveled when every stop in the
+// gap has it and it never decreases, and to straight-line distance between
+// stops otherwise. Stops before the first or after the last timed stop are
+// left blank.
+// Filled in stop times are marked Interpolated and APPROXIMATE.
+func InterpolateStopTimes(deps []models.Departure, stops map[string]models.Stop) {
+	// A stop with only one of the times given simply waits zero seconds
+	for i := range deps {
+		if deps[i].ArrivalTime == "" {
+			deps[i].ArrivalTime = deps[i].DepartureTime
+		}
+		if deps[i].DepartureTime == "" {
+			deps[i].DepartureTime = deps[i].ArrivalTime
+		}
+	}
+
+	prev := -1
+	for i := range deps {
+		if deps[i].DepartureTime == "" {
+			continue
+		}
+
+		if prev >= 0 && i-prev > 1 {
+			interpolateGap(deps[prev:i+1], stops)
+		}
+		prev = i
+	}
+}
+
+// Fills the stop times strictly between the first and last element of gap
+func interpolateGap(gap []models.Departure, stops map[string]models.Stop) {
+	start, ok := utils.ParseGTFSTime(gap[0].DepartureTime)
+	if !ok {
+		return
+	}
+	end, ok := utils.ParseGTFSTime(gap[len(gap)-1].ArrivalTime)
+	if !ok || end < start {
+		return
+	}
+
+	dists := gapDistances(gap, stops)
+	total := dists[len(dists)-1]
+
+	for k := 1; k < len(gap)-1; k++ {
+		// Without any usable distances the stops are spaced evenly
+		fraction := float64(k) / float64(len(gap)-1)
+		if total > 0 {
+			fraction = dists[k] / total
+		}
+
+		t := utils.FormatGTFSTime(start + int(fraction*float64(end-start)+0.5))
+		gap[k].ArrivalTime = t
+		gap[k].DepartureTime = t
+		gap[k].Timepoint = models.APPROXIMATE
+		gap[k].Interpolated = true
+	}
+}
+
+// Cumulative distance of every stop of the gap from its first stop
+func gapDistances(gap []models.Departure, stops map[string]models.Stop) []float64 {
+	dists := make([]float64, len(gap))
+
+	// A distance going backwards would put the stop times out of order
+	useShape := true
+	for k, dep := range gap {
+		if dep.ShapeDistTraveled == nil || k > 0 && *dep.ShapeDistTraveled < *gap[k-1].ShapeDistTraveled {
+			useShape = false
+			break
+		}
+	}
+
+	if useShape {
+		for k := range gap {
+			dists[k] = *gap[k].ShapeDistTraveled - *gap[0].ShapeDistTraveled
+		}
+		return dists
+	}
+
+	for k := 1; k < len(gap); k++ {
+		a, aOk := stops[gap[k-1].StopId]
+		b, bOk := stops[gap[k].StopId]
+
+		dists[k] = dists[k-1]
+		if aOk && bOk {
+			dists[k] += geo.Distance(a.StopLat, a.StopLon, b.StopLat, b.StopLon)
+		}
+	}
+
+	return dists
+}
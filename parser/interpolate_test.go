@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"testing"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+// Stops A to E on a meridian, 1 km apart except for D, only 100 m past C
+var interpolationStops = map[string]models.Stop{
+	"A": {StopId: "A", StopLat: 52, StopLon: 21},
+	"B": {StopId: "B", StopLat: 52.008993, StopLon: 21},
+	"C": {StopId: "C", StopLat: 52.017986, StopLon: 21},
+	"D": {StopId: "D", StopLat: 52.018885, StopLon: 21},
+	"E": {StopId: "E", StopLat: 52.027878, StopLon: 21},
+}
+
+type stopTime struct {
+	stop      string
+	arrival   string
+	departure string
+	dist      *float64
+}
+
+func dist(d float64) *float64 {
+	return &d
+}
+
+func TestInterpolateStopTimes(t *testing.T) {
+	tests := []struct {
+		name  string
+		trip  []stopTime
+		times []string
+	}{
+		{
+			"straight line",
+			[]stopTime{
+				{"A", "08:00:00", "08:00:00", nil},
+				{"B", "", "", nil},
+				{"C", "", "", nil},
+				{"D", "08:21:00", "08:22:00", nil},
+			},
+			[]string{"08:00:00", "08:10:00", "08:20:00", "08:21:00"},
+		},
+		{
+			"shape distance",
+			[]stopTime{
+				{"A", "08:00:00", "08:00:00", dist(0)},
+				{"B", "", "", dist(300)},
+				{"C", "", "", dist(900)},
+				{"D", "08:10:00", "08:10:00", dist(1000)},
+			},
+			[]string{"08:00:00", "08:03:00", "08:09:00", "08:10:00"},
+		},
+		{
+			// B's distance goes backwards, the straight line takes over
+			"shape distance decreasing",
+			[]stopTime{
+				{"A", "08:00:00", "08:00:00", dist(0)},
+				{"B", "", "", dist(900)},
+				{"C", "", "", dist(300)},
+				{"D", "08:21:00", "08:21:00", dist(1000)},
+			},
+			[]string{"08:00:00", "08:10:00", "08:20:00", "08:21:00"},
+		},
+		{
+			"shape distance missing",
+			[]stopTime{
+				{"A", "08:00:00", "08:00:00", dist(0)},
+				{"B", "", "", nil},
+				{"C", "", "", dist(900)},
+				{"D", "08:21:00", "08:21:00", dist(1000)},
+			},
+			[]string{"08:00:00", "08:10:00", "08:20:00", "08:21:00"},
+		},
+		{
+			// Only one time given, the other is the same
+			"half timed stop",
+			[]stopTime{
+				{"A", "", "08:00:00", nil},
+				{"B", "", "", nil},
+				{"C", "08:20:00", "", nil},
+			},
+			[]string{"08:00:00", "08:10:00", "08:20:00"},
+		},
+		{
+			"past midnight",
+			[]stopTime{
+				{"A", "23:50:00", "23:50:00", dist(0)},
+				{"B", "", "", dist(1)},
+				{"C", "24:10:00", "24:10:00", dist(2)},
+			},
+			[]string{"23:50:00", "24:00:00", "24:10:00"},
+		},
+		{
+			// Nothing to interpolate from before the first or after the
+			// last timed stop
+			"gaps at the ends",
+			[]stopTime{
+				{"A", "", "", nil},
+				{"B", "08:00:00", "08:00:00", nil},
+				{"C", "", "", nil},
+				{"D", "08:11:00", "08:11:00", nil},
+				{"E", "", "", nil},
+			},
+			[]string{"", "08:00:00", "08:10:00", "08:11:00", ""},
+		},
+		{
+			"stops at the same spot",
+			[]stopTime{
+				{"A", "08:00:00", "08:00:00", nil},
+				{"A", "", "", nil},
+				{"A", "", "", nil},
+				{"A", "08:03:00", "08:03:00", nil},
+			},
+			[]string{"08:00:00", "08:01:00", "08:02:00", "08:03:00"},
+		},
+		{
+			"times going backwards",
+			[]stopTime{
+				{"A", "08:10:00", "08:10:00", nil},
+				{"B", "", "", nil},
+				{"C", "08:00:00", "08:00:00", nil},
+			},
+			[]string{"08:10:00", "", "08:00:00"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			deps := make([]models.Departure, len(tc.trip))
+			for i, st := range tc.trip {
+				deps[i] = models.Departure{
+					StopId:            st.stop,
+					StopSequence:      i + 1,
+					ArrivalTime:       st.arrival,
+					DepartureTime:     st.departure,
+					ShapeDistTraveled: st.dist,
+				}
+			}
+
+			InterpolateStopTimes(deps, interpolationStops)
+
+			for i, dep := range deps {
+				if dep.ArrivalTime != tc.times[i] {
+					t.Errorf("stop %d arrives at %q, expected %q", i+1, dep.ArrivalTime, tc.times[i])
+				}
+				// Filled in stops don't wait
+				given := tc.trip[i].arrival != "" || tc.trip[i].departure != ""
+				if !given && dep.DepartureTime != dep.ArrivalTime {
+					t.Errorf("stop %d departs at %q, arrives at %q", i+1, dep.DepartureTime, dep.ArrivalTime)
+				}
+				if interpolated := !given && tc.times[i] != ""; dep.Interpolated != interpolated {
+					t.Errorf("stop %d interpolated is %v, expected %v", i+1, dep.Interpolated, interpolated)
+				} else if interpolated && dep.Timepoint != models.APPROXIMATE {
+					t.Errorf("stop %d timepoint is %v, expected approximate", i+1, dep.Timepoint)
+				}
+			}
+		})
+	}
+}
@@ -3,13 +3,16 @@ package parser
 import (
 	"archive/zip"
 	"encoding/csv"
+	"errors"
 	"io"
 	"io/fs"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
 )
 
 func parseDate(s string) time.Time {
@@ -119,6 +122,18 @@ func parseCSV(file fs.File, callback func(record []string, idxMap map[string]int
 	}
 }
 
+// Opens an optional feed file, returning nil if the feed doesn't have it
+func openOptional(zipReader *zip.ReadCloser, name string) fs.File {
+	file, err := zipReader.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		panic(err)
+	}
+	return file
+}
+
 // Helper to safely get a value from the slice using the index map
 func getVal(record []string, idxMap map[string]int, key string) string {
 	if idx, ok := idxMap[key]; ok && idx < len(record) {
@@ -164,6 +179,7 @@ func GetStops(zipReader *zip.ReadCloser) []models.Stop {
 			PlatformCode:       intern(getVal(row, idx, "platform_code")),
 			WheelchairBoarding: models.Accessibility(parseUint(getVal(row, idx, "wheelchair_boarding"))),
 			LocationType:       models.Location(parseUint(getVal(row, idx, "location_type"))),
+			LevelId:            intern(getVal(row, idx, "level_id")),
 		}
 
 		stops = append(stops, stop)
@@ -189,6 +205,7 @@ func GetRoutes(zipReader *zip.ReadCloser) []models.Route {
 			RouteUrl:         intern(getVal(row, idx, "route_url")),
 			RouteColor:       intern(getVal(row, idx, "route_color")),
 			RouteTextColor:   intern(getVal(row, idx, "route_text_color")),
+			NetworkId:        intern(getVal(row, idx, "network_id")),
 		}
 
 		routes = append(routes, route)
@@ -223,6 +240,60 @@ func GetTrips(zipReader *zip.ReadCloser) []models.Trip {
 	return trips
 }
 
+func parseOptionalFloat(s string) *float64 {
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// Like parseUint, but with the spec default for an empty value
+func parseUintOr(s string, def uint8) uint8 {
+	if s == "" {
+		return def
+	}
+	return parseUint(s)
+}
+
+// Zero-pads a time, feeds may write 8:00:00, so times sort and compare as
+// strings. Blank and malformed times are left as they are.
+func normalizeTime(s string) string {
+	if secs, ok := utils.ParseGTFSTime(s); ok {
+		return utils.FormatGTFSTime(secs)
+	}
+	return s
+}
+
+func parseDeparture(row []string, idx map[string]int) models.Departure {
+	arrival := normalizeTime(getVal(row, idx, "arrival_time"))
+	departure := normalizeTime(getVal(row, idx, "departure_time"))
+
+	// Stop times with times given are exact unless said otherwise
+	timepoint := models.APPROXIMATE
+	if arrival != "" || departure != "" {
+		timepoint = models.EXACT
+	}
+
+	return models.Departure{
+		TripId:            intern(getVal(row, idx, "trip_id")),
+		StopId:            intern(getVal(row, idx, "stop_id")),
+		ArrivalTime:       intern(arrival),
+		DepartureTime:     intern(departure),
+		StopSequence:      parseInt(getVal(row, idx, "stop_sequence")),
+		PickupType:        models.PickupOrDropoff(parseUint(getVal(row, idx, "pickup_type"))),
+		DropoffType:       models.PickupOrDropoff(parseUint(getVal(row, idx, "drop_off_type"))),
+		StopHeadsign:      intern(getVal(row, idx, "stop_headsign")),
+		Timepoint:         models.Timepoint(parseUintOr(getVal(row, idx, "timepoint"), uint8(timepoint))),
+		ShapeDistTraveled: parseOptionalFloat(getVal(row, idx, "shape_dist_traveled")),
+		ContinuousPickup:  models.PickupOrDropoff(parseUintOr(getVal(row, idx, "continuous_pickup"), uint8(models.NO_CONTINUOUS))),
+		ContinuousDropOff: models.PickupOrDropoff(parseUintOr(getVal(row, idx, "continuous_drop_off"), uint8(models.NO_CONTINUOUS))),
+	}
+}
+
 func GetDepartures(zipReader *zip.ReadCloser) []models.Departure {
 	file, _ := zipReader.Open("stop_times.txt")
 	defer file.Close()
@@ -230,15 +301,7 @@ func GetDepartures(zipReader *zip.ReadCloser) []models.Departure {
 	var departures []models.Departure
 
 	parseCSV(file, func(row []string, idx map[string]int) {
-		departure := models.Departure{
-			TripId:        intern(getVal(row, idx, "trip_id")),
-			StopId:        intern(getVal(row, idx, "stop_id")),
-			ArrivalTime:   intern(getVal(row, idx, "arrival_time")),
-			DepartureTime: intern(getVal(row, idx, "departure_time")),
-			StopSequence:  parseInt(getVal(row, idx, "stop_sequence")),
-			PickupType:    models.PickupOrDropoff(parseUint(getVal(row, idx, "pickup_type"))),
-			DropoffType:   models.PickupOrDropoff(parseUint(getVal(row, idx, "drop_off_type"))),
-		}
+		departure := parseDeparture(row, idx)
 
 		departures = append(departures, departure)
 	})
@@ -340,24 +403,76 @@ func GetShapes(zipReader *zip.ReadCloser) []models.Shape {
 	return shapes
 }
 
-func ProcessDeparturesChunked(zipReader *zip.ReadCloser, batchSize int, callback func(departures []models.Departure)) {
+// ProcessDeparturesChunked calls back with batches of roughly batchSize stop
+// times. Stop times of a trip are kept in the same batch as long as the feed
+// lists them contiguously, and are interpolated where their times are blank.
+func ProcessDeparturesChunked(zipReader *zip.ReadCloser, batchSize int, stops map[string]models.Stop, callback func(departures []models.Departure)) {
 	file, _ := zipReader.Open("stop_times.txt")
 	defer file.Close()
 
+	// Stop times of the last trip of a batch, which may continue in the next one
+	var carry []models.Departure
+
+	emit := func(departures []models.Departure) {
+		start := 0
+		for i := 1; i <= len(departures); i++ {
+			if i == len(departures) || departures[i].TripId != departures[start].TripId {
+				trip := departures[start:i]
+				sort.SliceStable(trip, func(a, b int) bool {
+					return trip[a].StopSequence < trip[b].StopSequence
+				})
+				InterpolateStopTimes(trip, stops)
+				start = i
+			}
+		}
+		callback(departures)
+	}
+
 	parseCSVChunked(file, batchSize, func(records [][]string, idx map[string]int) {
-		var departures []models.Departure
+		departures := carry
+		carry = nil
 		for _, row := range records {
-			departure := models.Departure{
-				TripId:        intern(getVal(row, idx, "trip_id")),
-				StopId:        intern(getVal(row, idx, "stop_id")),
-				ArrivalTime:   intern(getVal(row, idx, "arrival_time")),
-				DepartureTime: intern(getVal(row, idx, "departure_time")),
-				StopSequence:  parseInt(getVal(row, idx, "stop_sequence")),
-				PickupType:    models.PickupOrDropoff(parseUint(getVal(row, idx, "pickup_type"))),
-				DropoffType:   models.PickupOrDropoff(parseUint(getVal(row, idx, "drop_off_type"))),
-			}
+			departure := parseDeparture(row, idx)
 			departures = append(departures, departure)
 		}
-		callback(departures)
+
+		last := len(departures) - 1
+		cut := last
+		for cut > 0 && departures[cut-1].TripId == departures[last].TripId {
+			cut--
+		}
+
+		carry = append(carry, departures[cut:]...)
+		if cut > 0 {
+			emit(departures[:cut])
+		}
 	})
+
+	if len(carry) > 0 {
+		emit(carry)
+	}
+}
+
+func GetFrequencies(zipReader *zip.ReadCloser) []models.Frequency {
+	file := openOptional(zipReader, "frequencies.txt")
+	if file == nil {
+		return []models.Frequency{}
+	}
+	defer file.Close()
+
+	var frequencies []models.Frequency
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		frequency := models.Frequency{
+			TripId:      intern(getVal(row, idx, "trip_id")),
+			StartTime:   intern(getVal(row, idx, "start_time")),
+			EndTime:     intern(getVal(row, idx, "end_time")),
+			HeadwaySecs: parseInt(getVal(row, idx, "headway_secs")),
+			ExactTimes:  parseBool(getVal(row, idx, "exact_times")),
+		}
+
+		frequencies = append(frequencies, frequency)
+	})
+
+	return frequencies
 }
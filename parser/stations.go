@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"archive/zip"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+func GetPathways(zipReader *zip.ReadCloser) []models.Pathway {
+	var pathways []models.Pathway
+
+	file := openOptional(zipReader, "pathways.txt")
+	if file == nil {
+		return pathways
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		pathway := models.Pathway{
+			PathwayId:            intern(getVal(row, idx, "pathway_id")),
+			FromStopId:           intern(getVal(row, idx, "from_stop_id")),
+			ToStopId:             intern(getVal(row, idx, "to_stop_id")),
+			PathwayMode:          models.PathwayMode(parseUint(getVal(row, idx, "pathway_mode"))),
+			IsBidirectional:      parseBool(getVal(row, idx, "is_bidirectional")),
+			Length:               parseFloat(getVal(row, idx, "length")),
+			TraversalTime:        parseInt(getVal(row, idx, "traversal_time")),
+			StairCount:           parseInt(getVal(row, idx, "stair_count")),
+			MaxSlope:             parseFloat(getVal(row, idx, "max_slope")),
+			MinWidth:             parseFloat(getVal(row, idx, "min_width")),
+			SignpostedAs:         intern(getVal(row, idx, "signposted_as")),
+			ReversedSignpostedAs: intern(getVal(row, idx, "reversed_signposted_as")),
+		}
+
+		pathways = append(pathways, pathway)
+	})
+
+	return pathways
+}
+
+func GetLevels(zipReader *zip.ReadCloser) []models.Level {
+	var levels []models.Level
+
+	file := openOptional(zipReader, "levels.txt")
+	if file == nil {
+		return levels
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		level := models.Level{
+			LevelId:    intern(getVal(row, idx, "level_id")),
+			LevelIndex: parseFloat(getVal(row, idx, "level_index")),
+			LevelName:  intern(getVal(row, idx, "level_name")),
+		}
+
+		levels = append(levels, level)
+	})
+
+	return levels
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"archive/zip"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+func GetTranslations(zipReader *zip.ReadCloser) []models.Translation {
+	var translations []models.Translation
+
+	file := openOptional(zipReader, "translations.txt")
+	if file == nil {
+		return translations
+	}
+	defer file.Close()
+
+	parseCSV(file, func(row []string, idx map[string]int) {
+		translation := models.Translation{
+			TableName:   intern(getVal(row, idx, "table_name")),
+			FieldName:   intern(getVal(row, idx, "field_name")),
+			Language:    intern(getVal(row, idx, "language")),
+			Translation: intern(getVal(row, idx, "translation")),
+			RecordId:    intern(getVal(row, idx, "record_id")),
+			RecordSubId: intern(getVal(row, idx, "record_sub_id")),
+			FieldValue:  intern(getVal(row, idx, "field_value")),
+		}
+
+		translations = append(translations, translation)
+	})
+
+	return translations
+}
+
+// GetFeedInfo returns the first row of feed_info.txt, or an empty FeedInfo
+// if the feed doesn't have one
+func GetFeedInfo(zipReader *zip.ReadCloser) models.FeedInfo {
+	var info models.FeedInfo
+
+	file := openOptional(zipReader, "feed_info.txt")
+	if file == nil {
+		return info
+	}
+	defer file.Close()
+
+	read := false
+	parseCSV(file, func(row []string, idx map[string]int) {
+		if read {
+			return
+		}
+		read = true
+
+		info = models.FeedInfo{
+			FeedPublisherName: getVal(row, idx, "feed_publisher_name"),
+			FeedPublisherUrl:  getVal(row, idx, "feed_publisher_url"),
+			FeedLang:          getVal(row, idx, "feed_lang"),
+			DefaultLang:       getVal(row, idx, "default_lang"),
+			FeedStartDate:     parseDate(getVal(row, idx, "feed_start_date")),
+			FeedEndDate:       parseDate(getVal(row, idx, "feed_end_date")),
+			FeedVersion:       getVal(row, idx, "feed_version"),
+			FeedContactEmail:  getVal(row, idx, "feed_contact_email"),
+			FeedContactUrl:    getVal(row, idx, "feed_contact_url"),
+		}
+	})
+
+	return info
+}
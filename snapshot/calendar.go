@@ -0,0 +1,77 @@
+package snapshot
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+// ServicesForDate is database.GetServicesForDate served from memory
+func (s *Snapshot) ServicesForDate(date time.Time) []models.ServiceSummary {
+	active := s.activeServices(date)
+
+	summaries := []models.ServiceSummary{}
+	for i, id := range s.services {
+		if active[i] {
+			summaries = append(summaries, models.ServiceSummary{ServiceId: id, TripCount: s.serviceTrips[i]})
+		}
+	}
+	slices.SortFunc(summaries, func(a, b models.ServiceSummary) int {
+		return strings.Compare(a.ServiceId, b.ServiceId)
+	})
+	return summaries
+}
+
+// ServiceOverview is database.GetServiceOverview served from memory
+func (s *Snapshot) ServiceOverview(from time.Time, days int) []models.ServiceDay {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+
+	overview := make([]models.ServiceDay, days)
+	for i := range overview {
+		d := start.AddDate(0, 0, i)
+		overview[i].Date = d.Format("2006-01-02")
+
+		day := dayNumber(d)
+		for service, dates := range s.serviceDates {
+			if _, ok := slices.BinarySearch(dates, day); ok {
+				overview[i].ServiceCount++
+				overview[i].TripCount += s.serviceTrips[service]
+			}
+		}
+	}
+	return overview
+}
+
+// ServiceDetail is database.GetServiceDetail served from memory
+func (s *Snapshot) ServiceDetail(id string) (models.ServiceDetail, bool) {
+	detail := models.ServiceDetail{ServiceId: id}
+
+	if cal, ok := s.calendars[id]; ok {
+		detail.Calendar = &cal
+	}
+	exceptions := s.exceptions[id]
+	if detail.Calendar == nil && len(exceptions) == 0 {
+		return detail, false
+	}
+
+	for _, cd := range exceptions {
+		switch cd.ExceptionType {
+		case models.SERVICE_ADDED:
+			detail.AddedDates = append(detail.AddedDates, cd.Date.Format("2006-01-02"))
+		case models.SERVICE_REMOVED:
+			detail.RemovedDates = append(detail.RemovedDates, cd.Date.Format("2006-01-02"))
+		}
+	}
+
+	detail.Dates = []string{}
+	if service, ok := s.serviceIndex[id]; ok {
+		for _, day := range s.serviceDates[service] {
+			detail.Dates = append(detail.Dates, dayTime(day).Format("2006-01-02"))
+		}
+		detail.TripCount = s.serviceTrips[service]
+	}
+
+	return detail, true
+}
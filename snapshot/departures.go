@@ -0,0 +1,193 @@
+package snapshot
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+)
+
+// Stop indexes a board at stop covers, a station stands for its platforms
+func (s *Snapshot) boardStops(stop string) []int32 {
+	i, ok := s.stopIndex[stop]
+	if !ok {
+		return nil
+	}
+	return append([]int32{i}, s.children[i]...)
+}
+
+func (s *Snapshot) headsign(row int32) string {
+	if h := s.stHeadsign[row]; h >= 0 {
+		return s.headsigns[h]
+	}
+	return ""
+}
+
+func (s *Snapshot) isLast(row int32) bool {
+	return row == s.tripEnd[s.stTrip[row]]-1
+}
+
+func (s *Snapshot) isFirst(row int32) bool {
+	return row == s.tripStart[s.stTrip[row]]
+}
+
+// Mirrors models.DepartureFilter on everything but the time window
+func (s *Snapshot) matches(row int32, filter models.DepartureFilter, arrivals bool) bool {
+	t := s.stTrip[row]
+	trip := s.trips[t]
+
+	if len(filter.Routes) > 0 && !slices.Contains(filter.Routes, trip.RouteId) {
+		return false
+	}
+	if len(filter.RouteTypes) > 0 && (s.tripRoute[t] < 0 || !slices.Contains(filter.RouteTypes, s.routes[s.tripRoute[t]].RouteType)) {
+		return false
+	}
+	if filter.Direction != nil && trip.DirectionId != *filter.Direction {
+		return false
+	}
+	if filter.Headsign != "" {
+		headsign := s.headsign(row)
+		if headsign == "" {
+			headsign = trip.TripHeadsign
+		}
+		if !strings.Contains(strings.ToLower(headsign), strings.ToLower(filter.Headsign)) {
+			return false
+		}
+	}
+	if filter.Wheelchair && trip.WheelchairAccessible != models.ACCESSIBLE {
+		return false
+	}
+	if filter.Bikes && trip.BikeAccessible != models.ACCESSIBLE {
+		return false
+	}
+
+	if arrivals {
+		// Arrival boards never list a trip at its first stop
+		if s.isFirst(row) {
+			return false
+		}
+		return !filter.Boardable || models.PickupOrDropoff(s.stDropoff[row]) != models.DROPOFF_NOT_AVAILABLE
+	}
+	if filter.Boardable {
+		return models.PickupOrDropoff(s.stPickup[row]) != models.PICKUP_NOT_AVAILABLE && !s.isLast(row)
+	}
+	return true
+}
+
+func (s *Snapshot) departure(row int32) models.Departure {
+	t := s.stTrip[row]
+
+	dep := models.Departure{
+		Trip:              s.trips[t],
+		Route:             s.route(t),
+		TripId:            s.trips[t].TripId,
+		ArrivalTime:       formatTime(s.stArrival[row]),
+		DepartureTime:     formatTime(s.stDeparture[row]),
+		StopSequence:      int(s.stSequence[row]),
+		PickupType:        models.PickupOrDropoff(s.stPickup[row]),
+		DropoffType:       models.PickupOrDropoff(s.stDropoff[row]),
+		StopHeadsign:      s.headsign(row),
+		Timepoint:         models.Timepoint(s.stTimepoint[row]),
+		ShapeDistTraveled: nanToPtr(s.stShapeDistFeed[row]),
+		ShapeDistance:     nanToPtr(s.stShapeDist[row]),
+		ContinuousPickup:  models.PickupOrDropoff(s.stContPickup[row]),
+		ContinuousDropOff: models.PickupOrDropoff(s.stContDropoff[row]),
+		Interpolated:      s.stInterpolated[row],
+	}
+	if stop := s.stStop[row]; stop >= 0 {
+		dep.StopId = s.stops[stop].StopId
+		dep.PlatformCode = s.stops[stop].PlatformCode
+	}
+
+	dep.Headsign = dep.StopHeadsign
+	if dep.Headsign == "" {
+		dep.Headsign = dep.Trip.TripHeadsign
+	}
+	dep.ArrivalOnly = dep.PickupType == models.PICKUP_NOT_AVAILABLE || s.isLast(row)
+
+	return dep
+}
+
+func formatTime(secs int32) string {
+	if secs == noTime {
+		return ""
+	}
+	return utils.FormatGTFSTime(int(secs))
+}
+
+func boundTime(s string, fallback int32) int32 {
+	if s == "" {
+		return fallback
+	}
+	return parseTime(s)
+}
+
+// Board returns the departures from a stop or station on a date ordered by
+// departure time, or by arrival time when arrivals is set, the same as the
+// database departure queries. A negative limit returns all of them.
+func (s *Snapshot) Board(stop string, date time.Time, filter models.DepartureFilter, limit int, arrivals bool) []models.Departure {
+	var deps []models.Departure
+
+	active := s.activeServices(date)
+	from := boundTime(filter.From, 0)
+	to := boundTime(filter.To, 1<<30)
+
+	times := s.stDeparture
+	if arrivals {
+		times = s.stArrival
+	}
+
+	for _, stop := range s.boardStops(stop) {
+		rows := s.stopByDeparture[stop]
+		if arrivals {
+			rows = s.stopByArrival[stop]
+		}
+
+		found := 0
+		start := sort.Search(len(rows), func(i int) bool { return times[rows[i]] >= from })
+		for _, row := range rows[start:] {
+			if times[row] > to || (limit >= 0 && found >= limit) {
+				break
+			}
+			if !active[s.tripService[s.stTrip[row]]] || !s.matches(row, filter, arrivals) {
+				continue
+			}
+			deps = append(deps, s.departure(row))
+			found++
+		}
+
+		// Headway-based trips are expanded into their instances
+		for _, row := range s.stopFreqRows[stop] {
+			t := s.stTrip[row]
+			if !active[s.tripService[t]] || times[row] == noTime || !s.matches(row, filter, arrivals) {
+				continue
+			}
+
+			tripStart := s.stDeparture[s.tripStart[t]]
+			for _, dep := range models.ExpandFrequencyDeparture(s.departure(row), s.tripFreqs[t], int(tripStart)) {
+				board := dep.DepartureTime
+				if arrivals {
+					board = dep.ArrivalTime
+				}
+				if (filter.From == "" || board >= filter.From) && (filter.To == "" || board <= filter.To) {
+					deps = append(deps, dep)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(deps, func(i, j int) bool {
+		if arrivals {
+			return parseTime(deps[i].ArrivalTime) < parseTime(deps[j].ArrivalTime)
+		}
+		return parseTime(deps[i].DepartureTime) < parseTime(deps[j].DepartureTime)
+	})
+	if limit >= 0 && len(deps) > limit {
+		deps = deps[:limit]
+	}
+
+	return deps
+}
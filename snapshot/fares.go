@@ -0,0 +1,62 @@
+package snapshot
+
+import (
+	"slices"
+
+	"git.marceeli.ovh/vectura/vectura-api/fares"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+// Fares is database.GetFares served from memory
+func (s *Snapshot) Fares(from string, to string, route string) []models.FareAttribute {
+	ride := fares.Ride{FromStop: from, ToStop: to, RouteId: route}
+	if stop, ok := s.Stop(from); ok {
+		ride.FromZone = stop.ZoneId
+	}
+	if stop, ok := s.Stop(to); ok {
+		ride.ToZone = stop.ZoneId
+	}
+
+	return fares.MatchAttributes(s.fareAttributes, s.fareRules, ride)
+}
+
+// FareData is database.GetFareData served from memory
+func (s *Snapshot) FareData(stopIDs []string, routeIDs []string) fares.Data {
+	data := s.fareData
+	data.StopAreas = make(map[string][]string)
+	data.RouteNetworks = make(map[string][]string)
+
+	// Each ID counts once, as in an IN list
+	stopIDs = slices.Compact(slices.Sorted(slices.Values(stopIDs)))
+	routeIDs = slices.Compact(slices.Sorted(slices.Values(routeIDs)))
+
+	// A stop also belongs to the areas of its parent station
+	parents := make(map[string][]string)
+	for _, id := range stopIDs {
+		if stop, ok := s.Stop(id); ok && stop.ParentStation != "" {
+			parents[stop.ParentStation] = append(parents[stop.ParentStation], id)
+		}
+	}
+	for _, sa := range s.stopAreas {
+		if _, ok := slices.BinarySearch(stopIDs, sa.StopId); ok {
+			data.StopAreas[sa.StopId] = append(data.StopAreas[sa.StopId], sa.AreaId)
+		}
+		for _, child := range parents[sa.StopId] {
+			data.StopAreas[child] = append(data.StopAreas[child], sa.AreaId)
+		}
+	}
+
+	for _, rn := range s.routeNetworks {
+		if _, ok := slices.BinarySearch(routeIDs, rn.RouteId); ok {
+			data.RouteNetworks[rn.RouteId] = append(data.RouteNetworks[rn.RouteId], rn.NetworkId)
+		}
+	}
+	// Feeds may also assign networks directly in routes.txt
+	for _, id := range routeIDs {
+		if route, ok := s.Route(id); ok && route.NetworkId != "" {
+			data.RouteNetworks[id] = append(data.RouteNetworks[id], route.NetworkId)
+		}
+	}
+
+	return data
+}
@@ -0,0 +1,123 @@
+package snapshot
+
+import (
+	"maps"
+	"slices"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+// Stops, Routes and Trips are in feed order and shared, callers must not
+// modify them
+
+func (s *Snapshot) Stops() []models.Stop {
+	return s.stops
+}
+
+func (s *Snapshot) Routes() []models.Route {
+	return s.routes
+}
+
+func (s *Snapshot) Trips() []models.Trip {
+	return s.trips
+}
+
+func (s *Snapshot) Stop(id string) (models.Stop, bool) {
+	if i, ok := s.stopIndex[id]; ok {
+		return s.stops[i], true
+	}
+	return models.Stop{}, false
+}
+
+func (s *Snapshot) Route(id string) (models.Route, bool) {
+	if i, ok := s.routeIndex[id]; ok {
+		return s.routes[i], true
+	}
+	return models.Route{}, false
+}
+
+func (s *Snapshot) FeedInfo() models.FeedInfo {
+	return s.feedInfo
+}
+
+// Shape returns the points of a shape in sequence order
+func (s *Snapshot) Shape(id string) []models.Shape {
+	return s.shapes[id]
+}
+
+func (s *Snapshot) ShapeInfo(id string) (models.ShapeInfo, bool) {
+	info, ok := s.shapeInfos[id]
+	return info, ok
+}
+
+func (s *Snapshot) ShapeIDs() []string {
+	return slices.Sorted(maps.Keys(s.shapes))
+}
+
+// RouteShapes is database.GetRouteShapes served from memory
+func (s *Snapshot) RouteShapes(routes []string) map[string][][][2]float64 {
+	wanted := make(map[int32]bool)
+	for _, route := range routes {
+		if r, ok := s.routeIndex[route]; ok {
+			wanted[r] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	ids := make(map[string]map[string]bool)
+	for t, trip := range s.trips {
+		if wanted[s.tripRoute[t]] && trip.ShapeId != "" {
+			if ids[trip.RouteId] == nil {
+				ids[trip.RouteId] = make(map[string]bool)
+			}
+			ids[trip.RouteId][trip.ShapeId] = true
+		}
+	}
+
+	lines := make(map[string][][][2]float64)
+	for route, shapeIDs := range ids {
+		for _, id := range slices.Sorted(maps.Keys(shapeIDs)) {
+			if points := s.shapes[id]; len(points) > 0 {
+				lines[route] = append(lines[route], models.ShapePoints(points))
+			}
+		}
+	}
+	return lines
+}
+
+// Translator is database.GetTranslator served from memory
+func (s *Snapshot) Translator(languages []string) *models.Translator {
+	if len(languages) == 0 {
+		return nil
+	}
+	return s.translators[models.PickLanguage(languages, s.feedInfo.Language(), s.languages)]
+}
+
+// RouteDetail is database.GetRouteDetail served from memory
+func (s *Snapshot) RouteDetail(id string) (models.RouteDetail, bool) {
+	r, ok := s.routeIndex[id]
+	if !ok {
+		return models.RouteDetail{}, false
+	}
+
+	var trips []models.Trip
+	sequences := make(map[string][]string)
+	for t, trip := range s.trips {
+		if s.tripRoute[t] != r {
+			continue
+		}
+		trips = append(trips, trip)
+		for row := s.tripStart[t]; row < s.tripEnd[t]; row++ {
+			if stop := s.stStop[row]; stop >= 0 {
+				sequences[trip.TripId] = append(sequences[trip.TripId], s.stops[stop].StopId)
+			}
+		}
+	}
+
+	return models.RouteDetail{
+		Route:    s.routes[r],
+		Patterns: models.RoutePatterns(trips, sequences, s.stopsByID),
+	}, true
+}
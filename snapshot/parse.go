@@ -0,0 +1,224 @@
+package snapshot
+
+import (
+	"archive/zip"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/parser"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+)
+
+// Import downloads a city's feed and snapshots it without a database
+func Import(city utils.CityConfig) *Snapshot {
+	filePath := fmt.Sprintf("/tmp/%s.zip", city.ID)
+	if err := utils.SaveGTFS(city.URL, filePath); err != nil {
+		panic(err)
+	}
+
+	zipReader, err := zip.OpenReader(filePath)
+	if err != nil {
+		panic(err)
+	}
+	defer zipReader.Close()
+
+	s := Parse(city.ID, zipReader)
+	parser.ClearInterner()
+
+	println("Successfully loaded GTFS data for city:", city.ID)
+	return s
+}
+
+// Parse snapshots a feed straight from the parser, doing in memory what the
+// database import does: service dates are expanded, trips without a shape
+// get a synthetic one and stops are snapped to their trip's shape
+func Parse(city string, zipReader *zip.ReadCloser) *Snapshot {
+	data := Data{
+		Stops:  parser.GetStops(zipReader),
+		Routes: parser.GetRoutes(zipReader),
+		Trips:  parser.GetTrips(zipReader),
+	}
+
+	stops := make(map[string]models.Stop, len(data.Stops))
+	for _, stop := range data.Stops {
+		stops[stop.StopId] = stop
+	}
+
+	var stopTimes []models.Departure
+	parser.ProcessDeparturesChunked(zipReader, 15000, stops, func(departures []models.Departure) {
+		stopTimes = append(stopTimes, departures...)
+	})
+	sort.SliceStable(stopTimes, func(i, j int) bool {
+		if stopTimes[i].TripId != stopTimes[j].TripId {
+			return stopTimes[i].TripId < stopTimes[j].TripId
+		}
+		return stopTimes[i].StopSequence < stopTimes[j].StopSequence
+	})
+	data.StopTimes = slices.Values(stopTimes)
+
+	data.Calendars = parser.GetCalendar(zipReader)
+	data.CalendarDates = parser.GetCalendarDates(zipReader)
+	data.ServiceDates = models.ServiceDates(data.Calendars, data.CalendarDates)
+
+	data.Shapes = parser.GetShapes(zipReader)
+	data.ShapeInfos = models.ComputeShapeInfos(data.Shapes)
+	synthesizeShapes(city, &data, stopTimes, stops)
+	snapStopsToShapes(&data, stopTimes)
+
+	data.Frequencies = parser.GetFrequencies(zipReader)
+	data.Translations = parser.GetTranslations(zipReader)
+	data.FeedInfo = parser.GetFeedInfo(zipReader)
+
+	data.FareAttributes = parser.GetFareAttributes(zipReader)
+	data.FareRules = parser.GetFareRules(zipReader)
+	data.FareProducts = parser.GetFareProducts(zipReader)
+	data.FareLegRules = parser.GetFareLegRules(zipReader)
+	data.FareTransferRules = parser.GetFareTransferRules(zipReader)
+	data.Timeframes = parser.GetTimeframes(zipReader)
+	data.StopAreas = parser.GetStopAreas(zipReader)
+	data.RouteNetworks = parser.GetRouteNetworks(zipReader)
+
+	data.Pathways = parser.GetPathways(zipReader)
+	data.Levels = parser.GetLevels(zipReader)
+
+	return New(city, data)
+}
+
+// Calls fn with the stop times of each trip, which must be sorted by trip
+func eachTrip(stopTimes []models.Departure, fn func(tripID string, stopTimes []models.Departure)) {
+	for start := 0; start < len(stopTimes); {
+		end := start
+		for end < len(stopTimes) && stopTimes[end].TripId == stopTimes[start].TripId {
+			end++
+		}
+		fn(stopTimes[start].TripId, stopTimes[start:end])
+		start = end
+	}
+}
+
+// synthesizeShapes gives trips without a shape a straight line through
+// their stops, one per distinct stop pattern
+func synthesizeShapes(city string, data *Data, stopTimes []models.Departure, stops map[string]models.Stop) {
+	unshaped := make(map[string]bool)
+	for _, trip := range data.Trips {
+		if trip.ShapeId == "" {
+			unshaped[trip.TripId] = true
+		}
+	}
+	if len(unshaped) == 0 {
+		return
+	}
+
+	// Shape of each synthesized pattern, "" when it had too few located stops
+	synthesized := make(map[string]string)
+	assigned := make(map[string]string)
+	eachTrip(stopTimes, func(tripID string, stopTimes []models.Departure) {
+		if !unshaped[tripID] || len(stopTimes) < 2 {
+			return
+		}
+
+		seq := make([]string, len(stopTimes))
+		for i, st := range stopTimes {
+			seq[i] = st.StopId
+		}
+
+		id := models.SyntheticShapeID(city, seq)
+		shapeID, ok := synthesized[id]
+		if !ok {
+			if points, info, ok := models.SyntheticShape(id, seq, stops); ok {
+				data.Shapes = append(data.Shapes, points...)
+				data.ShapeInfos = append(data.ShapeInfos, info)
+				shapeID = id
+			}
+			synthesized[id] = shapeID
+		}
+		if shapeID != "" {
+			assigned[tripID] = shapeID
+		}
+	})
+
+	for i, trip := range data.Trips {
+		if id, ok := assigned[trip.TripId]; ok {
+			data.Trips[i].ShapeId = id
+		}
+	}
+
+	count := 0
+	for _, id := range synthesized {
+		if id != "" {
+			count++
+		}
+	}
+	println("Synthesized", count, "shapes for city:", city)
+}
+
+// snapStopsToShapes sets how far along its trip's shape every stop time
+// lies. Trips sharing a shape and the same stops at the same sequence
+// numbers are snapped once.
+func snapStopsToShapes(data *Data, stopTimes []models.Departure) {
+	tripShapes := make(map[string]string)
+	for _, trip := range data.Trips {
+		if trip.ShapeId != "" {
+			tripShapes[trip.TripId] = trip.ShapeId
+		}
+	}
+	if len(tripShapes) == 0 {
+		return
+	}
+
+	positions := make(map[string][2]float64)
+	for _, stop := range data.Stops {
+		if stop.StopLat != 0 || stop.StopLon != 0 {
+			positions[stop.StopId] = [2]float64{stop.StopLat, stop.StopLon}
+		}
+	}
+
+	points := make(map[string][]models.Shape)
+	for _, p := range data.Shapes {
+		points[p.ShapeId] = append(points[p.ShapeId], p)
+	}
+	locators := make(map[string]*geo.LineLocator)
+	locator := func(shapeID string) *geo.LineLocator {
+		l, ok := locators[shapeID]
+		if !ok {
+			shape := points[shapeID]
+			sort.SliceStable(shape, func(i, j int) bool { return shape[i].ShapePtSequence < shape[j].ShapePtSequence })
+			l = geo.NewLineLocator(models.ShapePoints(shape))
+			locators[shapeID] = l
+		}
+		return l
+	}
+
+	snapped := make(map[string][]*float64)
+	eachTrip(stopTimes, func(tripID string, stopTimes []models.Departure) {
+		shapeID, ok := tripShapes[tripID]
+		if !ok {
+			return
+		}
+		l := locator(shapeID)
+		if l.Length() == 0 {
+			return
+		}
+
+		var key strings.Builder
+		key.WriteString(shapeID)
+		stopIDs := make([]string, len(stopTimes))
+		for i, st := range stopTimes {
+			fmt.Fprintf(&key, "\x00%s@%d", st.StopId, st.StopSequence)
+			stopIDs[i] = st.StopId
+		}
+
+		distances, ok := snapped[key.String()]
+		if !ok {
+			distances = models.SnapToShape(l, stopIDs, positions)
+			snapped[key.String()] = distances
+		}
+		for i := range stopTimes {
+			stopTimes[i].ShapeDistance = distances[i]
+		}
+	})
+}
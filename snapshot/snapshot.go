@@ -0,0 +1,430 @@
+// Package snapshot keeps a read-only, columnar copy of each city's
+// timetable in memory so the hot departure and trip lookups don't touch the
+// database. A city's snapshot is built from the imported tables once its
+// feed has loaded, or straight from the feed when there is no database,
+// either way before the server starts. Store swaps in a finished snapshot,
+// readers never see a half-built one.
+package snapshot
+
+import (
+	"iter"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/fares"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+)
+
+const noTime = -1
+
+type Snapshot struct {
+	City string
+
+	stops     []models.Stop
+	stopIndex map[string]int32
+	// Platforms of each station, what a station stands for on a board
+	children map[int32][]int32
+
+	routes     []models.Route
+	routeIndex map[string]int32
+
+	trips       []models.Trip
+	tripIndex   map[string]int32
+	tripRoute   []int32
+	tripService []int32
+	tripFreqs   map[int32][]models.Frequency
+	// Stop times of trip t are the rows tripStart[t] up to tripEnd[t], in
+	// stop_sequence order
+	tripStart []int32
+	tripEnd   []int32
+
+	// Stop times, one column per field
+	stTrip          []int32
+	stStop          []int32
+	stArrival       []int32
+	stDeparture     []int32
+	stSequence      []int32
+	stPickup        []uint8
+	stDropoff       []uint8
+	stTimepoint     []uint8
+	stContPickup    []uint8
+	stContDropoff   []uint8
+	stInterpolated  []bool
+	stHeadsign      []int32
+	stShapeDist     []float64
+	stShapeDistFeed []float64
+	headsigns       []string
+	headsignIndex   map[string]int32
+
+	// Rows at each stop ordered by departure and by arrival time, headway
+	// based trips are kept apart as their template times mean nothing
+	stopByDeparture [][]int32
+	stopByArrival   [][]int32
+	stopFreqRows    [][]int32
+
+	services     []string
+	serviceIndex map[string]int32
+	// Days each service runs on as sorted yyyymmdd numbers
+	serviceDates [][]int32
+	serviceTrips []int
+	calendars    map[string]models.Calendar
+	exceptions   map[string][]models.CalendarDate
+
+	shapes     map[string][]models.Shape
+	shapeInfos map[string]models.ShapeInfo
+	feedInfo   models.FeedInfo
+
+	// One translator per lowercase language the feed has translations for,
+	// languages sorted
+	translators map[string]*models.Translator
+	languages   []string
+
+	fareAttributes []models.FareAttribute
+	fareRules      []models.FareRule
+	// Fares v2 rules, StopAreas and RouteNetworks left empty
+	fareData      fares.Data
+	stopAreas     []models.StopArea
+	routeNetworks []models.RouteNetwork
+
+	pathways []models.Pathway
+	levels   []models.Level
+
+	// Shape locators for vehicle positions, built on first use
+	locators sync.Map
+}
+
+// Data is everything a snapshot holds
+type Data struct {
+	Stops  []models.Stop
+	Routes []models.Route
+	Trips  []models.Trip
+	// Grouped by trip, in stop_sequence order
+	StopTimes     iter.Seq[models.Departure]
+	Frequencies   []models.Frequency
+	Calendars     []models.Calendar
+	CalendarDates []models.CalendarDate
+	// Every day each service runs on
+	ServiceDates map[string][]time.Time
+	Shapes       []models.Shape
+	// Computed from Shapes when left empty
+	ShapeInfos   []models.ShapeInfo
+	FeedInfo     models.FeedInfo
+	Translations []models.Translation
+
+	FareAttributes []models.FareAttribute
+	FareRules      []models.FareRule
+	// Fares v2
+	FareProducts      []models.FareProduct
+	FareLegRules      []models.FareLegRule
+	FareTransferRules []models.FareTransferRule
+	Timeframes        []models.Timeframe
+	StopAreas         []models.StopArea
+	RouteNetworks     []models.RouteNetwork
+
+	Pathways []models.Pathway
+	Levels   []models.Level
+}
+
+var snapshots sync.Map
+
+// Get returns the snapshot of a city, nil when none has been stored
+func Get(city string) *Snapshot {
+	if s, ok := snapshots.Load(city); ok {
+		return s.(*Snapshot)
+	}
+	return nil
+}
+
+// Store swaps in the snapshot of a city, replacing the previous one
+func Store(s *Snapshot) {
+	snapshots.Store(s.City, s)
+}
+
+func dayNumber(t time.Time) int32 {
+	return int32(t.Year()*10000 + int(t.Month())*100 + t.Day())
+}
+
+func dayTime(day int32) time.Time {
+	return time.Date(int(day/10000), time.Month(day/100%100), int(day%100), 0, 0, 0, 0, time.Local)
+}
+
+func parseTime(s string) int32 {
+	if secs, ok := utils.ParseGTFSTime(s); ok {
+		return int32(secs)
+	}
+	return noTime
+}
+
+func floatOrNaN(f *float64) float64 {
+	if f == nil {
+		return math.NaN()
+	}
+	return *f
+}
+
+func nanToPtr(f float64) *float64 {
+	if math.IsNaN(f) {
+		return nil
+	}
+	return &f
+}
+
+func newSnapshot(city string) *Snapshot {
+	return &Snapshot{
+		City:          city,
+		stopIndex:     make(map[string]int32),
+		children:      make(map[int32][]int32),
+		routeIndex:    make(map[string]int32),
+		tripIndex:     make(map[string]int32),
+		tripFreqs:     make(map[int32][]models.Frequency),
+		headsignIndex: make(map[string]int32),
+		serviceIndex:  make(map[string]int32),
+		calendars:     make(map[string]models.Calendar),
+		exceptions:    make(map[string][]models.CalendarDate),
+		shapes:        make(map[string][]models.Shape),
+		shapeInfos:    make(map[string]models.ShapeInfo),
+		translators:   make(map[string]*models.Translator),
+	}
+}
+
+// New builds a snapshot, from a parsed feed or from the imported tables
+func New(city string, data Data) *Snapshot {
+	s := newSnapshot(city)
+
+	for _, stop := range data.Stops {
+		s.addStop(stop)
+	}
+	for _, route := range data.Routes {
+		s.addRoute(route)
+	}
+	for _, trip := range data.Trips {
+		s.addTrip(trip)
+	}
+
+	if data.StopTimes != nil {
+		for dep := range data.StopTimes {
+			s.addStopTime(dep)
+		}
+	}
+
+	for _, freq := range data.Frequencies {
+		s.addFrequency(freq)
+	}
+	for _, cal := range data.Calendars {
+		s.calendars[cal.ServiceId] = cal
+	}
+	for _, cd := range data.CalendarDates {
+		s.exceptions[cd.ServiceId] = append(s.exceptions[cd.ServiceId], cd)
+	}
+	for service, dates := range data.ServiceDates {
+		for _, d := range dates {
+			s.addServiceDate(service, d)
+		}
+	}
+	for _, shape := range data.Shapes {
+		s.shapes[shape.ShapeId] = append(s.shapes[shape.ShapeId], shape)
+	}
+	shapeInfos := data.ShapeInfos
+	if len(shapeInfos) == 0 {
+		shapeInfos = models.ComputeShapeInfos(data.Shapes)
+	}
+	for _, info := range shapeInfos {
+		s.shapeInfos[info.ShapeId] = info
+	}
+	s.feedInfo = data.FeedInfo
+	s.addTranslations(data.Translations)
+
+	s.fareAttributes = data.FareAttributes
+	s.fareRules = data.FareRules
+	s.fareData = fares.Data{
+		Products:      data.FareProducts,
+		LegRules:      data.FareLegRules,
+		TransferRules: data.FareTransferRules,
+		Timeframes:    data.Timeframes,
+	}
+	s.stopAreas = data.StopAreas
+	s.routeNetworks = data.RouteNetworks
+	s.pathways = data.Pathways
+	s.levels = data.Levels
+
+	s.finish()
+	return s
+}
+
+func (s *Snapshot) addTranslations(translations []models.Translation) {
+	byLanguage := make(map[string][]models.Translation)
+	for _, tr := range translations {
+		lang := strings.ToLower(tr.Language)
+		byLanguage[lang] = append(byLanguage[lang], tr)
+	}
+	for lang, trs := range byLanguage {
+		s.translators[lang] = models.NewTranslator(lang, trs)
+	}
+	s.languages = slices.Sorted(maps.Keys(byLanguage))
+}
+
+func (s *Snapshot) addStop(stop models.Stop) {
+	s.stopIndex[stop.StopId] = int32(len(s.stops))
+	s.stops = append(s.stops, stop)
+}
+
+func (s *Snapshot) addRoute(route models.Route) {
+	s.routeIndex[route.RouteId] = int32(len(s.routes))
+	s.routes = append(s.routes, route)
+}
+
+func (s *Snapshot) addTrip(trip models.Trip) {
+	route, ok := s.routeIndex[trip.RouteId]
+	if !ok {
+		route = -1
+	}
+	service := s.service(trip.ServiceId)
+
+	s.tripIndex[trip.TripId] = int32(len(s.trips))
+	s.trips = append(s.trips, trip)
+	s.tripRoute = append(s.tripRoute, route)
+	s.tripService = append(s.tripService, service)
+	s.tripStart = append(s.tripStart, 0)
+	s.tripEnd = append(s.tripEnd, 0)
+	s.serviceTrips[service]++
+}
+
+func (s *Snapshot) service(id string) int32 {
+	if i, ok := s.serviceIndex[id]; ok {
+		return i
+	}
+	i := int32(len(s.services))
+	s.serviceIndex[id] = i
+	s.services = append(s.services, id)
+	s.serviceDates = append(s.serviceDates, nil)
+	s.serviceTrips = append(s.serviceTrips, 0)
+	return i
+}
+
+func (s *Snapshot) addServiceDate(service string, d time.Time) {
+	i := s.service(service)
+	s.serviceDates[i] = append(s.serviceDates[i], dayNumber(d))
+}
+
+func (s *Snapshot) addFrequency(freq models.Frequency) {
+	if t, ok := s.tripIndex[freq.TripId]; ok {
+		s.tripFreqs[t] = append(s.tripFreqs[t], freq)
+	}
+}
+
+// addStopTime appends a row, stop times must come grouped by trip in
+// stop_sequence order
+func (s *Snapshot) addStopTime(dep models.Departure) {
+	t, ok := s.tripIndex[dep.TripId]
+	if !ok {
+		return
+	}
+
+	row := int32(len(s.stTrip))
+	if s.tripEnd[t] != row || s.tripStart[t] == s.tripEnd[t] {
+		s.tripStart[t] = row
+	}
+	s.tripEnd[t] = row + 1
+
+	stop, ok := s.stopIndex[dep.StopId]
+	if !ok {
+		stop = -1
+	}
+
+	headsign := int32(-1)
+	if dep.StopHeadsign != "" {
+		h, ok := s.headsignIndex[dep.StopHeadsign]
+		if !ok {
+			h = int32(len(s.headsigns))
+			s.headsigns = append(s.headsigns, dep.StopHeadsign)
+			s.headsignIndex[dep.StopHeadsign] = h
+		}
+		headsign = h
+	}
+
+	s.stTrip = append(s.stTrip, t)
+	s.stStop = append(s.stStop, stop)
+	s.stArrival = append(s.stArrival, parseTime(dep.ArrivalTime))
+	s.stDeparture = append(s.stDeparture, parseTime(dep.DepartureTime))
+	s.stSequence = append(s.stSequence, int32(dep.StopSequence))
+	s.stPickup = append(s.stPickup, uint8(dep.PickupType))
+	s.stDropoff = append(s.stDropoff, uint8(dep.DropoffType))
+	s.stTimepoint = append(s.stTimepoint, uint8(dep.Timepoint))
+	s.stContPickup = append(s.stContPickup, uint8(dep.ContinuousPickup))
+	s.stContDropoff = append(s.stContDropoff, uint8(dep.ContinuousDropOff))
+	s.stInterpolated = append(s.stInterpolated, dep.Interpolated)
+	s.stHeadsign = append(s.stHeadsign, headsign)
+	s.stShapeDist = append(s.stShapeDist, floatOrNaN(dep.ShapeDistance))
+	s.stShapeDistFeed = append(s.stShapeDistFeed, floatOrNaN(dep.ShapeDistTraveled))
+}
+
+// finish builds the indexes once everything has been added
+func (s *Snapshot) finish() {
+	for i, stop := range s.stops {
+		if stop.LocationType != models.STOP || stop.ParentStation == "" {
+			continue
+		}
+		if parent, ok := s.stopIndex[stop.ParentStation]; ok && s.stops[parent].LocationType == models.STATION {
+			s.children[parent] = append(s.children[parent], int32(i))
+		}
+	}
+
+	for _, dates := range s.serviceDates {
+		slices.Sort(dates)
+	}
+	for _, dates := range s.exceptions {
+		sort.SliceStable(dates, func(i, j int) bool { return dates[i].Date.Before(dates[j].Date) })
+	}
+	for _, points := range s.shapes {
+		sort.Slice(points, func(i, j int) bool { return points[i].ShapePtSequence < points[j].ShapePtSequence })
+	}
+
+	s.stopByDeparture = make([][]int32, len(s.stops))
+	s.stopByArrival = make([][]int32, len(s.stops))
+	s.stopFreqRows = make([][]int32, len(s.stops))
+
+	for row, stop := range s.stStop {
+		if stop < 0 {
+			continue
+		}
+		if _, ok := s.tripFreqs[s.stTrip[row]]; ok {
+			s.stopFreqRows[stop] = append(s.stopFreqRows[stop], int32(row))
+			continue
+		}
+		if s.stDeparture[row] != noTime {
+			s.stopByDeparture[stop] = append(s.stopByDeparture[stop], int32(row))
+		}
+		if s.stArrival[row] != noTime {
+			s.stopByArrival[stop] = append(s.stopByArrival[stop], int32(row))
+		}
+	}
+
+	for stop := range s.stops {
+		byDep, byArr := s.stopByDeparture[stop], s.stopByArrival[stop]
+		sort.SliceStable(byDep, func(i, j int) bool { return s.stDeparture[byDep[i]] < s.stDeparture[byDep[j]] })
+		sort.SliceStable(byArr, func(i, j int) bool { return s.stArrival[byArr[i]] < s.stArrival[byArr[j]] })
+	}
+}
+
+// Services running on a date, indexed like serviceDates
+func (s *Snapshot) activeServices(date time.Time) []bool {
+	day := dayNumber(date)
+	active := make([]bool, len(s.serviceDates))
+	for i, dates := range s.serviceDates {
+		_, active[i] = slices.BinarySearch(dates, day)
+	}
+	return active
+}
+
+func (s *Snapshot) route(t int32) models.Route {
+	if r := s.tripRoute[t]; r >= 0 {
+		return s.routes[r]
+	}
+	return models.Route{}
+}
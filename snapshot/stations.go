@@ -0,0 +1,13 @@
+package snapshot
+
+import "git.marceeli.ovh/vectura/vectura-api/models"
+
+// Station is database.GetStation served from memory
+func (s *Snapshot) Station(id string) (models.Station, bool) {
+	stop, ok := s.Stop(id)
+	if !ok || stop.LocationType != models.STATION {
+		return models.Station{}, false
+	}
+
+	return models.NewStation(stop, models.StationStops(id, s.stops), s.levels, s.pathways), true
+}
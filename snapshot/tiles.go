@@ -0,0 +1,47 @@
+package snapshot
+
+import (
+	"maps"
+	"slices"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/tiles"
+)
+
+// TileSource collects what tiles are cut from, every shape drawn once for
+// each route whose trips use it
+func (s *Snapshot) TileSource() *tiles.Source {
+	shapeRoutes := make(map[string]map[string]bool)
+	for t, trip := range s.trips {
+		if trip.ShapeId == "" || s.tripRoute[t] < 0 {
+			continue
+		}
+		if shapeRoutes[trip.ShapeId] == nil {
+			shapeRoutes[trip.ShapeId] = make(map[string]bool)
+		}
+		shapeRoutes[trip.ShapeId][trip.RouteId] = true
+	}
+
+	var shapes []tiles.Shape
+	for _, shapeID := range slices.Sorted(maps.Keys(shapeRoutes)) {
+		info, ok := s.shapeInfos[shapeID]
+		if !ok || info.PointCount < 2 {
+			continue
+		}
+
+		var routes []models.Route
+		for _, routeID := range slices.Sorted(maps.Keys(shapeRoutes[shapeID])) {
+			route, _ := s.Route(routeID)
+			routes = append(routes, route)
+		}
+
+		shapes = append(shapes, tiles.Shape{
+			Points: models.ShapePoints(s.shapes[shapeID]),
+			SW:     [2]float64{info.MinLat, info.MinLon},
+			NE:     [2]float64{info.MaxLat, info.MaxLon},
+			Routes: routes,
+		})
+	}
+
+	return tiles.NewSource(s.stops, shapes)
+}
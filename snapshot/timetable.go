@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+// Timetable is database.GetTimetable served from memory
+func (s *Snapshot) Timetable(route string, date time.Time, direction models.Direction) (models.Timetable, bool) {
+	r, ok := s.routeIndex[route]
+	if !ok {
+		return models.Timetable{}, false
+	}
+
+	timetable := models.Timetable{
+		Route:       s.routes[r],
+		Date:        date.Format("2006-01-02"),
+		DirectionId: direction,
+	}
+
+	active := s.activeServices(date)
+
+	var trips []models.Trip
+	stopTimes := make(map[string][]models.Departure)
+	freqs := make(map[string][]models.Frequency)
+	for t, trip := range s.trips {
+		if s.tripRoute[t] != r || trip.DirectionId != direction || !active[s.tripService[t]] {
+			continue
+		}
+
+		trips = append(trips, trip)
+		for row := s.tripStart[t]; row < s.tripEnd[t]; row++ {
+			stopTimes[trip.TripId] = append(stopTimes[trip.TripId], s.departure(row))
+		}
+		if tripFreqs, ok := s.tripFreqs[int32(t)]; ok {
+			freqs[trip.TripId] = tripFreqs
+		}
+	}
+	if len(trips) == 0 {
+		return timetable, true
+	}
+
+	return models.BuildTimetable(timetable, trips, stopTimes, freqs, s.stopsByID), true
+}
+
+// Stops of the given IDs that exist, keyed by ID
+func (s *Snapshot) stopsByID(stopIDs []string) map[string]models.Stop {
+	stops := make(map[string]models.Stop)
+	for _, id := range stopIDs {
+		if stop, ok := s.Stop(id); ok {
+			stops[id] = stop
+		}
+	}
+	return stops
+}
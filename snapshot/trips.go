@@ -0,0 +1,94 @@
+package snapshot
+
+import (
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+func (s *Snapshot) Trip(id string) (models.Trip, models.Route, bool) {
+	t, ok := s.tripIndex[id]
+	if !ok {
+		return models.Trip{}, models.Route{}, false
+	}
+	return s.trips[t], s.route(t), true
+}
+
+func (s *Snapshot) StopTimes(id string) []models.TripStopTime {
+	t, ok := s.tripIndex[id]
+	if !ok {
+		return nil
+	}
+
+	var stopTimes []models.TripStopTime
+	for row := s.tripStart[t]; row < s.tripEnd[t]; row++ {
+		dep := s.departure(row)
+
+		var stop models.Stop
+		if i := s.stStop[row]; i >= 0 {
+			stop = s.stops[i]
+		}
+
+		stopTimes = append(stopTimes, models.TripStopTime{
+			Stop:              stop,
+			ArrivalTime:       dep.ArrivalTime,
+			DepartureTime:     dep.DepartureTime,
+			StopSequence:      dep.StopSequence,
+			StopHeadsign:      dep.StopHeadsign,
+			PickupType:        dep.PickupType,
+			DropoffType:       dep.DropoffType,
+			Timepoint:         dep.Timepoint,
+			ShapeDistTraveled: dep.ShapeDistTraveled,
+			ShapeDistance:     dep.ShapeDistance,
+			ContinuousPickup:  dep.ContinuousPickup,
+			ContinuousDropOff: dep.ContinuousDropOff,
+			Interpolated:      dep.Interpolated,
+		})
+	}
+
+	return stopTimes
+}
+
+// TripDetail is database.GetTripDetail served from memory
+func (s *Snapshot) TripDetail(id string, polylinePrecision int) (models.TripDetail, bool) {
+	trip, route, ok := s.Trip(id)
+	if !ok {
+		return models.TripDetail{}, false
+	}
+
+	detail := models.TripDetail{
+		Trip:        trip,
+		Route:       route,
+		StopTimes:   s.StopTimes(id),
+		Frequencies: s.tripFreqs[s.tripIndex[id]],
+	}
+
+	if service, ok := s.serviceIndex[trip.ServiceId]; ok {
+		for _, day := range s.serviceDates[service] {
+			detail.ServiceDates = append(detail.ServiceDates, dayTime(day).Format("2006-01-02"))
+		}
+	}
+
+	if trip.ShapeId != "" {
+		shape := s.shapes[trip.ShapeId]
+		if polylinePrecision > 0 {
+			detail.Polyline = geo.EncodePolyline(models.ShapePoints(shape), polylinePrecision)
+		} else {
+			detail.Shape = shape
+		}
+	}
+
+	return detail, true
+}
+
+// TripShapeSegment is database.GetTripShapeSegment served from memory
+func (s *Snapshot) TripShapeSegment(id string, fromStop string, toStop string, polylinePrecision int) (models.ShapeSegment, error) {
+	trip, _, ok := s.Trip(id)
+	if !ok {
+		return models.ShapeSegment{}, models.ErrTripNotFound
+	}
+	if trip.ShapeId == "" {
+		return models.ShapeSegment{}, models.ErrTripNoShape
+	}
+
+	return models.CutShapeSegment(trip, s.StopTimes(id), s.shapes[trip.ShapeId], fromStop, toStop, polylinePrecision)
+}
@@ -0,0 +1,112 @@
+package snapshot
+
+import (
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+)
+
+func (s *Snapshot) locator(shapeID string) *geo.LineLocator {
+	if l, ok := s.locators.Load(shapeID); ok {
+		return l.(*geo.LineLocator)
+	}
+	l, _ := s.locators.LoadOrStore(shapeID, geo.NewLineLocator(models.ShapePoints(s.shapes[shapeID])))
+	return l.(*geo.LineLocator)
+}
+
+// First departure and last arrival of a trip in seconds, false when none of
+// its stop times has a departure time
+func (s *Snapshot) tripSpan(t int32) (int, int, bool) {
+	start, end, ok := 0, 0, false
+	for row := s.tripStart[t]; row < s.tripEnd[t]; row++ {
+		departure := int(s.stDeparture[row])
+		if s.stDeparture[row] == noTime {
+			continue
+		}
+		arrival := departure
+		if s.stArrival[row] != noTime {
+			arrival = int(s.stArrival[row])
+		}
+
+		if !ok {
+			start, end, ok = departure, max(arrival, departure), true
+			continue
+		}
+		start = min(start, departure)
+		end = max(end, arrival, departure)
+	}
+	return start, end, ok
+}
+
+// ScheduledVehicles is database.GetScheduledVehicles served from memory
+func (s *Snapshot) ScheduledVehicles(date time.Time, secs int) []models.VehiclePosition {
+	var vehicles []models.VehiclePosition
+
+	// Trips running past midnight belong to the previous day's services
+	days := []struct {
+		date time.Time
+		secs int
+	}{
+		{date, secs},
+		{date.AddDate(0, 0, -1), secs + 24*3600},
+	}
+
+	for _, day := range days {
+		active := s.activeServices(day.date)
+
+		for t, trip := range s.trips {
+			if !active[s.tripService[t]] {
+				continue
+			}
+			start, end, ok := s.tripSpan(int32(t))
+			if !ok {
+				continue
+			}
+
+			var runs []models.ScheduledRun
+			if freqs, ok := s.tripFreqs[int32(t)]; ok {
+				runs = models.HeadwayRuns(trip.TripId, start, end, freqs, day.secs)
+			} else if start <= day.secs && end >= day.secs {
+				runs = []models.ScheduledRun{{TripId: trip.TripId}}
+			}
+			if len(runs) == 0 {
+				continue
+			}
+
+			var stops []models.ScheduledStop
+			for row := s.tripStart[t]; row < s.tripEnd[t]; row++ {
+				var stop models.Stop
+				if i := s.stStop[row]; i >= 0 {
+					stop = s.stops[i]
+				}
+				if st, ok := models.NewScheduledStop(s.departure(row), stop); ok {
+					stops = append(stops, st)
+				}
+			}
+
+			var locator *geo.LineLocator
+			if trip.ShapeId != "" {
+				locator = s.locator(trip.ShapeId)
+			}
+
+			for _, run := range runs {
+				v, ok := models.EstimatePosition(stops, day.secs-run.Offset, locator)
+				if !ok {
+					continue
+				}
+
+				v.Trip = trip
+				v.Route = s.route(int32(t))
+				v.StartTime = utils.FormatGTFSTime(stops[0].Departure + run.Offset)
+				v.FrequencyBased = run.FrequencyBased
+				vehicles = append(vehicles, v)
+			}
+		}
+	}
+
+	models.SortVehicles(vehicles)
+
+	return vehicles
+}
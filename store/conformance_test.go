@@ -0,0 +1,782 @@
+package store
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/database"
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/snapshot"
+	"git.marceeli.ovh/vectura/vectura-api/utils"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const conformanceCity = "conformance"
+
+// A small feed touching what the backends could disagree on: a station with
+// platforms, interpolated and after-midnight stop times, trips without a
+// shape, headway trips, calendar exceptions, a service defined by
+// calendar_dates alone, stops sharing a name, a stop without coordinates,
+// both fare versions and station pathways
+var conformanceFeed = map[string]string{
+	"agency.txt": `agency_id,agency_name,agency_url,agency_timezone,agency_lang
+A,Test Transit,http://example.com,Europe/Warsaw,pl
+`,
+	"stops.txt": `stop_id,stop_code,stop_name,stop_lat,stop_lon,zone_id,parent_station,platform_code,wheelchair_boarding,location_type,level_id
+ST,,Dworzec Główny,52.2290,21.0030,Z1,,,1,1,L0
+S1,101,Dworzec Główny 1,52.2291,21.0031,Z1,ST,1,1,0,L-1
+S2,102,Dworzec Główny 2,52.2289,21.0029,Z1,ST,2,1,0,L-1
+S3,103,Centrum,52.2320,21.0100,Z1,,,1,0,
+S4,104,Politechnika,52.2190,21.0150,Z2,,,0,0,
+S5,105,Pole Mokotowskie,52.2120,21.0050,Z2,,,1,0,
+S6,106,Centrum,52.2322,21.0104,Z1,,,1,0,
+S7,107,Bez współrzędnych,,,Z2,,,0,0,
+E1,,Wejście,52.2292,21.0032,,ST,,1,2,L0
+N1,,Hol,52.2291,21.0031,,ST,,1,3,L0
+`,
+	"routes.txt": `route_id,agency_id,route_short_name,route_long_name,route_type,route_color,route_text_color
+R1,A,1,Dworzec - Pole Mokotowskie,3,FF0000,FFFFFF
+M1,A,M1,Metro,1,0000FF,FFFFFF
+N9,A,N9,Nocny,3,000000,FFFFFF
+R0,A,0,Bez kursów,3,,
+`,
+	"trips.txt": `route_id,service_id,trip_id,trip_headsign,direction_id,shape_id,wheelchair_accessible,bikes_allowed
+R1,WK,T1,Pole Mokotowskie,0,SH1,1,1
+R1,WK,T2,Pole Mokotowskie,0,SH1,1,2
+R1,WK,T3,Dworzec,1,,1,1
+R1,WE,T4,Pole Mokotowskie,0,SH1,2,1
+M1,WK,MF1,Politechnika,0,,1,1
+N9,WK,NT1,Centrum,0,,0,0
+N9,HOL,NT2,Centrum,0,,1,1
+`,
+	"stop_times.txt": `trip_id,arrival_time,departure_time,stop_id,stop_sequence,stop_headsign,pickup_type,drop_off_type,timepoint,shape_dist_traveled
+T1,08:00:00,08:00:00,S1,1,,0,0,1,
+T1,,,S3,2,,0,0,0,
+T1,08:10:00,08:10:00,S4,3,Politechnika,0,0,1,
+T1,08:20:00,08:20:00,S5,4,,0,1,1,
+T2,9:00:00,9:00:00,S1,1,,0,0,1,
+T2,09:05:00,09:05:00,S3,2,,0,0,1,
+T2,09:10:00,09:10:00,S4,3,,1,0,1,
+T2,09:20:00,09:20:00,S5,4,,0,1,1,
+T3,10:00:00,10:00:00,S5,1,,0,0,1,
+T3,10:10:00,10:10:00,S4,2,,0,0,1,
+T3,10:20:00,10:20:00,S2,3,,0,1,1,
+T4,11:00:00,11:00:00,S1,1,,0,0,1,
+T4,11:20:00,11:20:00,S5,2,,0,1,1,
+MF1,06:00:00,06:00:00,S2,1,,0,0,1,
+MF1,06:04:00,06:04:00,S4,2,,0,1,1,
+NT1,23:50:00,23:50:00,S2,1,,0,0,1,
+NT1,24:05:00,24:05:00,S7,2,,0,0,1,
+NT1,24:15:00,24:15:00,S6,3,,0,1,1,
+NT2,12:00:00,12:00:00,S6,1,,0,0,1,
+NT2,12:10:00,12:10:00,S3,2,,0,1,1,
+`,
+	"calendar.txt": `service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date
+WK,1,1,1,1,1,0,0,20260101,20271231
+WE,0,0,0,0,0,1,1,20260101,20271231
+`,
+	"calendar_dates.txt": `service_id,date,exception_type
+WK,20261020,2
+WE,20261020,1
+HOL,20261019,1
+HOL,20261101,1
+`,
+	"frequencies.txt": `trip_id,start_time,end_time,headway_secs,exact_times
+MF1,06:00:00,07:00:00,600,0
+MF1,23:00:00,24:30:00,1800,1
+`,
+	"shapes.txt": `shape_id,shape_pt_lat,shape_pt_lon,shape_pt_sequence
+SH1,52.2291,21.0031,1
+SH1,52.2320,21.0100,3
+SH1,52.2300,21.0060,2
+SH1,52.2250,21.0130,4
+SH1,52.2190,21.0150,5
+SH1,52.2150,21.0100,6
+SH1,52.2120,21.0050,7
+`,
+	"feed_info.txt": `feed_publisher_name,feed_publisher_url,feed_lang,feed_version
+Test,http://example.com,pl,2026.10
+`,
+	"translations.txt": `table_name,field_name,language,translation,record_id,record_sub_id,field_value
+stops,stop_name,en,Central Station,,,Dworzec Główny
+stops,stop_name,en,Central Station platform 1,S1,,
+trips,trip_headsign,en,Mokotow Field,,,Pole Mokotowskie
+routes,route_long_name,en,Metro line,M1,,
+stop_times,stop_headsign,en-GB,Technical University,,,Politechnika
+`,
+	"fare_attributes.txt": `fare_id,price,currency_type,payment_method,transfers,transfer_duration
+Z1,3.40,PLN,1,,1200
+Z12,4.40,PLN,1,0,
+`,
+	"fare_rules.txt": `fare_id,route_id,origin_id,destination_id,contains_id
+Z1,,Z1,Z1,
+Z12,,Z1,Z2,
+Z12,,Z2,Z1,
+Z12,,Z2,Z2,
+`,
+	"fare_products.txt": `fare_product_id,fare_product_name,fare_media_id,amount,currency
+single,Bilet 20 min,card,3.40,PLN
+single,Bilet 20 min,app,3.20,PLN
+peak,Bilet szczyt,card,5.00,PLN
+`,
+	"fare_leg_rules.txt": `leg_group_id,network_id,from_area_id,to_area_id,from_timeframe_group_id,fare_product_id,rule_priority
+city,ztm,,,,single,0
+city,ztm,,,peak,peak,1
+centre,ztm,centre,,,single,0
+`,
+	"fare_transfer_rules.txt": `from_leg_group_id,to_leg_group_id,transfer_count,duration_limit,duration_limit_type,fare_transfer_type,fare_product_id
+city,city,-1,4500,1,0,
+`,
+	"timeframes.txt": `timeframe_group_id,start_time,end_time,service_id
+peak,07:00:00,09:00:00,WK
+`,
+	"areas.txt": `area_id,area_name
+centre,Śródmieście
+`,
+	"stop_areas.txt": `area_id,stop_id
+centre,ST
+centre,S3
+`,
+	"networks.txt": `network_id,network_name
+ztm,ZTM
+`,
+	"route_networks.txt": `network_id,route_id
+ztm,R1
+ztm,M1
+`,
+	"levels.txt": `level_id,level_index,level_name
+L0,0,Poziom ulicy
+L-1,-1,Perony
+`,
+	"pathways.txt": `pathway_id,from_stop_id,to_stop_id,pathway_mode,is_bidirectional,length,traversal_time,stair_count,signposted_as,reversed_signposted_as
+P1,E1,N1,1,1,20,,,Perony,Wyjście
+P2,N1,S1,2,1,,30,20,Peron 1,
+P3,N1,S2,2,1,,30,20,Peron 2,
+P4,N1,S1,5,1,,90,,Winda peron 1,
+`,
+}
+
+// Writes the fixture feed to a zip the parser can open
+func openConformanceFeed(t *testing.T) *zip.ReadCloser {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range conformanceFeed {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "feed.zip")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	zipReader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { zipReader.Close() })
+	return zipReader
+}
+
+type backend struct {
+	name  string
+	store Store
+}
+
+// The fixture parsed into memory, the reference the others are held to, and
+// imported into SQLite, served from the tables and from a snapshot of them.
+// POSTGRES_TEST_DSN adds a Postgres backend, its tables are dropped so it
+// must name a scratch database.
+func conformanceStores(t *testing.T) []backend {
+	t.Helper()
+
+	zipReader := openConformanceFeed(t)
+
+	mem := NewMemoryStore()
+	mem.Load(snapshot.Parse(conformanceCity, zipReader))
+
+	db, err := gorm.Open(sqlite.Open("file:conformance?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Error),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.Migrate(db)
+	database.ImportCity(db, conformanceCity, zipReader)
+	snap := database.BuildSnapshot(db, conformanceCity)
+
+	backends := []backend{
+		{"memory", mem},
+		{"sqlite", NewGormStore(db, nil)},
+		{"sqlite snapshot", NewGormStore(db, func(string) *snapshot.Snapshot { return snap })},
+	}
+
+	if dsn := os.Getenv("POSTGRES_TEST_DSN"); dsn != "" {
+		pg, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+			DisableForeignKeyConstraintWhenMigrating: true,
+			Logger:                                   logger.Default.LogMode(logger.Error),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		database.Migrate(pg)
+		database.ImportCity(pg, conformanceCity, zipReader)
+		backends = append(backends, backend{"postgres", NewGormStore(pg, nil)})
+	}
+
+	return backends
+}
+
+// Compares values as the API would render them
+func same(t *testing.T, name string, got, want any) {
+	t.Helper()
+
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("%s differs\n got: %s\nwant: %s", name, gotJSON, wantJSON)
+	}
+}
+
+// Compares nearby stops, distances only to the meter as PostGIS measures
+// them its own way
+func sameNearby(t *testing.T, name string, got, want []models.NearbyStop) {
+	t.Helper()
+
+	// Keeping nil apart from empty, the API renders them differently
+	stops := func(nearby []models.NearbyStop) []models.Stop {
+		if nearby == nil {
+			return nil
+		}
+		stops := []models.Stop{}
+		for _, n := range nearby {
+			stops = append(stops, n.Stop)
+		}
+		return stops
+	}
+	same(t, name, stops(got), stops(want))
+
+	if len(got) == len(want) {
+		for i := range got {
+			if math.Abs(got[i].Distance-want[i].Distance) > 1 {
+				t.Errorf("%s: %s is %.2f m away, expected %.2f m", name, got[i].Stop.StopId, got[i].Distance, want[i].Distance)
+			}
+		}
+	}
+}
+
+type listPage[T any] struct {
+	Items []T
+	More  bool
+	Err   string
+}
+
+// Follows a backend's own cursors from the first page to the last
+func listPages[T any](list func(models.ListQuery, func(T) error) (string, error), q models.ListQuery) []listPage[T] {
+	var pages []listPage[T]
+	for range 50 {
+		var page listPage[T]
+		next, err := list(q, func(item T) error {
+			page.Items = append(page.Items, item)
+			return nil
+		})
+		if err != nil {
+			page.Err = err.Error()
+		}
+		page.More = next != ""
+		pages = append(pages, page)
+
+		if next == "" || err != nil {
+			break
+		}
+		q.Cursor = next
+	}
+	return pages
+}
+
+func compareList[T any](t *testing.T, name string, sqlList, memList func(models.ListQuery, func(T) error) (string, error), sorts []string) {
+	t.Helper()
+
+	for _, sort := range append([]string{"", "nope"}, sorts...) {
+		for _, desc := range []bool{false, true} {
+			for _, limit := range []int{0, 1, 2, 3} {
+				q := models.ListQuery{Sort: sort, Desc: desc, Limit: limit}
+				same(t, fmt.Sprintf("%s %+v", name, q), listPages(sqlList, q), listPages(memList, q))
+			}
+		}
+	}
+
+	q := models.ListQuery{Cursor: "garbage", Limit: 1}
+	same(t, name+" bad cursor", listPages(sqlList, q), listPages(memList, q))
+}
+
+func TestStoresAgree(t *testing.T) {
+	backends := conformanceStores(t)
+	for _, b := range backends[1:] {
+		t.Run(b.name, func(t *testing.T) {
+			compareStores(t, b.store, backends[0].store)
+		})
+	}
+}
+
+// Holds a backend to the reference, sqlStore is the one under test
+func compareStores(t *testing.T, sqlStore, memStore Store) {
+	city := conformanceCity
+
+	t.Run("lists", func(t *testing.T) {
+		compareList(t, "stops",
+			func(q models.ListQuery, fn func(models.Stop) error) (string, error) {
+				return sqlStore.Stops(city, q, fn)
+			},
+			func(q models.ListQuery, fn func(models.Stop) error) (string, error) {
+				return memStore.Stops(city, q, fn)
+			},
+			[]string{"stop_id", "stop_code", "stop_name", "stop_lat", "stop_lon"})
+		compareList(t, "routes",
+			func(q models.ListQuery, fn func(models.Route) error) (string, error) {
+				return sqlStore.Routes(city, q, fn)
+			},
+			func(q models.ListQuery, fn func(models.Route) error) (string, error) {
+				return memStore.Routes(city, q, fn)
+			},
+			[]string{"route_id", "route_short_name", "route_long_name", "route_type"})
+		compareList(t, "trips",
+			func(q models.ListQuery, fn func(models.Trip) error) (string, error) {
+				return sqlStore.Trips(city, q, fn)
+			},
+			func(q models.ListQuery, fn func(models.Trip) error) (string, error) {
+				return memStore.Trips(city, q, fn)
+			},
+			[]string{"trip_id", "route_id", "service_id", "trip_headsign", "direction_id"})
+	})
+
+	t.Run("trips and routes", func(t *testing.T) {
+		for _, id := range []string{"T1", "T2", "T3", "T4", "MF1", "NT1", "NT2", "missing"} {
+			for _, precision := range []int{0, 5, 6} {
+				sqlTrip, sqlOk := sqlStore.TripDetail(city, id, precision)
+				memTrip, memOk := memStore.TripDetail(city, id, precision)
+				same(t, fmt.Sprintf("trip %s precision %d", id, precision), []any{sqlTrip, sqlOk}, []any{memTrip, memOk})
+			}
+
+			for _, stops := range [][2]string{{"", ""}, {"S3", "S5"}, {"S4", ""}, {"S5", "S1"}, {"S7", ""}} {
+				sqlSeg, sqlErr := sqlStore.(TripShapes).TripShapeSegment(city, id, stops[0], stops[1], 0)
+				memSeg, memErr := memStore.(TripShapes).TripShapeSegment(city, id, stops[0], stops[1], 0)
+				same(t, fmt.Sprintf("trip %s segment %v", id, stops), []any{sqlSeg, fmt.Sprint(sqlErr)}, []any{memSeg, fmt.Sprint(memErr)})
+			}
+		}
+
+		for _, id := range []string{"R1", "M1", "N9", "R0", "missing"} {
+			sqlRoute, sqlOk := sqlStore.RouteDetail(city, id)
+			memRoute, memOk := memStore.RouteDetail(city, id)
+			same(t, "route "+id, []any{sqlRoute, sqlOk}, []any{memRoute, memOk})
+		}
+		routes := []string{"R1", "M1", "N9", "R0", "missing"}
+		same(t, "route shapes", sqlStore.RouteShapes(city, routes), memStore.RouteShapes(city, routes))
+	})
+
+	t.Run("boards", func(t *testing.T) {
+		metro := []models.Type{models.METRO}
+		inbound, outbound := models.INBOUND, models.OUTBOUND
+		filters := []models.DepartureFilter{
+			{},
+			{Routes: []string{"R1"}},
+			{Routes: []string{"M1", "N9"}},
+			{RouteTypes: metro},
+			{Direction: &inbound},
+			{Direction: &outbound},
+			{Headsign: "poli"},
+			{Headsign: "CENTRUM"},
+			{Wheelchair: true},
+			{Bikes: true},
+			{Boardable: true},
+			{From: "06:10:00", To: "06:40:00"},
+			{From: "23:00:00"},
+			{To: "09:00:00", Boardable: true},
+			{From: "24:00:00", To: "24:30:00"},
+		}
+		dates := []time.Time{
+			time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local),
+			time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local),
+			time.Date(2026, 10, 24, 0, 0, 0, 0, time.Local),
+			time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local),
+			time.Date(2030, 1, 1, 0, 0, 0, 0, time.Local),
+		}
+		// Comparing empty boards would prove nothing
+		monday := dates[0]
+		if n := len(sqlStore.Departures(city, "ST", monday, models.DepartureFilter{}, -1)); n < 10 {
+			t.Fatalf("expected the station's Monday board to be busy, got %d departures", n)
+		}
+		if n := len(sqlStore.Departures(city, "S2", monday, models.DepartureFilter{From: "24:00:00"}, -1)); n == 0 {
+			t.Fatal("expected departures after midnight")
+		}
+
+		for _, stop := range []string{"ST", "S1", "S2", "S3", "S4", "S5", "S6", "S7", "E1", "missing"} {
+			for _, date := range dates {
+				for i, filter := range filters {
+					for _, limit := range []int{-1, 0, 2} {
+						name := fmt.Sprintf("%s on %s, filter %d, limit %d", stop, date.Format("2006-01-02"), i, limit)
+						same(t, "departures from "+name,
+							sqlStore.Departures(city, stop, date, filter, limit),
+							memStore.Departures(city, stop, date, filter, limit))
+						same(t, "arrivals at "+name,
+							sqlStore.Arrivals(city, stop, date, filter, limit),
+							memStore.Arrivals(city, stop, date, filter, limit))
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("shapes", func(t *testing.T) {
+		sqlIDs, memIDs := sqlStore.ShapeIDs(city), memStore.ShapeIDs(city)
+		same(t, "shape IDs", sqlIDs, memIDs)
+		// T3, MF1, NT1 and NT2 have no shape of their own
+		if len(sqlIDs) != 5 {
+			t.Errorf("expected SH1 and four synthetic shapes, got %v", sqlIDs)
+		}
+
+		for _, id := range append(sqlIDs, "missing") {
+			same(t, "shape "+id, sqlStore.Shape(city, id), memStore.Shape(city, id))
+
+			sqlInfo, sqlOk := sqlStore.ShapeInfo(city, id)
+			memInfo, memOk := memStore.ShapeInfo(city, id)
+			same(t, "shape info "+id, []any{sqlInfo, sqlOk}, []any{memInfo, memOk})
+		}
+	})
+
+	t.Run("services", func(t *testing.T) {
+		for _, date := range []time.Time{
+			time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local),
+			time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local),
+			time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local),
+			time.Date(2030, 1, 1, 0, 0, 0, 0, time.Local),
+		} {
+			day := date.Format("2006-01-02")
+			same(t, "services on "+day, sqlStore.ServicesForDate(city, date), memStore.ServicesForDate(city, date))
+			same(t, "overview from "+day, sqlStore.ServiceOverview(city, date, 14), memStore.ServiceOverview(city, date, 14))
+		}
+
+		for _, id := range []string{"WK", "WE", "HOL", "missing"} {
+			sqlService, sqlOk := sqlStore.ServiceDetail(city, id)
+			memService, memOk := memStore.ServiceDetail(city, id)
+			same(t, "service "+id, []any{sqlService, sqlOk}, []any{memService, memOk})
+		}
+	})
+
+	t.Run("feed", func(t *testing.T) {
+		same(t, "feed info", sqlStore.FeedInfo(city), memStore.FeedInfo(city))
+		same(t, "unknown city feed info", sqlStore.FeedInfo("missing"), memStore.FeedInfo("missing"))
+
+		for _, languages := range [][]string{nil, {"pl"}, {"en"}, {"EN-gb"}, {"de", "en"}, {"de"}, {"pl", "en"}} {
+			sqlTr, memTr := sqlStore.Translator(city, languages), memStore.Translator(city, languages)
+			if (sqlTr == nil) != (memTr == nil) || (sqlTr != nil && sqlTr.Language != memTr.Language) {
+				t.Errorf("translator for %v: sql %+v, memory %+v", languages, sqlTr, memTr)
+				continue
+			}
+
+			sqlRoute, _ := sqlStore.RouteDetail(city, "R1")
+			memRoute, _ := memStore.RouteDetail(city, "R1")
+			sqlTr.RouteDetail(&sqlRoute)
+			memTr.RouteDetail(&memRoute)
+			same(t, fmt.Sprintf("route R1 in %v", languages), sqlRoute, memRoute)
+		}
+	})
+
+	t.Run("spatial", func(t *testing.T) {
+		if stops, _ := sqlStore.StopsAlongRoute(city, "N9", 300, 0); len(stops) == 0 {
+			t.Fatal("expected stops along the synthetic shape of N9")
+		}
+
+		for _, radius := range []float64{0, 50, 500, 5000} {
+			sameNearby(t, fmt.Sprintf("nearby within %.0f", radius),
+				sqlStore.StopsNearby(city, 52.2290, 21.0030, radius, 0),
+				memStore.StopsNearby(city, 52.2290, 21.0030, radius, 0))
+			sameNearby(t, fmt.Sprintf("nearest 2 within %.0f", radius),
+				sqlStore.StopsNearby(city, 52.2290, 21.0030, radius, 2),
+				memStore.StopsNearby(city, 52.2290, 21.0030, radius, 2))
+		}
+		sameNearby(t, "nearby null island", sqlStore.StopsNearby(city, 0, 0, 1000, 0), memStore.StopsNearby(city, 0, 0, 1000, 0))
+
+		for _, box := range []geo.BBox{
+			{MinLat: 52.21, MinLon: 21.00, MaxLat: 52.24, MaxLon: 21.02},
+			{MinLat: 52.228, MinLon: 21.002, MaxLat: 52.230, MaxLon: 21.004},
+			{MinLat: -1, MinLon: -1, MaxLat: 1, MaxLon: 1},
+		} {
+			for _, limit := range []int{0, 2} {
+				same(t, fmt.Sprintf("bbox %+v limit %d", box, limit),
+					sqlStore.StopsInBBox(city, box, limit), memStore.StopsInBBox(city, box, limit))
+			}
+		}
+
+		for _, route := range []string{"R1", "M1", "N9", "R0", "missing"} {
+			for _, distance := range []float64{20, 300, 3000} {
+				name := fmt.Sprintf("along %s within %.0f", route, distance)
+				sqlStops, sqlOk := sqlStore.StopsAlongRoute(city, route, distance, 0)
+				memStops, memOk := memStore.StopsAlongRoute(city, route, distance, 0)
+				same(t, name+" found", sqlOk, memOk)
+				sameNearby(t, name, sqlStops, memStops)
+			}
+		}
+	})
+
+	t.Run("timetables", func(t *testing.T) {
+		for _, route := range []string{"R1", "M1", "N9", "R0", "missing"} {
+			for _, date := range []time.Time{
+				time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local),
+				time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local),
+				time.Date(2026, 10, 24, 0, 0, 0, 0, time.Local),
+			} {
+				for _, direction := range []models.Direction{models.INBOUND, models.OUTBOUND} {
+					sqlTable, sqlOk := sqlStore.(Timetables).Timetable(city, route, date, direction)
+					memTable, memOk := memStore.(Timetables).Timetable(city, route, date, direction)
+					same(t, fmt.Sprintf("timetable %s on %s direction %d", route, date.Format("2006-01-02"), direction),
+						[]any{sqlTable, sqlOk}, []any{memTable, memOk})
+				}
+			}
+		}
+	})
+
+	t.Run("vehicles", func(t *testing.T) {
+		for _, date := range []time.Time{
+			time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local),
+			time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local),
+		} {
+			for _, clock := range []string{"00:10:00", "06:02:00", "06:25:00", "08:05:00", "09:10:00", "10:15:00", "23:55:00", "24:10:00", "25:00:00"} {
+				secs, _ := utils.ParseGTFSTime(clock)
+				same(t, fmt.Sprintf("vehicles on %s at %s", date.Format("2006-01-02"), clock),
+					sqlStore.(Vehicles).ScheduledVehicles(city, date, secs),
+					memStore.(Vehicles).ScheduledVehicles(city, date, secs))
+			}
+		}
+	})
+
+	t.Run("tiles", func(t *testing.T) {
+		for z := 8; z <= 16; z += 2 {
+			x, y := tileAt(52.2290, 21.0030, z)
+			for _, tile := range [][2]int{{x, y}, {x + 1, y}, {x, y + 1}, {0, 0}} {
+				same(t, fmt.Sprintf("tile %d/%d/%d", z, tile[0], tile[1]),
+					sqlStore.(Tiles).Tile(city, z, tile[0], tile[1]),
+					memStore.(Tiles).Tile(city, z, tile[0], tile[1]))
+			}
+		}
+	})
+
+	t.Run("fares", func(t *testing.T) {
+		for _, ride := range [][3]string{{"S1", "S3", ""}, {"S1", "S5", "R1"}, {"S5", "S4", ""}, {"S7", "S6", "N9"}, {"missing", "S1", ""}} {
+			same(t, fmt.Sprintf("fares %v", ride),
+				sqlStore.(Fares).Fares(city, ride[0], ride[1], ride[2]),
+				memStore.(Fares).Fares(city, ride[0], ride[1], ride[2]))
+		}
+		for _, ids := range [][2][]string{
+			{nil, nil},
+			{{"S1", "S3", "S1"}, {"R1"}},
+			{{"ST", "S4", "missing"}, {"M1", "N9", "M1"}},
+		} {
+			same(t, fmt.Sprintf("fare data %v", ids),
+				sqlStore.(Fares).FareData(city, ids[0], ids[1]),
+				memStore.(Fares).FareData(city, ids[0], ids[1]))
+		}
+	})
+
+	t.Run("stations", func(t *testing.T) {
+		for _, id := range []string{"ST", "S1", "S3", "missing"} {
+			sqlStation, sqlOk := sqlStore.(Stations).Station(city, id)
+			memStation, memOk := memStore.(Stations).Station(city, id)
+			same(t, "station "+id, []any{sqlStation, sqlOk}, []any{memStation, memOk})
+		}
+	})
+}
+
+// The slippy map tile covering a point
+func tileAt(lat, lon float64, z int) (x, y int) {
+	n := math.Exp2(float64(z))
+	rad := lat * math.Pi / 180
+	x = int((lon + 180) / 360 * n)
+	y = int((1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * n)
+	return x, y
+}
+
+// The agreement above would not notice every backend being wrong the same
+// way, so each one is also held to values worked out by hand from the feed
+func TestStoresMatchFixture(t *testing.T) {
+	for _, b := range conformanceStores(t) {
+		t.Run(b.name, func(t *testing.T) {
+			checkFixture(t, b.store)
+		})
+	}
+}
+
+func checkFixture(t *testing.T, s Store) {
+	city := conformanceCity
+	monday := time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)
+
+	t.Run("lists", func(t *testing.T) {
+		var names []string
+		s.Stops(city, models.ListQuery{Sort: "stop_name", Limit: 3}, func(stop models.Stop) error {
+			names = append(names, stop.StopName)
+			return nil
+		})
+		same(t, "first stops by name", names, []string{"Bez współrzędnych", "Centrum", "Centrum"})
+
+		var trips []string
+		s.Trips(city, models.ListQuery{Sort: "trip_id", Desc: true}, func(trip models.Trip) error {
+			trips = append(trips, trip.TripId)
+			return nil
+		})
+		same(t, "trips", trips, []string{"T4", "T3", "T2", "T1", "NT2", "NT1", "MF1"})
+	})
+
+	t.Run("board", func(t *testing.T) {
+		// WK and HOL run on the Monday, the metro's headways stop before
+		// their end times and T3 ends at platform 2
+		var board []string
+		for _, dep := range s.Departures(city, "ST", monday, models.DepartureFilter{}, -1) {
+			board = append(board, dep.DepartureTime+" "+dep.TripId+" "+dep.StopId)
+		}
+		same(t, "ST on Monday", board, []string{
+			"06:00:00 MF1 S2", "06:10:00 MF1 S2", "06:20:00 MF1 S2", "06:30:00 MF1 S2", "06:40:00 MF1 S2", "06:50:00 MF1 S2",
+			"08:00:00 T1 S1", "09:00:00 T2 S1", "10:20:00 T3 S2",
+			"23:00:00 MF1 S2", "23:30:00 MF1 S2", "23:50:00 NT1 S2", "24:00:00 MF1 S2",
+		})
+
+		var boardable []string
+		for _, dep := range s.Departures(city, "ST", monday, models.DepartureFilter{From: "08:00:00", To: "12:00:00", Boardable: true}, -1) {
+			boardable = append(boardable, dep.TripId)
+		}
+		same(t, "boardable ST in the morning", boardable, []string{"T1", "T2"})
+	})
+
+	t.Run("trip", func(t *testing.T) {
+		trip, ok := s.TripDetail(city, "T1", 0)
+		if !ok || len(trip.StopTimes) != 4 {
+			t.Fatalf("expected T1 with four stops, got %v %+v", ok, trip)
+		}
+		// 166 of the 600 seconds to S4, S3 being that share of the way
+		// there in a straight line
+		s3 := trip.StopTimes[1]
+		same(t, "T1 at S3", []any{s3.Stop.StopId, s3.ArrivalTime, s3.Interpolated}, []any{"S3", "08:02:46", true})
+	})
+
+	t.Run("services", func(t *testing.T) {
+		same(t, "services on the exception day", s.ServicesForDate(city, monday.AddDate(0, 0, 1)),
+			[]models.ServiceSummary{{ServiceId: "WE", TripCount: 1}})
+
+		holiday, ok := s.ServiceDetail(city, "HOL")
+		same(t, "HOL", []any{ok, holiday.Calendar == nil, holiday.Dates}, []any{true, true, []string{"2026-10-19", "2026-11-01"}})
+	})
+
+	t.Run("timetable", func(t *testing.T) {
+		table, ok := s.(Timetables).Timetable(city, "R1", monday, models.INBOUND)
+		if !ok {
+			t.Fatal("expected a timetable for R1")
+		}
+		same(t, "R1 times", table.Times, [][]string{
+			{"08:00:00", "09:00:00"},
+			{"08:02:46", "09:05:00"},
+			{"08:10:00", "09:10:00"},
+			{"08:20:00", "09:20:00"},
+		})
+	})
+
+	t.Run("vehicles", func(t *testing.T) {
+		// Halfway in time between S4 and S5, so halfway along the shape
+		vehicles := s.(Vehicles).ScheduledVehicles(city, monday, 8*3600+15*60)
+		if len(vehicles) != 1 || vehicles[0].ShapeDistance == nil {
+			t.Fatalf("expected T1 on its shape, got %+v", vehicles)
+		}
+		v := vehicles[0]
+		same(t, "T1 at 08:15", []any{v.Trip.TripId, v.PreviousStop, v.NextStop, v.AtStop}, []any{"T1", "S4", "S5", false})
+		trip, _ := s.TripDetail(city, "T1", 0)
+		if want := (*trip.StopTimes[2].ShapeDistance + *trip.StopTimes[3].ShapeDistance) / 2; math.Abs(*v.ShapeDistance-want) > 0.01 {
+			t.Errorf("T1 is %.2f m along its shape, expected %.2f", *v.ShapeDistance, want)
+		}
+	})
+
+	t.Run("tiles", func(t *testing.T) {
+		x, y := tileAt(52.2290, 21.0030, 14)
+		if tile := s.(Tiles).Tile(city, 14, x, y); !bytes.Contains(tile, []byte("Dworzec Główny")) {
+			t.Error("expected the station in its tile")
+		}
+		// Too far out for stops, the line still shows
+		x, y = tileAt(52.2290, 21.0030, 8)
+		tile := s.(Tiles).Tile(city, 8, x, y)
+		if bytes.Contains(tile, []byte("stop_id")) || !bytes.Contains(tile, []byte("route_id")) {
+			t.Error("expected only routes at zoom 8")
+		}
+	})
+
+	t.Run("fares", func(t *testing.T) {
+		var ids []string
+		for _, fare := range s.(Fares).Fares(city, "S1", "S5", "") {
+			ids = append(ids, fmt.Sprintf("%s %.2f", fare.FareId, fare.Price))
+		}
+		same(t, "Z1 to Z2", ids, []string{"Z12 4.40"})
+
+		// S1 is in the centre through its station
+		data := s.(Fares).FareData(city, []string{"S1", "S4"}, []string{"R1", "N9"})
+		same(t, "fare data", []any{data.StopAreas, data.RouteNetworks, len(data.Products), len(data.LegRules)},
+			[]any{map[string][]string{"S1": {"centre"}}, map[string][]string{"R1": {"ztm"}}, 3, 3})
+	})
+
+	t.Run("station", func(t *testing.T) {
+		station, ok := s.(Stations).Station(city, "ST")
+		if !ok || len(station.Platforms) != 2 || len(station.Pathways) != 4 {
+			t.Fatalf("expected ST with two platforms and four pathways, got %v %+v", ok, station)
+		}
+		same(t, "levels", station.Levels, []models.Level{
+			{LevelId: "L-1", LevelIndex: -1, LevelName: "Perony"},
+			{LevelId: "L0", LevelIndex: 0, LevelName: "Poziom ulicy"},
+		})
+
+		// The stairs are quicker, the lift is the way without steps
+		for stepFree, want := range map[bool][]string{false: {"P1", "P2"}, true: {"P1", "P4"}} {
+			route, ok := models.FindStationRoute(station.Pathways, "E1", "S1", stepFree)
+			var path []string
+			for _, p := range route.Pathways {
+				path = append(path, p.PathwayId)
+			}
+			same(t, fmt.Sprintf("E1 to S1, step free %v", stepFree), []any{ok, path}, []any{true, want})
+		}
+	})
+
+	t.Run("spatial", func(t *testing.T) {
+		var nearby []string
+		for _, stop := range s.StopsNearby(city, 52.2290, 21.0030, 500, 0) {
+			nearby = append(nearby, stop.Stop.StopId)
+		}
+		// Entrances and nodes are left out, Centrum is 580 m away
+		same(t, "around ST", nearby, []string{"ST", "S1", "S2"})
+
+		along, ok := s.StopsAlongRoute(city, "M1", 50, 0)
+		var ids []string
+		for _, stop := range along {
+			ids = append(ids, stop.Stop.StopId)
+		}
+		same(t, "along M1", []any{ok, ids}, []any{true, []string{"S2", "S4", "ST", "S1"}})
+	})
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/database"
+	"git.marceeli.ovh/vectura/vectura-api/fares"
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/snapshot"
+	"gorm.io/gorm"
+)
+
+// GormStore reads from the imported tables, on Postgres or SQLite. Departure
+// boards and trips are served from a city's snapshot when snapshots has one
+// for it. The tables only answer them for a store made without snapshots,
+// the server builds every city's before it starts.
+type GormStore struct {
+	db        *gorm.DB
+	snapshots func(city string) *snapshot.Snapshot
+}
+
+// NewGormStore takes where to look up snapshots, nil to always query the
+// tables
+func NewGormStore(db *gorm.DB, snapshots func(city string) *snapshot.Snapshot) *GormStore {
+	return &GormStore{db: db, snapshots: snapshots}
+}
+
+func (s *GormStore) snapshot(city string) *snapshot.Snapshot {
+	if s.snapshots == nil {
+		return nil
+	}
+	return s.snapshots(city)
+}
+
+func (s *GormStore) Translator(city string, languages []string) *models.Translator {
+	return database.GetTranslator(s.db, city, languages)
+}
+
+func (s *GormStore) RouteDetail(city string, id string) (models.RouteDetail, bool) {
+	return database.GetRouteDetail(s.db, city, id)
+}
+
+func (s *GormStore) Stops(city string, q models.ListQuery, fn func(models.Stop) error) (string, error) {
+	return database.GetStops(s.db, city, q, fn)
+}
+
+func (s *GormStore) Routes(city string, q models.ListQuery, fn func(models.Route) error) (string, error) {
+	return database.GetRoutes(s.db, city, q, fn)
+}
+
+func (s *GormStore) Trips(city string, q models.ListQuery, fn func(models.Trip) error) (string, error) {
+	return database.GetTrips(s.db, city, q, fn)
+}
+
+func (s *GormStore) TripDetail(city string, id string, polylinePrecision int) (models.TripDetail, bool) {
+	if snap := s.snapshot(city); snap != nil {
+		return snap.TripDetail(id, polylinePrecision)
+	}
+	return database.GetTripDetail(s.db, city, id, polylinePrecision)
+}
+
+func (s *GormStore) Departures(city string, stop string, date time.Time, filter models.DepartureFilter, limit int) []models.Departure {
+	if snap := s.snapshot(city); snap != nil {
+		return snap.Board(stop, date, filter, limit, false)
+	}
+	return database.GetDeparturesForStopOnDate(s.db, city, stop, date, limit, filter)
+}
+
+func (s *GormStore) Arrivals(city string, stop string, date time.Time, filter models.DepartureFilter, limit int) []models.Departure {
+	if snap := s.snapshot(city); snap != nil {
+		return snap.Board(stop, date, filter, limit, true)
+	}
+	return database.GetArrivalsForStopOnDate(s.db, city, stop, date, limit, filter)
+}
+
+func (s *GormStore) Shape(city string, id string) []models.Shape {
+	return database.GetShapeById(s.db, city, id)
+}
+
+func (s *GormStore) ShapeInfo(city string, id string) (models.ShapeInfo, bool) {
+	return database.GetShapeInfo(s.db, city, id)
+}
+
+func (s *GormStore) ShapeIDs(city string) []string {
+	var ids []string
+	for _, info := range database.GetShapeInfos(s.db, city) {
+		ids = append(ids, info.ShapeId)
+	}
+	return ids
+}
+
+func (s *GormStore) RouteShapes(city string, routes []string) map[string][][][2]float64 {
+	return database.GetRouteShapes(s.db, city, routes)
+}
+
+func (s *GormStore) StopsNearby(city string, lat, lon, radius float64, limit int) []models.NearbyStop {
+	return database.GetStopsNearby(s.db, city, lat, lon, radius, limit)
+}
+
+func (s *GormStore) StopsInBBox(city string, box geo.BBox, limit int) []models.Stop {
+	return database.GetStopsInBBox(s.db, city, box, limit)
+}
+
+func (s *GormStore) StopsAlongRoute(city string, route string, distance float64, limit int) ([]models.NearbyStop, bool) {
+	return database.GetStopsAlongRoute(s.db, city, route, distance, limit)
+}
+
+func (s *GormStore) ServicesForDate(city string, date time.Time) []models.ServiceSummary {
+	return database.GetServicesForDate(s.db, city, date)
+}
+
+func (s *GormStore) ServiceOverview(city string, from time.Time, days int) []models.ServiceDay {
+	return database.GetServiceOverview(s.db, city, from, days)
+}
+
+func (s *GormStore) ServiceDetail(city string, id string) (models.ServiceDetail, bool) {
+	return database.GetServiceDetail(s.db, city, id)
+}
+
+func (s *GormStore) FeedInfo(city string) models.FeedInfo {
+	return database.GetFeedInfo(s.db, city)
+}
+
+func (s *GormStore) TripShapeSegment(city string, trip string, fromStop string, toStop string, polylinePrecision int) (models.ShapeSegment, error) {
+	return database.GetTripShapeSegment(s.db, city, trip, fromStop, toStop, polylinePrecision)
+}
+
+func (s *GormStore) Timetable(city string, route string, date time.Time, direction models.Direction) (models.Timetable, bool) {
+	return database.GetTimetable(s.db, city, route, date, direction)
+}
+
+func (s *GormStore) ScheduledVehicles(city string, date time.Time, secs int) []models.VehiclePosition {
+	return database.GetScheduledVehicles(s.db, city, date, secs)
+}
+
+func (s *GormStore) Tile(city string, z, x, y int) []byte {
+	return database.GetTile(s.db, city, z, x, y)
+}
+
+func (s *GormStore) Fares(city string, from string, to string, route string) []models.FareAttribute {
+	return database.GetFares(s.db, city, from, to, route)
+}
+
+func (s *GormStore) FareData(city string, stopIDs []string, routeIDs []string) fares.Data {
+	return database.GetFareData(s.db, city, stopIDs, routeIDs)
+}
+
+func (s *GormStore) Station(city string, id string) (models.Station, bool) {
+	return database.GetStation(s.db, city, id)
+}
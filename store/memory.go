@@ -0,0 +1,158 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/fares"
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/snapshot"
+	"git.marceeli.ovh/vectura/vectura-api/tiles"
+)
+
+// MemoryStore serves cities wholly from snapshots, without a database.
+// Cities that were never loaded look empty.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	cities map[string]*snapshot.Snapshot
+	tiles  *tiles.Cache
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		cities: make(map[string]*snapshot.Snapshot),
+		tiles:  tiles.NewCache(10000),
+	}
+}
+
+// Load adds a city or replaces it as a whole
+func (s *MemoryStore) Load(snap *snapshot.Snapshot) {
+	s.mu.Lock()
+	s.cities[snap.City] = snap
+	s.mu.Unlock()
+
+	s.tiles.Clear(snap.City)
+}
+
+var emptySnapshot = snapshot.New("", snapshot.Data{})
+
+// Snapshot of a city, an empty one when it was never loaded
+func (s *MemoryStore) snapshot(city string) *snapshot.Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if snap, ok := s.cities[city]; ok {
+		return snap
+	}
+	return emptySnapshot
+}
+
+func (s *MemoryStore) Stops(city string, q models.ListQuery, fn func(models.Stop) error) (string, error) {
+	return models.ListStops(s.snapshot(city).Stops(), q, fn)
+}
+
+func (s *MemoryStore) Routes(city string, q models.ListQuery, fn func(models.Route) error) (string, error) {
+	return models.ListRoutes(s.snapshot(city).Routes(), q, fn)
+}
+
+func (s *MemoryStore) Trips(city string, q models.ListQuery, fn func(models.Trip) error) (string, error) {
+	return models.ListTrips(s.snapshot(city).Trips(), q, fn)
+}
+
+func (s *MemoryStore) TripDetail(city string, id string, polylinePrecision int) (models.TripDetail, bool) {
+	return s.snapshot(city).TripDetail(id, polylinePrecision)
+}
+
+func (s *MemoryStore) RouteDetail(city string, id string) (models.RouteDetail, bool) {
+	return s.snapshot(city).RouteDetail(id)
+}
+
+func (s *MemoryStore) TripShapeSegment(city string, trip string, fromStop string, toStop string, polylinePrecision int) (models.ShapeSegment, error) {
+	return s.snapshot(city).TripShapeSegment(trip, fromStop, toStop, polylinePrecision)
+}
+
+func (s *MemoryStore) Departures(city string, stop string, date time.Time, filter models.DepartureFilter, limit int) []models.Departure {
+	return s.snapshot(city).Board(stop, date, filter, limit, false)
+}
+
+func (s *MemoryStore) Arrivals(city string, stop string, date time.Time, filter models.DepartureFilter, limit int) []models.Departure {
+	return s.snapshot(city).Board(stop, date, filter, limit, true)
+}
+
+func (s *MemoryStore) Shape(city string, id string) []models.Shape {
+	return s.snapshot(city).Shape(id)
+}
+
+func (s *MemoryStore) ShapeInfo(city string, id string) (models.ShapeInfo, bool) {
+	return s.snapshot(city).ShapeInfo(id)
+}
+
+func (s *MemoryStore) ShapeIDs(city string) []string {
+	return s.snapshot(city).ShapeIDs()
+}
+
+func (s *MemoryStore) RouteShapes(city string, routes []string) map[string][][][2]float64 {
+	return s.snapshot(city).RouteShapes(routes)
+}
+
+func (s *MemoryStore) StopsNearby(city string, lat, lon, radius float64, limit int) []models.NearbyStop {
+	return models.NearbyStops(s.snapshot(city).Stops(), lat, lon, radius, limit)
+}
+
+func (s *MemoryStore) StopsInBBox(city string, box geo.BBox, limit int) []models.Stop {
+	return models.StopsInBBox(s.snapshot(city).Stops(), box, limit)
+}
+
+func (s *MemoryStore) StopsAlongRoute(city string, route string, distance float64, limit int) ([]models.NearbyStop, bool) {
+	snap := s.snapshot(city)
+	if _, ok := snap.Route(route); !ok {
+		return nil, false
+	}
+	return models.StopsAlongLines(snap.Stops(), snap.RouteShapes([]string{route})[route], distance, limit), true
+}
+
+func (s *MemoryStore) ServicesForDate(city string, date time.Time) []models.ServiceSummary {
+	return s.snapshot(city).ServicesForDate(date)
+}
+
+func (s *MemoryStore) ServiceOverview(city string, from time.Time, days int) []models.ServiceDay {
+	return s.snapshot(city).ServiceOverview(from, days)
+}
+
+func (s *MemoryStore) ServiceDetail(city string, id string) (models.ServiceDetail, bool) {
+	return s.snapshot(city).ServiceDetail(id)
+}
+
+func (s *MemoryStore) FeedInfo(city string) models.FeedInfo {
+	return s.snapshot(city).FeedInfo()
+}
+
+func (s *MemoryStore) Translator(city string, languages []string) *models.Translator {
+	return s.snapshot(city).Translator(languages)
+}
+
+func (s *MemoryStore) Timetable(city string, route string, date time.Time, direction models.Direction) (models.Timetable, bool) {
+	return s.snapshot(city).Timetable(route, date, direction)
+}
+
+func (s *MemoryStore) ScheduledVehicles(city string, date time.Time, secs int) []models.VehiclePosition {
+	return s.snapshot(city).ScheduledVehicles(date, secs)
+}
+
+func (s *MemoryStore) Tile(city string, z, x, y int) []byte {
+	snap := s.snapshot(city)
+	return s.tiles.Tile(city, z, x, y, snap.TileSource)
+}
+
+func (s *MemoryStore) Fares(city string, from string, to string, route string) []models.FareAttribute {
+	return s.snapshot(city).Fares(from, to, route)
+}
+
+func (s *MemoryStore) FareData(city string, stopIDs []string, routeIDs []string) fares.Data {
+	return s.snapshot(city).FareData(stopIDs, routeIDs)
+}
+
+func (s *MemoryStore) Station(city string, id string) (models.Station, bool) {
+	return s.snapshot(city).Station(id)
+}
@@ -0,0 +1,88 @@
+// Package store is what the API reads a city's timetable through. Every
+// backend answers the Store methods the same way, whether it is backed by
+// the imported tables or kept wholly in memory. The smaller interfaces
+// below are capabilities a backend may lack, the API answers 501 for those.
+package store
+
+import (
+	"time"
+
+	"git.marceeli.ovh/vectura/vectura-api/fares"
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+)
+
+type Store interface {
+	// Stops, Routes and Trips page through a city's list and hand the items
+	// to fn one at a time, returning the cursor of the next page
+	Stops(city string, q models.ListQuery, fn func(models.Stop) error) (string, error)
+	Routes(city string, q models.ListQuery, fn func(models.Route) error) (string, error)
+	Trips(city string, q models.ListQuery, fn func(models.Trip) error) (string, error)
+
+	TripDetail(city string, id string, polylinePrecision int) (models.TripDetail, bool)
+	// RouteDetail returns a route with the stop patterns its trips follow
+	RouteDetail(city string, id string) (models.RouteDetail, bool)
+
+	// Departures and Arrivals return a stop's board on a date, a station
+	// stands for its platforms. A negative limit returns everything.
+	Departures(city string, stop string, date time.Time, filter models.DepartureFilter, limit int) []models.Departure
+	Arrivals(city string, stop string, date time.Time, filter models.DepartureFilter, limit int) []models.Departure
+
+	// Shape returns the points of a shape in sequence order, ShapeIDs every
+	// shape of a city sorted
+	Shape(city string, id string) []models.Shape
+	ShapeInfo(city string, id string) (models.ShapeInfo, bool)
+	ShapeIDs(city string) []string
+	// Lines of every distinct shape used by each route's trips, ordered by
+	// shape ID and keyed by route ID
+	RouteShapes(city string, routes []string) map[string][][][2]float64
+
+	// StopsNearby and StopsAlongRoute return stops and stations within a
+	// number of meters of a point or of the route's shapes, closest first.
+	// StopsInBBox keeps feed order. A limit of zero returns everything.
+	StopsNearby(city string, lat, lon, radius float64, limit int) []models.NearbyStop
+	StopsInBBox(city string, box geo.BBox, limit int) []models.Stop
+	// False when the route doesn't exist
+	StopsAlongRoute(city string, route string, distance float64, limit int) ([]models.NearbyStop, bool)
+
+	ServicesForDate(city string, date time.Time) []models.ServiceSummary
+	ServiceOverview(city string, from time.Time, days int) []models.ServiceDay
+	ServiceDetail(city string, id string) (models.ServiceDetail, bool)
+
+	// FeedInfo describes the feed version a city was loaded from
+	FeedInfo(city string) models.FeedInfo
+	// Translator returns nil when the feed language is the best match
+	Translator(city string, languages []string) *models.Translator
+}
+
+type TripShapes interface {
+	// TripShapeSegment cuts a trip's shape between two of its stops, failing
+	// with models.ErrTripNotFound, ErrTripNoShape or ErrStopNotOnTrip
+	TripShapeSegment(city string, trip string, fromStop string, toStop string, polylinePrecision int) (models.ShapeSegment, error)
+}
+
+type Timetables interface {
+	Timetable(city string, route string, date time.Time, direction models.Direction) (models.Timetable, bool)
+}
+
+type Vehicles interface {
+	// ScheduledVehicles estimates where trips are secs after midnight
+	ScheduledVehicles(city string, date time.Time, secs int) []models.VehiclePosition
+}
+
+type Tiles interface {
+	// Tile returns a Mapbox vector tile, empty when nothing is in it
+	Tile(city string, z, x, y int) []byte
+}
+
+type Fares interface {
+	// Fares returns the fare_attributes matching a ride, Fares v1
+	Fares(city string, from string, to string, route string) []models.FareAttribute
+	// FareData returns the Fares v2 rules needed to price legs between stops
+	// on routes
+	FareData(city string, stopIDs []string, routeIDs []string) fares.Data
+}
+
+type Stations interface {
+	Station(city string, id string) (models.Station, bool)
+}
@@ -0,0 +1,223 @@
+// Package tiles renders a city's stops and route shapes as Mapbox Vector
+// Tiles. It only works on what a store hands it, so every store renders the
+// same tiles.
+package tiles
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"git.marceeli.ovh/vectura/vectura-api/geo"
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"git.marceeli.ovh/vectura/vectura-api/mvt"
+)
+
+const (
+	extent = 4096
+	// Geometry past the tile edge kept so lines and icons join up seamlessly
+	buffer = 64
+	// Douglas-Peucker tolerance in tile units, the same on every zoom so
+	// lines get coarser as the tiles cover more ground
+	tolerance = 4
+	// Below this the stops layer is left out, there are too many to be useful
+	MinStopsZoom = 10
+	MaxZoom      = 20
+)
+
+// Shape is a line drawn on the routes layer, once for every route using it
+type Shape struct {
+	Points [][2]float64
+	// Corners of the bounding box
+	SW, NE [2]float64
+	Routes []models.Route
+}
+
+// Source is everything needed to cut tiles for a city
+type Source struct {
+	stops  []models.Stop
+	shapes []Shape
+}
+
+// NewSource keeps the stops and stations that have coordinates, shapes are
+// drawn in the order given
+func NewSource(stops []models.Stop, shapes []Shape) *Source {
+	source := &Source{}
+
+	for _, stop := range stops {
+		// Entrances, nodes and boarding areas belong to station maps
+		if stop.LocationType != models.STOP && stop.LocationType != models.STATION {
+			continue
+		}
+		if stop.StopLat != 0 || stop.StopLon != 0 {
+			source.stops = append(source.stops, stop)
+		}
+	}
+	for _, shape := range shapes {
+		if len(shape.Points) > 1 {
+			source.shapes = append(source.shapes, shape)
+		}
+	}
+
+	return source
+}
+
+func quantize(p [2]float64) [2]int32 {
+	return [2]int32{int32(math.Round(p[0])), int32(math.Round(p[1]))}
+}
+
+// Render encodes a tile with a "stops" and a "routes" layer
+func (s *Source) Render(z, x, y int) []byte {
+	// Bounds grown by the buffer, for picking candidates in lat/lon
+	pad := float64(buffer) / extent
+	sw, ne := geo.TileBounds(z, x, y)
+	latPad, lonPad := (ne[0]-sw[0])*pad, (ne[1]-sw[1])*pad
+	sw = [2]float64{sw[0] - latPad, sw[1] - lonPad}
+	ne = [2]float64{ne[0] + latPad, ne[1] + lonPad}
+
+	stops := mvt.NewLayer("stops", extent)
+	if z >= MinStopsZoom {
+		for i, stop := range s.stops {
+			if stop.StopLat < sw[0] || stop.StopLat > ne[0] || stop.StopLon < sw[1] || stop.StopLon > ne[1] {
+				continue
+			}
+
+			p := geo.TilePoint([2]float64{stop.StopLat, stop.StopLon}, z, x, y, extent)
+			stops.AddPoint(uint64(i+1), quantize(p), map[string]any{
+				"stop_id":             stop.StopId,
+				"stop_code":           stop.StopCode,
+				"stop_name":           stop.StopName,
+				"location_type":       stop.LocationType,
+				"parent_station":      stop.ParentStation,
+				"platform_code":       stop.PlatformCode,
+				"wheelchair_boarding": stop.WheelchairBoarding,
+			})
+		}
+	}
+
+	routes := mvt.NewLayer("routes", extent)
+	var id uint64
+	for _, shape := range s.shapes {
+		if shape.NE[0] < sw[0] || shape.SW[0] > ne[0] || shape.NE[1] < sw[1] || shape.SW[1] > ne[1] {
+			continue
+		}
+
+		projected := make([][2]float64, len(shape.Points))
+		for i, p := range shape.Points {
+			projected[i] = geo.TilePoint(p, z, x, y, extent)
+		}
+
+		var lines [][][2]int32
+		for _, part := range geo.ClipLine(projected, -buffer, extent+buffer) {
+			var line [][2]int32
+			for _, p := range geo.Simplify(part, tolerance) {
+				q := quantize(p)
+				if len(line) == 0 || line[len(line)-1] != q {
+					line = append(line, q)
+				}
+			}
+			if len(line) > 1 {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		for _, route := range shape.Routes {
+			id++
+			properties := map[string]any{
+				"route_id":         route.RouteId,
+				"route_short_name": route.RouteShortName,
+				"route_long_name":  route.RouteLongName,
+				"route_type":       route.RouteType,
+			}
+			if route.RouteColor != "" {
+				properties["route_color"] = "#" + route.RouteColor
+			}
+			if route.RouteTextColor != "" {
+				properties["route_text_color"] = "#" + route.RouteTextColor
+			}
+			routes.AddLineString(id, lines, properties)
+		}
+	}
+
+	return mvt.Encode(routes, stops)
+}
+
+// Cache keeps each city's source and the tiles rendered from it until the
+// city is cleared
+type Cache struct {
+	// Past this many tiles the cache starts over
+	limit int
+
+	mu      sync.RWMutex
+	sources map[string]*Source
+	tiles   map[string][]byte
+	// Bumped by Clear, so a render that started before it doesn't store its
+	// stale tile or source afterwards
+	generations map[string]uint64
+}
+
+func NewCache(limit int) *Cache {
+	return &Cache{
+		limit:       limit,
+		sources:     make(map[string]*Source),
+		tiles:       make(map[string][]byte),
+		generations: make(map[string]uint64),
+	}
+}
+
+// Clear drops everything cached for a city
+func (c *Cache) Clear(city string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[city]++
+	delete(c.sources, city)
+	for key := range c.tiles {
+		if strings.HasPrefix(key, city+"/") {
+			delete(c.tiles, key)
+		}
+	}
+}
+
+// Tile returns a cached tile or renders it, load is only called for a city
+// without a source yet
+func (c *Cache) Tile(city string, z, x, y int, load func() *Source) []byte {
+	key := fmt.Sprintf("%s/%d/%d/%d", city, z, x, y)
+
+	c.mu.RLock()
+	tile, ok := c.tiles[key]
+	source := c.sources[city]
+	generation := c.generations[city]
+	c.mu.RUnlock()
+	if ok {
+		return tile
+	}
+
+	if source == nil {
+		source = load()
+
+		c.mu.Lock()
+		if c.generations[city] == generation {
+			c.sources[city] = source
+		}
+		c.mu.Unlock()
+	}
+
+	tile = source.Render(z, x, y)
+
+	c.mu.Lock()
+	if c.generations[city] == generation {
+		if len(c.tiles) >= c.limit {
+			// Crude, but the hot tiles come right back
+			clear(c.tiles)
+		}
+		c.tiles[key] = tile
+	}
+	c.mu.Unlock()
+
+	return tile
+}
@@ -0,0 +1,163 @@
+package tiles
+
+import (
+	"math"
+	"testing"
+
+	"git.marceeli.ovh/vectura/vectura-api/models"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+)
+
+// The tile the tests render, over central Warsaw
+const testZ, testX, testY = 14, 9148, 5394
+
+// The [lat, lon] of a point given in units of the test tile
+func at(u, v float64) [2]float64 {
+	n := math.Exp2(testZ)
+	wx, wy := float64(testX)+u/extent, float64(testY)+v/extent
+	lat := math.Atan(math.Sinh(math.Pi*(1-2*wy/n))) * 180 / math.Pi
+	return [2]float64{lat, wx/n*360 - 180}
+}
+
+func testStop(id string, p [2]float64) models.Stop {
+	return models.Stop{StopId: id, StopName: id, StopLat: p[0], StopLon: p[1]}
+}
+
+func testShape(routeID string, points ...[2]float64) Shape {
+	shape := Shape{Points: points, SW: points[0], NE: points[0], Routes: []models.Route{{RouteId: routeID}}}
+	for _, p := range points {
+		shape.SW = [2]float64{min(shape.SW[0], p[0]), min(shape.SW[1], p[1])}
+		shape.NE = [2]float64{max(shape.NE[0], p[0]), max(shape.NE[1], p[1])}
+	}
+	return shape
+}
+
+func decode(t *testing.T, tile []byte) map[string]*geojson.FeatureCollection {
+	t.Helper()
+
+	layers, err := mvt.Unmarshal(tile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layers.ToFeatureCollections()
+}
+
+func TestRenderClipsToBuffer(t *testing.T) {
+	source := NewSource(
+		[]models.Stop{
+			testStop("inside", at(1000, 1000)),
+			testStop("buffer", at(-30, 2000)),
+			testStop("outside", at(-200, 2000)),
+			{StopId: "entrance", StopLat: at(500, 500)[0], StopLon: at(500, 500)[1], LocationType: models.ENTRANCE_EXIT},
+		},
+		[]Shape{
+			// Crosses the whole tile and then some on either side
+			testShape("across", at(-3000, 2048), at(7000, 2048)),
+			// Leaves through the bottom edge and comes back
+			testShape("dip", at(1000, 4000), at(1500, 6000), at(2000, 4000)),
+			testShape("away", at(-5000, -5000), at(-4000, -5000)),
+		},
+	)
+
+	layers := decode(t, source.Render(testZ, testX, testY))
+
+	var stops []string
+	for _, f := range layers["stops"].Features {
+		stops = append(stops, f.Properties["stop_id"].(string))
+	}
+	if len(stops) != 2 || stops[0] != "inside" || stops[1] != "buffer" {
+		t.Errorf("expected the stops inside the buffer, got %v", stops)
+	}
+
+	routes := make(map[string]orb.MultiLineString)
+	for _, f := range layers["routes"].Features {
+		// The decoder hands a single part back as a LineString
+		switch g := f.Geometry.(type) {
+		case orb.LineString:
+			routes[f.Properties["route_id"].(string)] = orb.MultiLineString{g}
+		case orb.MultiLineString:
+			routes[f.Properties["route_id"].(string)] = g
+		}
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected two routes on the tile, got %v", routes)
+	}
+
+	for id, lines := range routes {
+		for _, line := range lines {
+			for _, p := range line {
+				if p[0] < -buffer || p[0] > extent+buffer || p[1] < -buffer || p[1] > extent+buffer {
+					t.Errorf("%s: %v is past the buffer", id, p)
+				}
+			}
+		}
+	}
+
+	// Cut exactly at the buffer edges
+	across := routes["across"]
+	if len(across) != 1 || len(across[0]) != 2 ||
+		math.Abs(across[0][0][0]+buffer) > 1 || math.Abs(across[0][1][0]-(extent+buffer)) > 1 {
+		t.Errorf("expected across to run from %d to %d, got %v", -buffer, extent+buffer, across)
+	}
+	// Split in two where it leaves the tile
+	if dip := routes["dip"]; len(dip) != 2 {
+		t.Errorf("expected dip in two parts, got %v", dip)
+	}
+}
+
+func TestRenderLeavesStopsOutWhenZoomedOut(t *testing.T) {
+	source := NewSource([]models.Stop{testStop("inside", at(1000, 1000))}, []Shape{
+		testShape("across", at(-3000, 2048), at(7000, 2048)),
+	})
+
+	layers := decode(t, source.Render(MinStopsZoom-1, testX>>(testZ-MinStopsZoom+1), testY>>(testZ-MinStopsZoom+1)))
+	if _, ok := layers["stops"]; ok {
+		t.Error("expected no stops layer")
+	}
+	if _, ok := layers["routes"]; !ok {
+		t.Error("expected the routes layer")
+	}
+}
+
+func TestCache(t *testing.T) {
+	old := NewSource([]models.Stop{testStop("old", at(1000, 1000))}, nil)
+	fresh := NewSource([]models.Stop{testStop("fresh", at(1000, 1000))}, nil)
+	stopID := func(tile []byte) string {
+		return decode(t, tile)["stops"].Features[0].Properties["stop_id"].(string)
+	}
+
+	c := NewCache(10)
+	loads := 0
+	load := func(source *Source) func() *Source {
+		return func() *Source {
+			loads++
+			return source
+		}
+	}
+
+	c.Tile("city", testZ, testX, testY, load(old))
+	if got := stopID(c.Tile("city", testZ, testX, testY, load(fresh))); got != "old" || loads != 1 {
+		t.Errorf("expected the cached tile, got %s after %d loads", got, loads)
+	}
+
+	c.Clear("city")
+	if got := stopID(c.Tile("city", testZ, testX, testY, load(fresh))); got != "fresh" || loads != 2 {
+		t.Errorf("expected a fresh tile after clearing, got %s after %d loads", got, loads)
+	}
+
+	// A city cleared while its tile renders
+	c.Clear("city")
+	stale := func() *Source {
+		loads++
+		c.Clear("city")
+		return old
+	}
+	if got := stopID(c.Tile("city", testZ, testX, testY, stale)); got != "old" {
+		t.Errorf("expected the render to finish, got %s", got)
+	}
+	if got := stopID(c.Tile("city", testZ, testX, testY, load(fresh))); got != "fresh" || loads != 4 {
+		t.Errorf("expected the stale tile not to be cached, got %s after %d loads", got, loads)
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseGTFSTime converts a GTFS "H:MM:SS" time into seconds since the start
+// of the service day. Values past 24:00:00 are allowed, as in the spec.
+func ParseGTFSTime(s string) (int, bool) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+
+	var secs int
+	for _, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return 0, false
+		}
+		secs = secs*60 + v
+	}
+
+	return secs, true
+}
+
+func FormatGTFSTime(secs int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}